@@ -0,0 +1,84 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptiveDrop returns a Logf that logs to sink, unless sink has become
+// slow, in which case it drops lines to protect its callers, such as the
+// packet path, from blocking on a degraded (for example, network) sink.
+//
+// It tracks a moving average of how long recent calls to sink took. When
+// that exceeds slowThreshold, it logs a note and starts dropping all but
+// error lines (those with an "[error] " marker, as understood by
+// Normalize). Once recoverAfter has passed without a slow call, it resumes
+// logging, with a note reporting the number of lines dropped.
+func AdaptiveDrop(sink Logf, slowThreshold, recoverAfter time.Duration) Logf {
+	return adaptiveDrop(sink, slowThreshold, recoverAfter, time.Now)
+}
+
+func adaptiveDrop(sink Logf, slowThreshold, recoverAfter time.Duration, timeNow func() time.Time) Logf {
+	var (
+		mu       sync.Mutex
+		avg      time.Duration // moving average of sink latency
+		dropping bool
+		lastSlow time.Time // when a call to sink was last slow, while dropping
+		nDropped int
+	)
+	// timed calls sink and updates the latency average,
+	// returning whether the sink is now considered slow.
+	timed := func(format string, args ...any) (slow bool, latency time.Duration) {
+		start := timeNow()
+		sink(format, args...)
+		end := timeNow()
+		latency = end.Sub(start)
+
+		mu.Lock()
+		defer mu.Unlock()
+		avg += (latency - avg) / 4
+		slow = avg > slowThreshold
+		if slow {
+			lastSlow = end
+		}
+		return slow, latency
+	}
+	return func(format string, args ...any) {
+		mu.Lock()
+		if dropping {
+			if timeNow().Sub(lastSlow) < recoverAfter {
+				if level, _ := splitSeverity(format); level < Error {
+					nDropped++
+					mu.Unlock()
+					return
+				}
+				mu.Unlock()
+				timed(format, args...)
+				return
+			}
+			dropping = false
+			avg = 0 // give the sink a fresh start
+			n := nDropped
+			nDropped = 0
+			mu.Unlock()
+			sink("[RATELIMIT] log sink recovered; dropped %d lines", n)
+		} else {
+			mu.Unlock()
+		}
+
+		slow, latency := timed(format, args...)
+		if !slow {
+			return
+		}
+		mu.Lock()
+		wasDropping := dropping
+		dropping = true
+		mu.Unlock()
+		if !wasDropping {
+			sink("[RATELIMIT] log sink is slow (last write took %v); dropping non-error lines", latency)
+		}
+	}
+}
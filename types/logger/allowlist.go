@@ -0,0 +1,33 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import "sync/atomic"
+
+// StrictAllowlist returns a Logf that passes on to logf only the messages
+// whose format string is exactly one of allowedFormats, and drops all
+// others, for regulated environments where only message shapes that have
+// been reviewed to be free of personal information may be emitted. It is
+// stronger than scrubbing, since an unreviewed message never reaches logf.
+//
+// Arguments of allowed formats are passed through as is, so the review
+// must cover what each verb can expand to. The first allowed message after
+// any were dropped is preceded by a line reporting how many were.
+func StrictAllowlist(logf Logf, allowedFormats []string) Logf {
+	allowed := make(map[string]bool, len(allowedFormats))
+	for _, f := range allowedFormats {
+		allowed[f] = true
+	}
+	var nDropped atomic.Int64
+	return func(format string, args ...any) {
+		if !allowed[format] {
+			nDropped.Add(1)
+			return
+		}
+		if n := nDropped.Swap(0); n > 0 {
+			logf("[RATELIMIT] suppressed %d lines not in the log allowlist", n)
+		}
+		logf(format, args...)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"go4.org/mem"
+)
+
+// BloomDedup is BloomDedupWithRate with a false-positive rate of 1%.
+func BloomDedup(logf Logf, window time.Duration, expectedN int) Logf {
+	return BloomDedupWithRate(logf, window, expectedN, 0.01)
+}
+
+// BloomDedupWithRate returns a Logf that logs to logf, dropping messages
+// that were probably logged within the last window, using bounded memory.
+//
+// Messages are remembered in a Bloom filter sized for expectedN distinct
+// messages per window, which is replaced every window, so a message is
+// suppressed if it was seen within the last one to two windows. While at
+// most expectedN distinct messages are logged per window, a message not
+// seen before is wrongly dropped with probability about fpRate. Unlike a
+// deduplicating map, its memory use is fixed regardless of cardinality:
+// about 2.4 bytes per expected message at a 1% rate.
+func BloomDedupWithRate(logf Logf, window time.Duration, expectedN int, fpRate float64) Logf {
+	return bloomDedup(logf, window, expectedN, fpRate, time.Now)
+}
+
+func bloomDedup(logf Logf, window time.Duration, expectedN int, fpRate float64, timeNow func() time.Time) Logf {
+	var (
+		mu      sync.Mutex
+		cur     = newBloomFilter(expectedN, fpRate)
+		prev    = newBloomFilter(expectedN, fpRate)
+		rotated = timeNow()
+	)
+	return func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		mu.Lock()
+		if now := timeNow(); now.Sub(rotated) >= window {
+			if now.Sub(rotated) >= 2*window {
+				prev.reset()
+			} else {
+				prev, cur = cur, prev
+			}
+			cur.reset()
+			rotated = now
+		}
+		seen := cur.has(msg) || prev.has(msg)
+		if !seen {
+			cur.add(msg)
+		}
+		mu.Unlock()
+		if seen {
+			return
+		}
+		logf(format, args...)
+	}
+}
+
+// bloomFilter is a Bloom filter of strings.
+type bloomFilter struct {
+	salt1, salt2 uint64   // per-filter salts for the two hashes
+	k            int      // number of hash functions
+	bits         []uint64 // the filter; its length in bits is m
+	m            uint64
+}
+
+// newBloomFilter returns an empty Bloom filter sized to hold n strings
+// with a false-positive rate of p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	n = max(n, 1)
+	p = min(max(p, 1e-9), 0.5)
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	m = max(m, 64)
+	k := int(math.Round(float64(m) / float64(n) * math.Ln2))
+	return &bloomFilter{
+		salt1: rand.Uint64(),
+		salt2: rand.Uint64(),
+		k:     max(k, 1),
+		bits:  make([]uint64, (m+63)/64),
+		m:     m,
+	}
+}
+
+// indexes calls f with the index of each of s's k bits,
+// stopping early if f returns false.
+func (b *bloomFilter) indexes(s string, f func(i uint64) bool) {
+	// Kirsch-Mitzenmacher double hashing, with two hashes derived from
+	// one by salting and remixing it.
+	h := mem.S(s).MapHash()
+	h1 := mix64(h ^ b.salt1)
+	h2 := mix64(h^b.salt2) | 1
+	for i := range b.k {
+		if !f((h1 + uint64(i)*h2) % b.m) {
+			return
+		}
+	}
+}
+
+// mix64 is the SplitMix64 finalizer, which spreads each bit of x
+// over all the bits of its result.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (b *bloomFilter) add(s string) {
+	b.indexes(s, func(i uint64) bool {
+		b.bits[i/64] |= 1 << (i % 64)
+		return true
+	})
+}
+
+func (b *bloomFilter) has(s string) bool {
+	all := true
+	b.indexes(s, func(i uint64) bool {
+		all = b.bits[i/64]&(1<<(i%64)) != 0
+		return all
+	})
+	return all
+}
+
+func (b *bloomFilter) reset() {
+	clear(b.bits)
+}
@@ -0,0 +1,18 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+// BudgetGuard returns a Logf that logs to logf and, in builds with the
+// ts_enable_logbudget build tag, also measures the allocations made by each
+// call to logf and logs a warning if a single call made more than maxAllocs.
+// It is a development aid for finding log lines on hot paths that
+// inadvertently format large structures.
+//
+// Without the build tag, it returns logf unchanged, at no cost.
+//
+// The measurement uses process-wide allocation counters, so allocations by
+// other goroutines during the call are counted too; treat warnings as hints.
+func BudgetGuard(logf Logf, maxAllocs int) Logf {
+	return budgetGuard(logf, maxAllocs)
+}
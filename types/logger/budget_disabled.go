@@ -0,0 +1,10 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !ts_enable_logbudget
+
+package logger
+
+func budgetGuard(logf Logf, maxAllocs int) Logf {
+	return logf
+}
@@ -0,0 +1,20 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build ts_enable_logbudget
+
+package logger
+
+import "runtime"
+
+func budgetGuard(logf Logf, maxAllocs int) Logf {
+	return func(format string, args ...any) {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		logf(format, args...)
+		runtime.ReadMemStats(&after)
+		if n := after.Mallocs - before.Mallocs; n > uint64(maxAllocs) {
+			logf("[unexpected] log call allocated %d times, over budget of %d: format %q", n, maxAllocs, format)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build ts_enable_logbudget
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestBudgetGuard(t *testing.T) {
+	var lines []string
+	var sink []any
+	logf := BudgetGuard(func(format string, args ...any) {
+		if strings.HasPrefix(format, "expensive") {
+			for range 100 {
+				sink = append(sink, new([64]byte))
+			}
+		}
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}, 50)
+	_ = sink
+
+	logf("cheap")
+	if len(lines) != 1 {
+		t.Fatalf("cheap call: got lines %q", lines)
+	}
+
+	lines = nil
+	logf("expensive %d", 1)
+	if len(lines) != 2 || lines[0] != "expensive 1" {
+		t.Fatalf("expensive call: got lines %q", lines)
+	}
+	if !strings.HasPrefix(lines[1], "[unexpected] log call allocated ") || !strings.HasSuffix(lines[1], `over budget of 50: format "expensive %d"`) {
+		t.Errorf("warning = %q", lines[1])
+	}
+}
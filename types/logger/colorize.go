@@ -0,0 +1,75 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ANSI escape sequences used by Colorized.
+const (
+	ansiReset  = "\x1b[0m"
+	ansiGray   = "\x1b[90m"
+	ansiYellow = "\x1b[33m"
+	ansiRed    = "\x1b[31m"
+)
+
+// Colorized returns a Logf that writes each message to w as a line, with
+// its severity marker, as understood by Normalize, in color: gray for
+// debug markers like "[v1] ", yellow for warnings like "[unexpected] ",
+// and red for "[error] ". It is for running tailscaled in the foreground
+// during development, where color makes logs easier to scan.
+//
+// Color is only used if w is a terminal and the NO_COLOR environment
+// variable is unset or empty; otherwise lines are written as plain
+// text. Errors writing to w are ignored.
+func Colorized(w io.Writer) Logf {
+	return colorized(w, isTerminal(w))
+}
+
+func colorized(w io.Writer, isTTY bool) Logf {
+	color := isTTY && os.Getenv("NO_COLOR") == ""
+	var mu sync.Mutex
+	return func(format string, args ...any) {
+		if level, start, end, ok := findSeverity(format); color && ok {
+			end-- // leave the space after the marker uncolored
+			format = format[:start] + levelColor(level) + format[start:end] + ansiReset + format[end:]
+		}
+		var sb strings.Builder
+		fmt.Fprintf(&sb, format, args...)
+		if !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteByte('\n')
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		io.WriteString(w, sb.String())
+	}
+}
+
+// levelColor returns the escape sequence coloring markers of level l.
+func levelColor(l Level) string {
+	switch {
+	case l <= Debug:
+		return ansiGray
+	case l == Warn:
+		return ansiYellow
+	case l >= Error:
+		return ansiRed
+	}
+	return ""
+}
+
+// isTerminal reports whether w is a terminal (character device).
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
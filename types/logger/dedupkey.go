@@ -0,0 +1,65 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// dedupMaxKeys bounds the number of keys DedupByKey remembers.
+const dedupMaxKeys = 1000
+
+// DedupByKey returns a Logf that logs to logf, dropping each message whose
+// key, as computed by key, is the same as that of a message logged within
+// the last window. Unlike deduplicating by the formatted text, key can
+// ignore volatile fields, so that near-duplicates like "handshake with X
+// took 12ms" and "... took 13ms" are dropped too. For example, to keep one
+// message per format per window:
+//
+//	logf = logger.DedupByKey(logf, func(format string, _ []any) string {
+//		return format
+//	}, time.Minute)
+//
+// key is called for every message and must be cheap. Up to 1000 keys are
+// remembered. Beyond that, the least recently seen are forgotten, and
+// their messages may be logged again within their window.
+func DedupByKey(logf Logf, key func(format string, args []any) string, window time.Duration) Logf {
+	return dedupByKey(logf, key, window, time.Now)
+}
+
+func dedupByKey(logf Logf, key func(format string, args []any) string, window time.Duration, timeNow func() time.Time) Logf {
+	type entry struct {
+		key    string
+		logged time.Time // when the key's message was last logged
+	}
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]*list.Element) // of *entry
+		lru  = list.New()                     // a rudimentary LRU that limits the size of the map
+	)
+	return func(format string, args ...any) {
+		k := key(format, args)
+		now := timeNow()
+		mu.Lock()
+		if ele, ok := seen[k]; ok {
+			lru.MoveToFront(ele)
+			e := ele.Value.(*entry)
+			if now.Sub(e.logged) < window {
+				mu.Unlock()
+				return
+			}
+			e.logged = now
+		} else {
+			seen[k] = lru.PushFront(&entry{key: k, logged: now})
+			if lru.Len() > dedupMaxKeys {
+				delete(seen, lru.Back().Value.(*entry).key)
+				lru.Remove(lru.Back())
+			}
+		}
+		mu.Unlock()
+		logf(format, args...)
+	}
+}
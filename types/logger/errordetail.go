@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"strconv"
+	"strings"
+)
+
+// maxErrorCauses bounds the number of causes WithErrorDetail expands.
+const maxErrorCauses = 16
+
+// WithErrorDetail wraps logf so that, for a line with an error among its
+// args, the error's chain of causes, as unwrapped by errors.Unwrap or
+// errors.Join, is appended to the message as " cause1=... cause2=..."
+// suffixes, outermost first. If an error in the chain has a method
+//
+//	Stack() []byte
+//
+// as errors capturing runtime/debug.Stack may, the first such stack is
+// appended as " stack=...". Only the first error arg is expanded, and at
+// most 16 causes.
+//
+// Lines without an error arg, or whose error has no causes or stack, are
+// passed through unmodified.
+func WithErrorDetail(logf Logf) Logf {
+	return func(format string, args ...any) {
+		for _, arg := range args {
+			if err, ok := arg.(error); ok && err != nil {
+				if detail := errorDetail(err); detail != "" {
+					logf(format+"%s", append(args[:len(args):len(args)], detail)...)
+					return
+				}
+				break
+			}
+		}
+		logf(format, args...)
+	}
+}
+
+// errorDetail returns the causes and stack of err, as appended by
+// WithErrorDetail, or the empty string if it has neither.
+func errorDetail(err error) string {
+	var sb strings.Builder
+	var stack []byte
+	n := 0
+	var walk func(err error, top bool)
+	walk = func(err error, top bool) {
+		if err == nil || n >= maxErrorCauses {
+			return
+		}
+		if !top {
+			n++
+			sb.WriteString(" cause")
+			sb.WriteString(strconv.Itoa(n))
+			sb.WriteByte('=')
+			sb.WriteString(quoteFieldValue(err.Error()))
+		}
+		if s, ok := err.(interface{ Stack() []byte }); ok && stack == nil {
+			stack = s.Stack()
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(u.Unwrap(), false)
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				walk(e, false)
+			}
+		}
+	}
+	walk(err, true)
+	if len(stack) > 0 {
+		sb.WriteString(" stack=")
+		sb.WriteString(strconv.Quote(strings.TrimSuffix(string(stack), "\n")))
+	}
+	return sb.String()
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Event logs summary to logf with blob attached, for events such as a
+// netmap dump or a config apply whose details are too big to log inline
+// but too useful to lose.
+//
+// Structured sinks (Logfmt and GELF) log summary as the message and
+// blob, as compact JSON, in an "attachment" field. Text sinks log blob as
+// indented JSON on the lines below summary:
+//
+//	applied config
+//	  {
+//	    "Peers": 2
+//	  }
+//
+// A blob that fails to marshal as JSON is attached as formatted by %+v.
+func Event(logf Logf, summary string, blob any) {
+	// summary is in the format, escaped, so that sinks see any
+	// severity marker it starts with.
+	logf(strings.ReplaceAll(summary, "%", "%%")+"%v", attachment{blob})
+}
+
+// attachment is the blob arg of an Event. Its Fields are read by
+// structured sinks; its formatted form is the blob as text sinks show it.
+type attachment struct{ blob any }
+
+func (a attachment) Fields() []any { return []any{"attachment", a.json()} }
+
+// json returns the blob as compact JSON.
+func (a attachment) json() string {
+	b, err := json.Marshal(a.blob)
+	if err != nil {
+		return fmt.Sprintf("%+v", a.blob)
+	}
+	return string(b)
+}
+
+func (a attachment) Format(s fmt.State, verb rune) {
+	text := fmt.Sprintf("%+v", a.blob)
+	if b, err := json.MarshalIndent(a.blob, "", "  "); err == nil {
+		text = string(b)
+	}
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(s, "\n  %s", line)
+	}
+}
+
+// withoutAttachments returns args with any Event attachment replaced by
+// the empty string, so that structured sinks, which log it as a field
+// instead, leave it out of the message. It returns args itself if there
+// are none.
+func withoutAttachments(args []any) []any {
+	var out []any
+	for i, arg := range args {
+		if _, ok := arg.(attachment); !ok {
+			continue
+		}
+		if out == nil {
+			out = append([]any(nil), args...)
+		}
+		out[i] = ""
+	}
+	if out == nil {
+		return args
+	}
+	return out
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// exit is os.Exit, replaced by tests.
+var exit = os.Exit
+
+// fallbackLogf is used by Fatalf and Panicf when given a nil Logf.
+func fallbackLogf(format string, args ...any) {
+	log.New(os.Stderr, "", log.LstdFlags).Printf(format, args...)
+}
+
+// Fatalf logs the message to logf, or to stderr if logf is nil,
+// and then exits the process with status 1.
+//
+// It is intended for unrecoverable errors during initialization,
+// before a Logf may have been fully set up; do not use it elsewhere.
+func Fatalf(logf Logf, format string, args ...any) {
+	if logf == nil {
+		logf = fallbackLogf
+	}
+	logf(format, args...)
+	exit(1)
+}
+
+// Panicf logs the message to logf, or to stderr if logf is nil,
+// and then panics with the formatted message.
+//
+// Like Fatalf, it is intended for unrecoverable errors during initialization.
+func Panicf(logf Logf, format string, args ...any) {
+	if logf == nil {
+		logf = fallbackLogf
+	}
+	logf(format, args...)
+	panic(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Fields is implemented by types that can describe themselves in logs
+// as structured key/value pairs.
+type Fields interface {
+	// Fields returns alternating keys and values, like
+	// []any{"peer", "[IMTBr]", "endpoint", "1.2.3.4:41641"}.
+	Fields() []any
+}
+
+// WithFieldExpansion wraps logf so that, for each arg implementing Fields,
+// its key/value pairs are appended to the message as " key=value" suffixes.
+// The arg itself is still formatted as usual by its verb in format.
+//
+// Lines without any Fields args are passed through unmodified.
+func WithFieldExpansion(logf Logf) Logf {
+	return func(format string, args ...any) {
+		var sb strings.Builder
+		for _, arg := range args {
+			if f, ok := arg.(Fields); ok {
+				appendFields(&sb, f.Fields())
+			}
+		}
+		if sb.Len() == 0 {
+			logf(format, args...)
+			return
+		}
+		logf(format+"%s", append(args[:len(args):len(args)], sb.String())...)
+	}
+}
+
+// appendFields writes kvs, alternating keys and values, to sb
+// as " key=value" pairs. A trailing key without a value is
+// written as "!BADKEY=key".
+func appendFields(sb *strings.Builder, kvs []any) {
+	for i := 0; i < len(kvs); i += 2 {
+		var k string
+		var v any
+		if i+1 < len(kvs) {
+			k, v = fmt.Sprint(kvs[i]), kvs[i+1]
+		} else {
+			k, v = "!BADKEY", kvs[i]
+		}
+		sb.WriteByte(' ')
+		sb.WriteString(k)
+		sb.WriteByte('=')
+		sb.WriteString(quoteFieldValue(fmt.Sprint(v)))
+	}
+}
+
+// quoteFieldValue returns s, quoted if needed so that it reads
+// as a single value in a key=value pair.
+func quoteFieldValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+	return s
+}
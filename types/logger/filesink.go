@@ -0,0 +1,84 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A FileSink is a log sink that appends to a file, and that can reopen it
+// by path, so that logs cooperate with external rotation by a tool such
+// as logrotate: once logrotate renames the file, Reopen switches to a new
+// file at the original path. It is unrelated to, and needs none of, the
+// rotation done by logtail or filch.
+//
+// Its Logf method logs lines as text. As an io.Writer, it can also be
+// given to structured sinks such as Logfmt. It is safe for concurrent use.
+type FileSink struct {
+	path string
+
+	mu sync.Mutex // serializes writes and Reopen
+	f  *os.File
+}
+
+// OpenFileSink opens the file at path for appending, creating it if
+// needed, and returns a FileSink writing to it.
+func OpenFileSink(path string) (*FileSink, error) {
+	f, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{path: path, f: f}, nil
+}
+
+func openLogFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+}
+
+// Write writes p to the current file.
+func (s *FileSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Write(p)
+}
+
+// Logf writes the formatted line, with a trailing newline if it has none,
+// to the current file. Errors are dropped, as there is nowhere to log
+// them.
+func (s *FileSink) Logf(format string, args ...any) {
+	line := fmt.Sprintf(format, args...)
+	if !strings.HasSuffix(line, "\n") {
+		line += "\n"
+	}
+	s.Write([]byte(line))
+}
+
+// Reopen opens the file at s's path anew, creating it if needed, and
+// switches s to it, closing the old file. Lines are written whole to
+// either the old file or the new one.
+//
+// If the new file cannot be opened, Reopen returns the error and s keeps
+// writing to the old file, so that no lines are lost, even though they
+// land in the rotated file. See logsignal.ReopenOnSIGHUP.
+func (s *FileSink) Reopen() error {
+	f, err := openLogFile(s.path)
+	if err != nil {
+		return fmt.Errorf("logger: reopening %s: %w", s.path, err)
+	}
+	s.mu.Lock()
+	old := s.f
+	s.f = f
+	s.mu.Unlock()
+	return old.Close()
+}
+
+// Close closes the current file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.f.Close()
+}
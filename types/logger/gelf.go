@@ -0,0 +1,75 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gelfMessage is a GELF 1.1 message.
+// See https://go2docs.graylog.org/current/getting_in_log_data/gelf.html.
+type gelfMessage struct {
+	Version      string  `json:"version"`
+	Host         string  `json:"host"`
+	ShortMessage string  `json:"short_message"`
+	Timestamp    float64 `json:"timestamp"` // seconds since the Unix epoch
+	Level        int     `json:"level"`     // syslog severity
+
+	Attachment string `json:"_attachment,omitempty"` // an Event's blob, as JSON
+}
+
+// GELF returns a Logf that writes each message to w as a GELF (Graylog
+// Extended Log Format) 1.1 JSON object, terminated by a null byte as
+// GELF over TCP requires, for direct ingestion by Graylog.
+//
+// The level is derived from the message's severity marker, as for
+// Normalize, and the marker is removed. The attachment of an Event is in
+// the additional field "_attachment". Errors writing to w are ignored.
+func GELF(w io.Writer, host string) Logf {
+	return gelf(w, host, time.Now)
+}
+
+func gelf(w io.Writer, host string, timeNow func() time.Time) Logf {
+	var mu sync.Mutex
+	return func(format string, args ...any) {
+		level, format := splitSeverity(format)
+		msg := gelfMessage{
+			Version:      "1.1",
+			Host:         host,
+			ShortMessage: strings.TrimSuffix(fmt.Sprintf(format, withoutAttachments(args)...), "\n"),
+			Timestamp:    float64(timeNow().UnixMicro()) / 1e6,
+			Level:        syslogSeverity(level),
+		}
+		for _, arg := range args {
+			if a, ok := arg.(attachment); ok {
+				msg.Attachment = a.json()
+			}
+		}
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(append(b, 0))
+	}
+}
+
+// syslogSeverity returns the syslog severity corresponding to l.
+func syslogSeverity(l Level) int {
+	switch {
+	case l <= Debug:
+		return 7
+	case l == Info:
+		return 6
+	case l == Warn:
+		return 4
+	}
+	return 3
+}
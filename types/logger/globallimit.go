@@ -0,0 +1,109 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+
+	"tailscale.com/envknob"
+)
+
+// A GlobalRateLimiter is a log budget shared by every Logf it wraps.
+//
+// Unlike RateLimitedFn, which limits each format string separately, it bounds
+// the aggregate rate of all wrapped loggers. It is intended as a backstop
+// against a process-wide log storm, such as when many subsystems fail at once,
+// and its budget should be set well above the normal total log rate.
+type GlobalRateLimiter struct {
+	timeNow func() time.Time
+
+	mu       sync.Mutex
+	bucket   *tokenBucket
+	nDropped int // messages dropped since the last summary
+}
+
+// NewGlobalRateLimiter returns a GlobalRateLimiter allowing one message every
+// f, in bursts of up to burst messages. timeNow is used to compute rate limits.
+func NewGlobalRateLimiter(f time.Duration, burst int, timeNow func() time.Time) *GlobalRateLimiter {
+	return &GlobalRateLimiter{
+		timeNow: timeNow,
+		bucket:  newTokenBucket(f, burst, timeNow()),
+	}
+}
+
+// SetBudget changes rl to allow one message every f, in bursts of up to burst
+// messages. It resets any accumulated state.
+func (rl *GlobalRateLimiter) SetBudget(f time.Duration, burst int) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.bucket = newTokenBucket(f, burst, rl.timeNow())
+}
+
+// State returns the state of rl's shared budget, for use with Restore.
+func (rl *GlobalRateLimiter) State() BucketState {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	return rl.bucket.Snapshot()
+}
+
+// Restore resumes rl's shared budget from st, as previously returned by State,
+// so that recreating loggers (such as after a configuration reload) does not
+// grant a fresh full burst.
+func (rl *GlobalRateLimiter) Restore(st BucketState) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.bucket = newTokenBucketFromState(rl.bucket.tick, rl.bucket.max, st)
+}
+
+// Wrap returns a Logf that logs to logf, subject to rl's shared budget.
+//
+// Once the budget is exhausted, messages are dropped until it refills,
+// at which point a single summary line reporting the number of dropped
+// messages is logged before the next message.
+func (rl *GlobalRateLimiter) Wrap(logf Logf) Logf {
+	if envknob.String("TS_DEBUG_LOG_RATE") == "all" {
+		return logf
+	}
+	return func(format string, args ...any) {
+		rl.mu.Lock()
+		rl.bucket.AdvanceTo(rl.timeNow())
+		// As in RateLimitedFnWithClock, require some headroom before
+		// resuming, so that we don't alternate between dropping and not.
+		if rl.nDropped > 0 && rl.bucket.remaining < 2 {
+			rl.nDropped++
+			rl.mu.Unlock()
+			return
+		}
+		if !rl.bucket.Get() {
+			rl.nDropped++
+			rl.mu.Unlock()
+			return
+		}
+		nDropped := rl.nDropped
+		rl.nDropped = 0
+		rl.mu.Unlock() // release before calling logf
+
+		if nDropped > 0 {
+			logf("[RATELIMIT] global log budget exceeded (%d dropped)", nDropped)
+		}
+		logf(format, args...)
+	}
+}
+
+// globalRateLimiter is the limiter used by GlobalLimited.
+var globalRateLimiter = NewGlobalRateLimiter(10*time.Millisecond, 500, time.Now)
+
+// SetGlobalRateLimit sets the process-wide budget shared by all Logfs wrapped
+// with GlobalLimited to one message every f, in bursts of up to burst messages.
+// The default is one message every 10ms, in bursts of up to 500.
+func SetGlobalRateLimit(f time.Duration, burst int) {
+	globalRateLimiter.SetBudget(f, burst)
+}
+
+// GlobalLimited returns a Logf that logs to logf, subject to the process-wide
+// log budget. See GlobalRateLimiter and SetGlobalRateLimit.
+func GlobalLimited(logf Logf) Logf {
+	return globalRateLimiter.Wrap(logf)
+}
@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// WithHeartbeat returns a Logf that logs to logf and, whenever no message
+// has been logged through it for about interval, logs msg, so that a log
+// collector can tell a quiet subsystem from a stuck one. Each message
+// resets the interval. Heartbeat intervals are lengthened by up to a
+// tenth at random, so that many instances don't emit them in lockstep;
+// a heartbeat is never logged before a full interval of silence.
+//
+// It starts a goroutine, which runs until close is called; close waits
+// for it to exit. Messages logged after close are still passed on to logf.
+// If interval is not positive, WithHeartbeat returns logf itself and a
+// close that does nothing.
+func WithHeartbeat(logf Logf, interval time.Duration, msg string) (newLogf Logf, close func()) {
+	return withHeartbeat(logf, interval, interval/10, msg, time.Now, time.After)
+}
+
+func withHeartbeat(logf Logf, interval, spread time.Duration, msg string, timeNow func() time.Time, after func(time.Duration) <-chan time.Time) (Logf, func()) {
+	if interval <= 0 {
+		return logf, func() {}
+	}
+	// next returns the next heartbeat deadline, in [interval, interval+spread].
+	next := func() time.Time {
+		return timeNow().Add(Jitter(interval+spread/2, spread/2))
+	}
+	var (
+		mu       sync.Mutex
+		deadline = next()
+	)
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	var closeOnce sync.Once
+	go func() {
+		defer close(exited)
+		for {
+			mu.Lock()
+			wait := deadline.Sub(timeNow())
+			mu.Unlock()
+			if wait > 0 {
+				select {
+				case <-done:
+					return
+				case <-after(wait):
+				}
+				continue
+			}
+			mu.Lock()
+			deadline = next()
+			mu.Unlock()
+			logf("%s", msg)
+		}
+	}()
+	newLogf := func(format string, args ...any) {
+		mu.Lock()
+		deadline = next()
+		mu.Unlock()
+		logf(format, args...)
+	}
+	return newLogf, func() {
+		closeOnce.Do(func() { close(done) })
+		<-exited
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// A LevelHistogram counts the lines logged via the loggers it wraps by
+// Level, for an at-a-glance view of a subsystem's log health. It is an
+// expvar.Var, suitable for publishing.
+//
+// Levels other than the four named ones are counted as the nearest one.
+// The zero value is ready for use.
+type LevelHistogram struct {
+	counts [Error - Debug + 1]atomic.Int64 // indexed by Level-Debug
+}
+
+// Add counts a line logged at level.
+func (h *LevelHistogram) Add(level Level) {
+	h.counts[min(max(level, Debug), Error)-Debug].Add(1)
+}
+
+// WrapLeveled returns a LevelLogf that logs to ll, counting each line at
+// its level.
+func (h *LevelHistogram) WrapLeveled(ll LevelLogf) LevelLogf {
+	return func(level Level, format string, args ...any) {
+		h.Add(level)
+		ll(level, format, args...)
+	}
+}
+
+// Wrap returns a Logf that logs to logf, counting each line at the Level
+// implied by its marker, as understood by Normalize.
+func (h *LevelHistogram) Wrap(logf Logf) Logf {
+	return func(format string, args ...any) {
+		level, _ := splitSeverity(format)
+		h.Add(level)
+		logf(format, args...)
+	}
+}
+
+// Snapshot returns the number of lines counted at each of the four named
+// levels, including those with none.
+func (h *LevelHistogram) Snapshot() map[Level]int64 {
+	ret := make(map[Level]int64, len(h.counts))
+	for i := range h.counts {
+		ret[Debug+Level(i)] = h.counts[i].Load()
+	}
+	return ret
+}
+
+// String returns the counts as a JSON object keyed by level name, like
+// {"debug":3,"error":0,"info":10,"warn":1}, as required by expvar.Var.
+func (h *LevelHistogram) String() string {
+	m := make(map[string]int64, len(h.counts))
+	for l, n := range h.Snapshot() {
+		m[l.String()] = n
+	}
+	b, _ := json.Marshal(m)
+	return string(b)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"strconv"
+	"time"
+)
+
+// Bytes is a byte count that formats human-readably, in binary units,
+// like "512 B" or "1.2 MiB". Wrap a log argument with it to opt in:
+//
+//	logf("sent %v", logger.Bytes(n))
+type Bytes int64
+
+var byteUnits = []string{"KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+func (b Bytes) String() string {
+	n := int64(b)
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	if n < 1024 {
+		return sign + strconv.FormatInt(n, 10) + " B"
+	}
+	v := float64(n) / 1024
+	unit := 0
+	for v >= 1024 && unit < len(byteUnits)-1 {
+		v /= 1024
+		unit++
+	}
+	return sign + strconv.FormatFloat(v, 'f', 1, 64) + " " + byteUnits[unit]
+}
+
+// Dur is a duration that formats human-readably, rounded to a precision
+// appropriate to its magnitude, like "3.4s" or "12.3ms" rather than
+// "3.432195843s". Wrap a log argument with it to opt in:
+//
+//	logf("handshake took %v", logger.Dur(d))
+type Dur time.Duration
+
+func (d Dur) String() string {
+	v := time.Duration(d)
+	abs := v
+	if abs < 0 {
+		abs = -abs
+	}
+	switch {
+	case abs < time.Microsecond:
+		// Nanoseconds are already as short as they get.
+	case abs < time.Millisecond:
+		v = v.Round(100 * time.Nanosecond)
+	case abs < time.Second:
+		v = v.Round(100 * time.Microsecond)
+	case abs < time.Minute:
+		v = v.Round(100 * time.Millisecond)
+	case abs < time.Hour:
+		v = v.Round(time.Second)
+	default:
+		v = v.Round(time.Minute)
+	}
+	return v.String()
+}
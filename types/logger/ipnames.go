@@ -0,0 +1,74 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// cgnatRange is the range Tailscale assigns IPv4 addresses from.
+// It is duplicated from net/tsaddr to keep this package's dependencies small.
+var cgnatRange = netip.MustParsePrefix("100.64.0.0/10")
+
+// WithTailscaleIPNames returns a Logf that rewrites Tailscale IPv4
+// addresses (those in 100.64.0.0/10) that appear in formatted messages and
+// have an entry in names to "name(100.x.y.z)", before logging to logf.
+// Other addresses, and messages without any, are logged unchanged.
+//
+// Messages are only scanned where they contain "100.", so the cost for
+// other messages is a substring search. names must not be modified after
+// the call.
+func WithTailscaleIPNames(logf Logf, names map[netip.Addr]string) Logf {
+	return func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		if out, ok := replaceTailscaleIPs(msg, names); ok {
+			logf("%s", out)
+			return
+		}
+		logf(format, args...)
+	}
+}
+
+// replaceTailscaleIPs returns s with named Tailscale IPs replaced,
+// and whether any were.
+func replaceTailscaleIPs(s string, names map[netip.Addr]string) (string, bool) {
+	var sb strings.Builder
+	last := 0 // end of the part of s already written to sb
+	for i := 0; ; {
+		j := strings.Index(s[i:], "100.")
+		if j < 0 {
+			break
+		}
+		start := i + j
+		end := start
+		for end < len(s) && (s[end] == '.' || ('0' <= s[end] && s[end] <= '9')) {
+			end++
+		}
+		i = end
+		if start > 0 && (s[start-1] == '.' || ('0' <= s[start-1] && s[start-1] <= '9')) {
+			continue // 100 is the middle of some other number
+		}
+		ip, err := netip.ParseAddr(strings.TrimSuffix(s[start:end], "."))
+		if err != nil || !cgnatRange.Contains(ip) {
+			continue
+		}
+		name, ok := names[ip]
+		if !ok {
+			continue
+		}
+		sb.WriteString(s[last:start])
+		sb.WriteString(name)
+		sb.WriteByte('(')
+		sb.WriteString(ip.String())
+		sb.WriteByte(')')
+		last = start + len(ip.String())
+	}
+	if last == 0 {
+		return s, false
+	}
+	sb.WriteString(s[last:])
+	return sb.String(), true
+}
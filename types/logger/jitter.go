@@ -0,0 +1,48 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// Jitter returns a duration chosen uniformly at random from
+// [base-spread, base+spread], clamped to be non-negative.
+//
+// It is used to spread out periodic summary lines, so that many instances
+// started at the same time don't all emit them in lockstep. Callers without
+// a more specific need should use a spread of about a tenth of base.
+func Jitter(base, spread time.Duration) time.Duration {
+	return jitter(rand.Int64N, base, spread)
+}
+
+// A JitterSource is a seeded source of jittered durations,
+// for use where reproducible jitter is needed, such as in tests.
+type JitterSource struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+// NewJitterSource returns a JitterSource whose sequence of results
+// is determined by seed.
+func NewJitterSource(seed uint64) *JitterSource {
+	return &JitterSource{rng: rand.New(rand.NewPCG(seed, seed))}
+}
+
+// Jitter is like the package-level Jitter, but uses s as its source of randomness.
+func (s *JitterSource) Jitter(base, spread time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return jitter(s.rng.Int64N, base, spread)
+}
+
+func jitter(int64n func(int64) int64, base, spread time.Duration) time.Duration {
+	if spread <= 0 {
+		return max(base, 0)
+	}
+	d := base - spread + time.Duration(int64n(2*int64(spread)+1))
+	return max(d, 0)
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An ErrorRecorder remembers the most recent error message logged via the
+// loggers it wraps, so that health reporting can surface it, such as
+// "last wireguard error: ...", without scraping logs.
+type ErrorRecorder struct {
+	timeNow func() time.Time
+
+	mu  sync.Mutex
+	msg string    // most recent error message; empty if none
+	at  time.Time // when msg was logged
+}
+
+// NewErrorRecorder returns a new ErrorRecorder that has seen no errors.
+func NewErrorRecorder() *ErrorRecorder {
+	return &ErrorRecorder{timeNow: time.Now}
+}
+
+// LastError returns the most recent error message logged via r and when
+// it was logged, or ("", time.Time{}) if there has been none.
+func (r *ErrorRecorder) LastError() (msg string, at time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.msg, r.at
+}
+
+// WrapLeveled returns a LevelLogf that logs to ll, recording messages
+// logged at Error level or above.
+func (r *ErrorRecorder) WrapLeveled(ll LevelLogf) LevelLogf {
+	return func(level Level, format string, args ...any) {
+		if level >= Error {
+			r.record(fmt.Sprintf(format, args...))
+		}
+		ll(level, format, args...)
+	}
+}
+
+// Wrap returns a Logf that logs to logf, recording messages with an
+// "[error] " marker, as understood by Normalize. The marker is not
+// included in the recorded message.
+func (r *ErrorRecorder) Wrap(logf Logf) Logf {
+	return func(format string, args ...any) {
+		if level, f := splitSeverity(format); level >= Error {
+			r.record(fmt.Sprintf(f, args...))
+		}
+		logf(format, args...)
+	}
+}
+
+func (r *ErrorRecorder) record(msg string) {
+	msg = strings.TrimSuffix(msg, "\n")
+	now := r.timeNow()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msg, r.at = msg, now
+}
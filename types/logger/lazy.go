@@ -0,0 +1,32 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Lazy returns an arg for a Logf whose value is computed by fn only when
+// the line is formatted, for values that are expensive to produce on lines
+// that are usually dropped, such as verbose lines or rate-limited ones:
+//
+//	logf("[v1] netmap: %v", logger.Lazy(func() any { return nm.VeryConcise() }))
+//
+// Wrappers that drop lines without formatting them, such as
+// RateLimitedFn, never call fn. fn is called at most once, however many
+// times the line is formatted, and the value it returns is formatted with
+// the verb and flags the Lazy arg is formatted with.
+//
+// Wrappers that format each line early, such as Transform, call fn even
+// if a later wrapper drops the line.
+func Lazy(fn func() any) fmt.Formatter {
+	return lazyArg{sync.OnceValue(fn)}
+}
+
+type lazyArg struct{ v func() any }
+
+func (a lazyArg) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, fmt.FormatString(s, verb), a.v())
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a log message.
+//
+// The zero value is Info, so that an unset Level means "normal" logging.
+type Level int32
+
+const (
+	Debug Level = iota - 1
+	Info
+	Warn
+	Error
+)
+
+func (l Level) String() string {
+	switch l {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Level(%d)", int32(l))
+}
+
+// ParseLevel returns the Level named by s, as returned by Level.String.
+// Names are case-insensitive, and the aliases "verbose" (for Debug),
+// "warning" and "err" are also accepted.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug", "verbose":
+		return Debug, nil
+	case "info":
+		return Info, nil
+	case "warn", "warning":
+		return Warn, nil
+	case "error", "err":
+		return Error, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// globalVerbosity is the process-wide minimum level; see GlobalVerbosity.
+var globalVerbosity atomic.Int32
+
+// SetGlobalVerbosity sets the process-wide minimum level that subsystems
+// consulting GlobalVerbosity should log at.
+func SetGlobalVerbosity(l Level) {
+	globalVerbosity.Store(int32(l))
+}
+
+// GlobalVerbosity returns the process-wide minimum level that should be
+// logged. Messages less severe than it should be dropped by subsystems that
+// honor it. It defaults to Info.
+//
+// It is a single atomic load and is cheap enough to call on every log line.
+func GlobalVerbosity() Level {
+	return Level(globalVerbosity.Load())
+}
+
+// LevelLogf is like Logf, but takes the severity of the message.
+type LevelLogf func(level Level, format string, args ...any)
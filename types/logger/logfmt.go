@@ -0,0 +1,50 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logfmt returns a Logf that writes each message to w as a line of logfmt
+// key=value pairs, for tooling that prefers it to JSON or GELF:
+//
+//	time=2023-11-14T22:13:20.25Z level=warn msg="handshake failed" peer=[IMTBr]
+//
+// The time is in UTC, in RFC 3339 format. The level is derived from the
+// message's severity marker, as for Normalize, and the marker is removed
+// from msg. The key/value pairs of each arg implementing Fields, such as
+// the attachment of an Event, follow msg. Values that are empty or contain
+// spaces, tabs, newlines, quotes or equals signs are quoted, as Go
+// strings. Errors writing to w are ignored.
+func Logfmt(w io.Writer) Logf {
+	return logfmt(w, time.Now)
+}
+
+func logfmt(w io.Writer, timeNow func() time.Time) Logf {
+	var mu sync.Mutex
+	return func(format string, args ...any) {
+		level, format := splitSeverity(format)
+		var sb strings.Builder
+		sb.WriteString("time=")
+		sb.WriteString(timeNow().UTC().Format(time.RFC3339Nano))
+		sb.WriteString(" level=")
+		sb.WriteString(level.String())
+		sb.WriteString(" msg=")
+		sb.WriteString(quoteFieldValue(strings.TrimSuffix(fmt.Sprintf(format, withoutAttachments(args)...), "\n")))
+		for _, arg := range args {
+			if f, ok := arg.(Fields); ok {
+				appendFields(&sb, f.Fields())
+			}
+		}
+		sb.WriteByte('\n')
+		mu.Lock()
+		defer mu.Unlock()
+		io.WriteString(w, sb.String())
+	}
+}
@@ -14,6 +14,7 @@
 	"fmt"
 	"io"
 	"log"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -31,8 +32,20 @@
 type Logf func(format string, args ...any)
 
 // LogfKey stores and loads [Logf] values within a [context.Context].
+// If no Logf is present, [LogfKey.Value] returns log.Printf.
+//
+// A request-scoped Logf in a context is a complement to, not a replacement
+// for, explicit Logf parameters: libraries should continue to accept a Logf
+// where one is needed, and use the context only to avoid threading a
+// preconfigured Logf through deep call chains.
 var LogfKey = ctxkey.New("", Logf(log.Printf))
 
+// NewContext returns a copy of ctx carrying logf, retrievable
+// with [LogfKey.Value]. It is shorthand for LogfKey.WithValue(ctx, logf).
+func NewContext(ctx context.Context, logf Logf) context.Context {
+	return LogfKey.WithValue(ctx, logf)
+}
+
 // A Context is a context.Context that should contain a custom log function, obtainable from FromContext.
 // If no log function is present, FromContext will return log.Printf.
 // To construct a Context, use Add
@@ -104,6 +117,34 @@ func WithPrefix(f Logf, prefix string) Logf {
 	}
 }
 
+// WithElapsed wraps f, prefixing each format with the time elapsed since
+// start, formatted like "+1.234s ". It is intended for profiling sequences
+// such as startup, where relative timing is more useful than timestamps.
+//
+// Elapsed time is computed with time.Time.Sub, which uses the monotonic
+// clock reading if start has one (as values from time.Now do).
+func WithElapsed(f Logf, start time.Time) Logf {
+	return withElapsed(f, start, time.Now)
+}
+
+func withElapsed(f Logf, start time.Time, timeNow func() time.Time) Logf {
+	return func(format string, args ...any) {
+		secs := timeNow().Sub(start).Seconds()
+		f("+"+strconv.FormatFloat(secs, 'f', 3, 64)+"s "+format, args...)
+	}
+}
+
+// WithGenerationFunc wraps f, prefixing each format with "gen=N ", where N
+// is the value returned by gen at the time of the call. It is intended for
+// tagging lines with the generation of some configuration, such as a
+// netmap, so that logs can be correlated with the version that produced
+// them.
+func WithGenerationFunc(f Logf, gen func() uint64) Logf {
+	return func(format string, args ...any) {
+		f("gen="+strconv.FormatUint(gen(), 10)+" "+format, args...)
+	}
+}
+
 // FuncWriter returns an io.Writer that writes to f.
 func FuncWriter(f Logf) io.Writer {
 	return funcWriter{f}
@@ -121,6 +162,65 @@ func (w funcWriter) Write(p []byte) (int, error) {
 	return len(p), nil
 }
 
+// LogfWriter returns an io.WriteCloser that splits the bytes written to it
+// into lines and logs each line to f, without its trailing newline.
+// It is intended for feeding libraries that log to an io.Writer into a Logf.
+//
+// A partial line is buffered until it is completed by a later Write,
+// until it grows beyond 64KiB, or until Close is called.
+// The returned writer is safe for concurrent use.
+func LogfWriter(f Logf) io.WriteCloser {
+	return &lineWriter{f: f}
+}
+
+// maxLineWriterBuf is the size beyond which lineWriter logs a partial line
+// rather than continuing to buffer it.
+const maxLineWriterBuf = 64 << 10
+
+type lineWriter struct {
+	f Logf
+
+	mu  sync.Mutex
+	buf []byte // partial line
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := len(p)
+	for {
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			break
+		}
+		line := p[:i]
+		if len(w.buf) > 0 {
+			w.buf = append(w.buf, line...)
+			line = w.buf
+		}
+		w.f("%s", line)
+		w.buf = w.buf[:0]
+		p = p[i+1:]
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) > maxLineWriterBuf {
+		w.f("%s", w.buf)
+		w.buf = w.buf[:0]
+	}
+	return n, nil
+}
+
+// Close logs any buffered partial line.
+func (w *lineWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.buf) > 0 {
+		w.f("%s", w.buf)
+		w.buf = nil
+	}
+	return nil
+}
+
 // Discard is a Logf that throws away the logs given to it.
 func Discard(string, ...any) {}
 
@@ -335,6 +435,87 @@ func Filtered(logf Logf, allow func(s string) bool) Logf {
 	}
 }
 
+// EnableIf returns a Logf that logs to logf only the lines for which pred
+// returns true. Unlike Filtered, pred sees the format and args rather than
+// the formatted message, so it can inspect the args (such as a peer or IP)
+// without paying to format lines it rejects. It is intended for targeted
+// debugging, such as enabling verbose logging only for one peer.
+//
+// pred must not retain args, and must be safe for concurrent use.
+func EnableIf(logf Logf, pred func(format string, args []any) bool) Logf {
+	return func(format string, args ...any) {
+		if pred(format, args) {
+			logf(format, args...)
+		}
+	}
+}
+
+// When returns a Logf that logs to logf only while cond returns true,
+// calling cond before any formatting is done, as a replacement for
+// "if debug { logf(...) }" at each call site.
+//
+// It only saves the cost of formatting: the args have already been
+// evaluated by the time the returned Logf is called. For lines whose args
+// are themselves expensive to compute, use WhenFunc.
+func When(cond func() bool, logf Logf) Logf {
+	return func(format string, args ...any) {
+		if cond() {
+			logf(format, args...)
+		}
+	}
+}
+
+// WhenFunc is like When, but returns a func taking the line as a func that
+// returns its format and args, which is only called while cond returns
+// true, so that even computing the args is skipped otherwise:
+//
+//	debugf := logger.WhenFunc(debugEnabled, logf)
+//	debugf(func() (string, []any) { return "state: %v", []any{expensiveDump()} })
+func WhenFunc(cond func() bool, logf Logf) func(line func() (format string, args []any)) {
+	return func(line func() (string, []any)) {
+		if cond() {
+			format, args := line()
+			logf(format, args...)
+		}
+	}
+}
+
+// Serialized returns a Logf that logs to sink while holding a mutex, so that
+// concurrent calls never overlap and each line reaches sink intact, even if
+// sink writes to an io.Writer without synchronization of its own. Messages
+// are formatted before the mutex is acquired, so that slow formatting by one
+// caller doesn't hold up others.
+func Serialized(sink Logf) Logf {
+	var mu sync.Mutex
+	return func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		mu.Lock()
+		defer mu.Unlock()
+		sink("%s", msg)
+	}
+}
+
+// A Counter is a metric counter, such as an *expvar.Int or a
+// *clientmetric.Metric.
+type Counter interface {
+	Add(delta int64)
+}
+
+// Counted returns a Logf that logs to logf and also increments counter for
+// each message whose format string contains match. It is intended for log
+// lines that are really events worth counting, like handshake failures.
+//
+// Matching is on the format string rather than the formatted message, so it
+// is cheap and unaffected by the args.
+func Counted(logf Logf, match string, counter Counter) Logf {
+	return func(format string, args ...any) {
+		if strings.Contains(format, match) {
+			counter.Add(1)
+		}
+		logf(format, args...)
+	}
+}
+
 // LogfCloser wraps logf to create a logger that can be closed.
 // Calling close makes all future calls to newLogf into no-ops.
 func LogfCloser(logf Logf) (newLogf Logf, close func()) {
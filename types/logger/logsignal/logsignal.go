@@ -0,0 +1,37 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package logsignal wires the flush and reopen funcs of package logger's
+// buffered and file sinks to process signals. It is separate from package
+// logger so that importers of logger don't pull in signal handling.
+package logsignal
+
+import (
+	"os"
+	"os/signal"
+)
+
+// FlushOnSignal calls flush, the flush func of a buffered Logf such as
+// logger.JoinMultilineWithFlush or logger.RequestScoped, each time the
+// process receives one of sigs, until stop is called. It lets an operator
+// force buffered lines out on demand, such as before capturing a core
+// dump of a hung process. See FlushOnSIGUSR1 for the conventional signal.
+func FlushOnSignal(flush func(), sigs ...os.Signal) (stop func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, sigs...)
+	go func() {
+		for {
+			select {
+			case <-c:
+				flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(done)
+	}
+}
@@ -0,0 +1,18 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build windows || wasm || plan9 || tamago
+
+package logsignal
+
+import "tailscale.com/types/logger"
+
+// FlushOnSIGUSR1 does nothing on this platform, which has no SIGUSR1.
+func FlushOnSIGUSR1(flush func()) (stop func()) {
+	return func() {}
+}
+
+// ReopenOnSIGHUP does nothing on this platform, which has no SIGHUP.
+func ReopenOnSIGHUP(s *logger.FileSink, logf logger.Logf) (stop func()) {
+	return func() {}
+}
@@ -0,0 +1,32 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !windows && !wasm && !plan9 && !tamago
+
+package logsignal
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFlushOnSIGUSR1(t *testing.T) {
+	flushed := make(chan bool, 1)
+	stop := FlushOnSIGUSR1(func() {
+		select {
+		case flushed <- true:
+		default:
+		}
+	})
+	defer stop()
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-flushed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("flush not called after SIGUSR1")
+	}
+}
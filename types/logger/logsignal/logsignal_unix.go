@@ -0,0 +1,31 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !windows && !wasm && !plan9 && !tamago
+
+package logsignal
+
+import (
+	"syscall"
+
+	"tailscale.com/types/logger"
+)
+
+// FlushOnSIGUSR1 is FlushOnSignal for SIGUSR1. On platforms without
+// SIGUSR1, such as Windows, it does nothing.
+func FlushOnSIGUSR1(flush func()) (stop func()) {
+	return FlushOnSignal(flush, syscall.SIGUSR1)
+}
+
+// ReopenOnSIGHUP calls s.Reopen each time the process receives SIGHUP,
+// as logrotate sends it after renaming a log file, until stop is called.
+// Reopen failures are logged to logf, which may be s itself, since s then
+// still writes to the old file. On platforms without SIGHUP, such as
+// Windows, it does nothing.
+func ReopenOnSIGHUP(s *logger.FileSink, logf logger.Logf) (stop func()) {
+	return FlushOnSignal(func() {
+		if err := s.Reopen(); err != nil {
+			logf("%v", err)
+		}
+	}, syscall.SIGHUP)
+}
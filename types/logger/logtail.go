@@ -0,0 +1,104 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// ToLogtail returns a Logf that feeds each message into the log upload
+// pipeline of w, which is normally a *logtail.Logger (which this package
+// cannot import), so that subsystems that only know about Logf can be
+// uploaded without their own bridge.
+//
+// Each message is written to w in a single Write, as logtail requires, with
+// its severity marker intact for logtail to parse. Batching, compression and
+// upload retries are left to logtail. If a Write fails, such as when
+// logtail's buffer is full because uploads are failing, the message is
+// dropped rather than retried, so that logging never blocks on the network;
+// the next successful Write is preceded by a line reporting how many were
+// dropped.
+func ToLogtail(w io.Writer) Logf {
+	var (
+		mu       sync.Mutex
+		nDropped int
+	)
+	return func(format string, args ...any) {
+		line := fmt.Appendf(nil, format, args...)
+		if len(line) == 0 || line[len(line)-1] != '\n' {
+			line = append(line, '\n')
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if nDropped > 0 {
+			note := fmt.Appendf(nil, "[RATELIMIT] logtail buffer full; dropped %d lines\n", nDropped)
+			if _, err := w.Write(note); err != nil {
+				nDropped++
+				return
+			}
+			nDropped = 0
+		}
+		if _, err := w.Write(line); err != nil {
+			nDropped++
+		}
+	}
+}
+
+// ToLogtailBatched is like ToLogtail, but buffers messages and writes them
+// to w together, in order: once maxLines messages are buffered, maxDelay
+// after the first message of a batch if fewer arrive, and whenever flush is
+// called, such as at shutdown. It spares w, whose every Write takes its
+// buffer lock, from bursts of single-line Writes by chatty subsystems, at
+// the cost of up to maxDelay of latency. A maxLines of 1 or less writes
+// each message at once, as ToLogtail does.
+func ToLogtailBatched(w io.Writer, maxLines int, maxDelay time.Duration) (logf Logf, flush func()) {
+	return toLogtailBatched(w, maxLines, maxDelay, func(d time.Duration, f func()) { time.AfterFunc(d, f) })
+}
+
+func toLogtailBatched(w io.Writer, maxLines int, maxDelay time.Duration, afterFunc func(time.Duration, func())) (Logf, func()) {
+	write := ToLogtail(w)
+	var (
+		mu      sync.Mutex
+		pending []string // formatted messages not yet written
+		gen     int      // incremented on each flush, to detect stale timers
+	)
+	// flushLocked writes the pending messages, holding mu so that no newer
+	// message can be written ahead of them.
+	flushLocked := func() {
+		for _, line := range pending {
+			write("%s", line)
+		}
+		pending = pending[:0]
+		gen++
+	}
+	flush := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		flushLocked()
+	}
+	logf := func(format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		mu.Lock()
+		defer mu.Unlock()
+		pending = append(pending, line)
+		if len(pending) >= maxLines {
+			flushLocked()
+			return
+		}
+		if len(pending) == 1 {
+			myGen := gen
+			afterFunc(maxDelay, func() {
+				mu.Lock()
+				defer mu.Unlock()
+				if gen == myGen {
+					flushLocked()
+				}
+			})
+		}
+	}
+	return logf, flush
+}
@@ -0,0 +1,150 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JoinMultiline returns a Logf that joins the lines of Go stack traces
+// (panics and goroutine dumps) that are logged one line per call into a
+// single record, with the lines separated by an escaped newline (`\n`),
+// so that per-line log processors keep a trace together.
+//
+// The heuristic is conservative: joining starts only at a line beginning
+// with "panic: " or a goroutine header such as "goroutine 1 [running]:",
+// and continues only while lines look like parts of a stack trace
+// (function frames, tab-indented file positions, "created by" lines,
+// further goroutine headers, and the blank lines between them). All other
+// lines are logged immediately and as-is.
+//
+// A trace is logged when the first line that is not part of it arrives,
+// or after a short idle period if none does.
+func JoinMultiline(logf Logf) Logf {
+	newLogf, _ := joinMultiline(logf, 500*time.Millisecond)
+	return newLogf
+}
+
+// JoinMultilineWithFlush is like JoinMultiline, but also returns a func
+// that logs the trace being joined, if any, immediately, such as before
+// capturing a core dump of a hung process; see logsignal.FlushOnSignal.
+func JoinMultilineWithFlush(logf Logf) (newLogf Logf, flush func()) {
+	return joinMultiline(logf, 500*time.Millisecond)
+}
+
+func joinMultiline(logf Logf, idle time.Duration) (newLogf Logf, flush func()) {
+	var (
+		mu      sync.Mutex
+		pending []string // lines of the trace being joined; nil if none
+		gen     int      // incremented on each flush, to detect stale timers
+	)
+	// flushLocked returns the pending record, if any, and resets it.
+	flushLocked := func() (rec string, ok bool) {
+		if pending == nil {
+			return "", false
+		}
+		// Drop trailing blank lines, which separate, not belong to, traces.
+		for len(pending) > 1 && pending[len(pending)-1] == "" {
+			pending = pending[:len(pending)-1]
+		}
+		rec = strings.Join(pending, `\n`)
+		pending = nil
+		gen++
+		return rec, true
+	}
+	flush = func() {
+		mu.Lock()
+		rec, ok := flushLocked()
+		mu.Unlock()
+		if ok {
+			logf("%s", rec)
+		}
+	}
+	newLogf = func(format string, args ...any) {
+		line := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+
+		mu.Lock()
+		if pending != nil && isStackContinuation(line) {
+			pending = append(pending, line)
+			mu.Unlock()
+			return
+		}
+		rec, flushed := flushLocked()
+		startTrace := isStackStart(line)
+		if startTrace {
+			pending = []string{line}
+			myGen := gen
+			time.AfterFunc(idle, func() {
+				mu.Lock()
+				if gen != myGen {
+					mu.Unlock()
+					return
+				}
+				rec, ok := flushLocked()
+				mu.Unlock()
+				if ok {
+					logf("%s", rec)
+				}
+			})
+		}
+		mu.Unlock()
+
+		if flushed {
+			logf("%s", rec)
+		}
+		if !startTrace {
+			logf("%s", line)
+		}
+	}
+	return newLogf, flush
+}
+
+// isStackStart reports whether line starts a Go stack trace.
+func isStackStart(line string) bool {
+	return strings.HasPrefix(line, "panic: ") || isGoroutineHeader(line)
+}
+
+// isGoroutineHeader reports whether line is like "goroutine 1 [running]:".
+func isGoroutineHeader(line string) bool {
+	rest, ok := strings.CutPrefix(line, "goroutine ")
+	return ok && strings.HasSuffix(rest, "]:") && strings.Contains(rest, " [")
+}
+
+// isStackContinuation reports whether line looks like a line within a Go
+// stack trace that follows its first line.
+func isStackContinuation(line string) bool {
+	switch {
+	case line == "":
+		return true
+	case line[0] == '\t':
+		return true
+	case strings.HasPrefix(line, "created by "):
+		return true
+	case isGoroutineHeader(line):
+		return true
+	}
+	return isStackFrame(line)
+}
+
+// isStackFrame reports whether line looks like a function frame in a Go
+// stack trace, such as "main.main()" or "net/http.(*conn).serve(0x1400)".
+func isStackFrame(line string) bool {
+	if !strings.HasSuffix(line, ")") {
+		return false
+	}
+	i := strings.IndexByte(line, '(')
+	if i <= 0 {
+		return false
+	}
+	fn := line[:i]
+	if strings.HasSuffix(fn, ".") {
+		// A method with a pointer receiver, like "pkg.(*T).M(...)";
+		// the function name is the whole thing before the last "(".
+		fn = line[:strings.LastIndexByte(line, '(')]
+	}
+	return !strings.ContainsAny(fn, " \t") && strings.Contains(fn, ".")
+}
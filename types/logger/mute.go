@@ -0,0 +1,69 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// A Mutable can temporarily mute every Logf it wraps, such as during a
+// planned noisy operation like a bulk reconfiguration.
+//
+// While muted, lines are dropped and counted, except for error lines (those
+// with an "[error] " marker, as understood by Normalize), which are always
+// logged. Once unmuted, a single summary line reporting the number of
+// suppressed lines is logged before the next line.
+type Mutable struct {
+	timeNow func() time.Time
+
+	mu          sync.Mutex
+	mutedUntil  time.Time // zero if not muted
+	nSuppressed int       // lines dropped since the last summary
+}
+
+// NewMutable returns a new, unmuted Mutable.
+func NewMutable() *Mutable {
+	return &Mutable{timeNow: time.Now}
+}
+
+// Mute mutes m for d, after which it unmutes automatically.
+// A later call replaces the window of an earlier one.
+func (m *Mutable) Mute(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mutedUntil = m.timeNow().Add(d)
+}
+
+// Unmute unmutes m immediately.
+func (m *Mutable) Unmute() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.mutedUntil = time.Time{}
+}
+
+// Wrap returns a Logf that logs to logf unless m is muted.
+func (m *Mutable) Wrap(logf Logf) Logf {
+	return func(format string, args ...any) {
+		m.mu.Lock()
+		if !m.mutedUntil.IsZero() && m.timeNow().Before(m.mutedUntil) {
+			if level, _ := splitSeverity(format); level < Error {
+				m.nSuppressed++
+				m.mu.Unlock()
+				return
+			}
+			m.mu.Unlock()
+			logf(format, args...)
+			return
+		}
+		n := m.nSuppressed
+		m.nSuppressed = 0
+		m.mu.Unlock() // release before calling logf
+
+		if n > 0 {
+			logf("resumed logging, suppressed %d lines", n)
+		}
+		logf(format, args...)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+// onceMaxMessages bounds the number of messages Once remembers.
+const onceMaxMessages = 1000
+
+// Once returns a Logf that logs each distinct formatted message to logf
+// only the first time it is seen, dropping repeats for the life of the
+// Logf, for setup messages like "using fallback DNS" that would otherwise
+// be repeated on every reconnect.
+//
+// Up to 1000 distinct messages are remembered. Beyond that, the least
+// recently repeated are forgotten, and may be logged once more.
+func Once(logf Logf) Logf {
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]*list.Element) // keyed by formatted message
+		lru  = list.New()                     // a rudimentary LRU that limits the size of the map
+	)
+	return func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		mu.Lock()
+		if ele, ok := seen[msg]; ok {
+			lru.MoveToFront(ele)
+			mu.Unlock()
+			return
+		}
+		seen[msg] = lru.PushFront(msg)
+		if lru.Len() > onceMaxMessages {
+			delete(seen, lru.Back().Value.(string))
+			lru.Remove(lru.Back())
+		}
+		mu.Unlock()
+		logf("%s", msg)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package oslog
+
+import (
+	"golang.org/x/sys/windows/svc/eventlog"
+	"tailscale.com/types/logger"
+)
+
+// eventLogWriter is the subset of *eventlog.Log used by EventLogSink.
+type eventLogWriter interface {
+	Info(eid uint32, msg string) error
+	Warning(eid uint32, msg string) error
+	Error(eid uint32, msg string) error
+}
+
+// EventLogSink returns a Logf that writes each line to l, with event ID
+// eid, as an Event Log entry of the type implied by its marker: a
+// warning for "[unexpected] " and "[warning] ", an error for "[error] ",
+// and informational otherwise, including for "[v1] " and "[v2] ", as the
+// Event Log has no debug type. The marker is removed. Write errors are
+// ignored.
+func EventLogSink(l *eventlog.Log, eid uint32) logger.Logf {
+	return eventLogSink(l, eid)
+}
+
+func eventLogSink(w eventLogWriter, eid uint32) logger.Logf {
+	return logger.Leveled(func(level logger.Level, format string, args ...any) {
+		msg := message(format, args...)
+		switch {
+		case level <= logger.Info:
+			w.Info(eid, msg)
+		case level == logger.Warn:
+			w.Warning(eid, msg)
+		default:
+			w.Error(eid, msg)
+		}
+	})
+}
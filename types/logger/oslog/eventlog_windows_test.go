@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package oslog
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+type fakeEventLog struct {
+	got []string
+}
+
+func (f *fakeEventLog) add(typ string, eid uint32, msg string) error {
+	f.got = append(f.got, fmt.Sprintf("%s %d: %s", typ, eid, msg))
+	return nil
+}
+
+func (f *fakeEventLog) Info(eid uint32, msg string) error    { return f.add("info", eid, msg) }
+func (f *fakeEventLog) Warning(eid uint32, msg string) error { return f.add("warning", eid, msg) }
+func (f *fakeEventLog) Error(eid uint32, msg string) error   { return f.add("error", eid, msg) }
+
+func TestEventLogSink(t *testing.T) {
+	var w fakeEventLog
+	logf := eventLogSink(&w, 7)
+	logf("hello %d", 1)
+	logf("[v1] verbose")
+	logf("[warning] careful\n")
+	logf("[error] boom")
+	want := []string{
+		"info 7: hello 1",
+		"info 7: verbose",
+		"warning 7: careful",
+		"error 7: boom",
+	}
+	if !slices.Equal(w.got, want) {
+		t.Errorf("got %q; want %q", w.got, want)
+	}
+}
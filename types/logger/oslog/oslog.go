@@ -0,0 +1,19 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+// Package oslog contains logger.Logf sinks that write to the operating
+// system's native log facility: syslog on Unix and the Event Log on
+// Windows. It is separate from package logger so that importers of
+// logger don't pull in the platform logging packages.
+package oslog
+
+import (
+	"fmt"
+	"strings"
+)
+
+// message formats a log line for a facility that records one message per
+// call and terminates it itself.
+func message(format string, args ...any) string {
+	return strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+}
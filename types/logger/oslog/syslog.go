@@ -0,0 +1,45 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !windows && !plan9
+
+package oslog
+
+import (
+	"log/syslog"
+
+	"tailscale.com/types/logger"
+)
+
+// syslogWriter is the subset of *syslog.Writer used by SyslogSink.
+type syslogWriter interface {
+	Debug(m string) error
+	Info(m string) error
+	Warning(m string) error
+	Err(m string) error
+}
+
+// SyslogSink returns a Logf that writes each line to w at the syslog
+// severity implied by its marker: LOG_DEBUG for "[v1] " and "[v2] ",
+// LOG_WARNING for "[unexpected] " and "[warning] ", LOG_ERR for
+// "[error] ", and LOG_INFO otherwise. The marker is removed, as syslog
+// records the severity itself. Write errors are ignored.
+func SyslogSink(w *syslog.Writer) logger.Logf {
+	return syslogSink(w)
+}
+
+func syslogSink(w syslogWriter) logger.Logf {
+	return logger.Leveled(func(level logger.Level, format string, args ...any) {
+		msg := message(format, args...)
+		switch {
+		case level <= logger.Debug:
+			w.Debug(msg)
+		case level == logger.Info:
+			w.Info(msg)
+		case level == logger.Warn:
+			w.Warning(msg)
+		default:
+			w.Err(msg)
+		}
+	})
+}
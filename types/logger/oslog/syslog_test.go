@@ -0,0 +1,40 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+//go:build !windows && !plan9
+
+package oslog
+
+import (
+	"slices"
+	"testing"
+)
+
+type fakeSyslog struct {
+	got []string
+}
+
+func (f *fakeSyslog) Debug(m string) error   { f.got = append(f.got, "debug: "+m); return nil }
+func (f *fakeSyslog) Info(m string) error    { f.got = append(f.got, "info: "+m); return nil }
+func (f *fakeSyslog) Warning(m string) error { f.got = append(f.got, "warning: "+m); return nil }
+func (f *fakeSyslog) Err(m string) error     { f.got = append(f.got, "err: "+m); return nil }
+
+func TestSyslogSink(t *testing.T) {
+	var w fakeSyslog
+	logf := syslogSink(&w)
+	logf("hello %d", 1)
+	logf("[v1] magicsock: %s", "details")
+	logf("wg: [v2] handshake")
+	logf("[unexpected] odd\n")
+	logf("[error] boom: %v", "EOF")
+	want := []string{
+		"info: hello 1",
+		"debug: magicsock: details",
+		"debug: wg: handshake",
+		"warning: odd",
+		"err: boom: EOF",
+	}
+	if !slices.Equal(w.got, want) {
+		t.Errorf("got %q; want %q", w.got, want)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// PeriodicStats calls fn every interval and logs the line it returns, such
+// as "stats: rx=10 tx=12 handshakes=1 errors=0", to logf, for subsystems
+// that are better summarized by aggregate counters than logged per event.
+// Empty lines are not logged. Each interval is jittered by a tenth, as
+// with Jitter, so that many instances don't log their stats in lockstep.
+//
+// It starts a goroutine, which runs until close is called. Once close
+// returns, fn is no longer called and nothing more is logged.
+func PeriodicStats(logf Logf, interval time.Duration, fn func() string) (close func()) {
+	return periodicStats(logf, interval, interval/10, fn, time.After)
+}
+
+func periodicStats(logf Logf, interval, spread time.Duration, fn func() string, after func(time.Duration) <-chan time.Time) func() {
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		for {
+			select {
+			case <-done:
+				return
+			case <-after(Jitter(interval, spread)):
+			}
+			if line := fn(); line != "" {
+				logf("%s", line)
+			}
+		}
+	}()
+	var closeOnce sync.Once
+	return func() {
+		closeOnce.Do(func() { close(done) })
+		<-exited
+	}
+}
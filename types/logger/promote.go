@@ -0,0 +1,88 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// maxSpikeFormats bounds the number of formats PromoteOnSpike tracks.
+const maxSpikeFormats = 1000
+
+// PromoteOnSpike returns a Logf that passes each line to ll with the Level
+// implied by its marker, as for Leveled, except that an Info line whose
+// format has suddenly become frequent is promoted to Warn, so that an
+// emergent problem surfaces on dashboards that only show warnings.
+//
+// Rates are measured per format over consecutive windows of the given
+// length. A format is promoted as soon as it is logged promoteAt times
+// within one window, and stays promoted until a whole window passes in
+// which it is logged fewer than demoteBelow times. demoteBelow should be
+// well under promoteAt, so that a rate hovering around the threshold
+// doesn't flap between levels.
+func PromoteOnSpike(ll LevelLogf, window time.Duration, promoteAt, demoteBelow int) Logf {
+	return promoteOnSpike(ll, window, promoteAt, demoteBelow, time.Now)
+}
+
+// spikeState is the rate of a single format, for PromoteOnSpike.
+type spikeState struct {
+	start    time.Time // start of the current window
+	n        int       // lines in the current window
+	promoted bool
+}
+
+func promoteOnSpike(ll LevelLogf, window time.Duration, promoteAt, demoteBelow int, timeNow func() time.Time) Logf {
+	var (
+		mu     sync.Mutex
+		states = map[string]*spikeState{}
+	)
+	return func(format string, args ...any) {
+		level, msg := splitSeverity(format)
+		if level != Info {
+			ll(level, msg, args...)
+			return
+		}
+
+		now := timeNow()
+		mu.Lock()
+		s := states[format]
+		if s == nil {
+			if len(states) >= maxSpikeFormats {
+				for f, s := range states {
+					if now.Sub(s.start) >= 2*window {
+						delete(states, f)
+					}
+				}
+			}
+			if len(states) >= maxSpikeFormats {
+				// Too many distinct formats in use to track another.
+				mu.Unlock()
+				ll(level, msg, args...)
+				return
+			}
+			s = &spikeState{start: now}
+			states[format] = s
+		}
+		if d := now.Sub(s.start); d >= window {
+			// The previous window is over. If more than a window has
+			// passed, the one just before this line had no lines at all.
+			if s.n < demoteBelow || d >= 2*window {
+				s.promoted = false
+			}
+			s.start, s.n = now, 0
+		}
+		s.n++
+		if s.n >= promoteAt {
+			s.promoted = true
+		}
+		promoted := s.promoted
+		mu.Unlock()
+
+		if promoted {
+			level = Warn
+		}
+		ll(level, msg, args...)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// minCollapsedRun is the shortest run of consecutive integers that
+// CollapseRanges collapses.
+const minCollapsedRun = 5
+
+// CollapseRanges returns a Logf that logs to logf, collapsing each run of
+// at least 5 consecutive increasing integers in a comma-separated list of
+// integers into a range. For example, "acked 1, 2, 3, 4, 5, 6, 9" becomes
+// "acked 1-6, 9". It is intended for debug dumps of packet IDs or ports.
+//
+// The heuristic is conservative: only lists using a consistent separator
+// ("," or ", ") of plain non-negative decimal integers are considered, so
+// IP addresses, versions, negative numbers and non-sequential lists are
+// left intact.
+func CollapseRanges(logf Logf) Logf {
+	return func(format string, args ...any) {
+		msg := fmt.Sprintf(format, args...)
+		if out, ok := collapseRanges(msg); ok {
+			logf("%s", out)
+			return
+		}
+		logf(format, args...)
+	}
+}
+
+// collapseRanges returns s with its runs of consecutive integers collapsed,
+// and reports whether any were.
+func collapseRanges(s string) (string, bool) {
+	var sb strings.Builder
+	changed := false
+	i := 0
+	for i < len(s) {
+		if !isDigit(s[i]) || (i > 0 && !isNumberBoundary(s[i-1], true)) {
+			sb.WriteByte(s[i])
+			i++
+			continue
+		}
+		items, sep, end := scanIntList(s, i)
+		if out, ok := collapseList(items, sep); ok {
+			sb.WriteString(out)
+			changed = true
+		} else {
+			sb.WriteString(s[i:end])
+		}
+		i = end
+	}
+	return sb.String(), changed
+}
+
+// scanIntList scans the list of integers starting at s[start], returning
+// its items, separator, and the index just past it. If the first integer
+// is not cleanly delimited, the list consists of just its digits.
+func scanIntList(s string, start int) (items []string, sep string, end int) {
+	i := start
+	for {
+		j := i
+		for j < len(s) && isDigit(s[j]) {
+			j++
+		}
+		if j < len(s) && !isNumberBoundary(s[j], false) {
+			if len(items) == 0 {
+				// Part of something else, like "1.2.3.4" or "v6";
+				// skip the digits.
+				return nil, "", j
+			}
+			return items, sep, end
+		}
+		items = append(items, s[i:j])
+		end = j
+		next, ok := "", false
+		for _, cand := range []string{", ", ","} {
+			if (sep == "" || sep == cand) && strings.HasPrefix(s[j:], cand) && j+len(cand) < len(s) && isDigit(s[j+len(cand)]) {
+				next, ok = cand, true
+				break
+			}
+		}
+		if !ok {
+			return items, sep, end
+		}
+		sep = next
+		i = j + len(sep)
+	}
+}
+
+// collapseList returns items joined by sep, with runs collapsed, and
+// reports whether any run was collapsed.
+func collapseList(items []string, sep string) (string, bool) {
+	if len(items) < minCollapsedRun {
+		return "", false
+	}
+	nums := make([]int, len(items))
+	for i, it := range items {
+		n, err := strconv.Atoi(it)
+		if err != nil || strconv.Itoa(n) != it {
+			nums[i] = -1 // not plain, such as "007"; never part of a run
+			continue
+		}
+		nums[i] = n
+	}
+	var parts []string
+	changed := false
+	for i := 0; i < len(items); {
+		j := i + 1
+		for nums[i] >= 0 && j < len(items) && nums[j] == nums[j-1]+1 {
+			j++
+		}
+		if j-i >= minCollapsedRun {
+			parts = append(parts, items[i]+"-"+items[j-1])
+			changed = true
+		} else {
+			parts = append(parts, items[i:j]...)
+		}
+		i = j
+	}
+	return strings.Join(parts, sep), changed
+}
+
+func isDigit(b byte) bool { return '0' <= b && b <= '9' }
+
+// isNumberBoundary reports whether b, the byte before (if before) or after
+// an integer, delimits it as a standalone number.
+func isNumberBoundary(b byte, before bool) bool {
+	switch {
+	case isDigit(b), 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', b == '.', b == ':', b == '_':
+		return false
+	case before && b == '-':
+		return false
+	}
+	return true
+}
@@ -0,0 +1,73 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"bytes"
+	"runtime"
+	"strconv"
+	"sync"
+)
+
+// GuardRecursion returns a Logf that logs to logf, but drops any line
+// logged through it from within logf itself on the same goroutine, such
+// as by a sink that accidentally logs via the Logf it is part of, which
+// would otherwise recurse without bound or cause a log storm.
+//
+// The first time a recursive call is dropped, a warning is logged once
+// the outermost call returns.
+//
+// Go has no goroutine-local storage, so each call looks up the ID of the
+// current goroutine, which costs about a microsecond.
+func GuardRecursion(logf Logf) Logf {
+	g := &recursionGuard{active: make(map[uint64]bool)}
+	return func(format string, args ...any) {
+		id := goroutineID()
+		g.mu.Lock()
+		if _, ok := g.active[id]; ok {
+			warn := !g.warned
+			g.warned = true
+			if warn {
+				g.active[id] = true
+			}
+			g.mu.Unlock()
+			return
+		}
+		g.active[id] = false
+		g.mu.Unlock()
+
+		logf(format, args...)
+
+		g.mu.Lock()
+		warn := g.active[id]
+		g.mu.Unlock()
+		if warn {
+			// Still marked active, so that logf logging again is dropped.
+			logf("[unexpected] logger: dropped recursive log call; a sink is logging through its own Logf")
+		}
+
+		g.mu.Lock()
+		delete(g.active, id)
+		g.mu.Unlock()
+	}
+}
+
+type recursionGuard struct {
+	mu     sync.Mutex
+	active map[uint64]bool // goroutines within logf, to whether to warn on return
+	warned bool            // whether a recursive call has been dropped
+}
+
+// goroutineID returns the ID of the current goroutine, as parsed from the
+// header of its stack trace, "goroutine 123 [running]:".
+func goroutineID() uint64 {
+	var buf [64]byte
+	b := buf[:runtime.Stack(buf[:], false)]
+	b = bytes.TrimPrefix(b, []byte("goroutine "))
+	if i := bytes.IndexByte(b, ' '); i >= 0 {
+		b = b[:i]
+	}
+	id, _ := strconv.ParseUint(string(b), 10, 64)
+	return id
+}
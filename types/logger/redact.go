@@ -0,0 +1,108 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// redacted replaces the values of fields redacted by RedactFields.
+const redacted = "[redacted]"
+
+// RedactFields returns a Logf that logs to logf, a structured sink such as
+// Logfmt or GELF, with the values of the fields named names replaced by
+// "[redacted]", and other fields left intact. It covers the key/value
+// pairs of args implementing Fields and the keys of objects, at any depth,
+// in the blob attached by Event. An Event blob that does not marshal as
+// JSON is replaced by "[redacted]" entirely.
+//
+// Matching keys is more reliable than scrubbing the formatted text, but
+// only fields are redacted: the text of the message, including the way
+// each arg formats itself in it, is passed through unmodified.
+func RedactFields(logf Logf, names ...string) Logf {
+	redact := make(map[string]bool, len(names))
+	for _, name := range names {
+		redact[name] = true
+	}
+	return func(format string, args ...any) {
+		var out []any
+		for i, arg := range args {
+			var r any
+			switch a := arg.(type) {
+			case attachment:
+				r = attachment{redactBlob(a.blob, redact)}
+			case Fields:
+				r = redactedFields{a, redact}
+			default:
+				continue
+			}
+			if out == nil {
+				out = append([]any(nil), args...)
+			}
+			out[i] = r
+		}
+		if out == nil {
+			logf(format, args...)
+			return
+		}
+		logf(format, out...)
+	}
+}
+
+// redactedFields is a Fields arg with the values of some keys redacted.
+// It formats as the arg it wraps.
+type redactedFields struct {
+	f      Fields
+	redact map[string]bool
+}
+
+func (r redactedFields) Fields() []any {
+	kvs := append([]any(nil), r.f.Fields()...)
+	for i := 0; i+1 < len(kvs); i += 2 {
+		if r.redact[fmt.Sprint(kvs[i])] {
+			kvs[i+1] = redacted
+		}
+	}
+	return kvs
+}
+
+func (r redactedFields) Format(s fmt.State, verb rune) {
+	fmt.Fprintf(s, fmt.FormatString(s, verb), r.f)
+}
+
+// redactBlob returns blob, as decoded from its JSON, with the values of
+// the object keys in redact replaced.
+func redactBlob(blob any, redact map[string]bool) any {
+	b, err := json.Marshal(blob)
+	if err != nil {
+		return redacted
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber() // keep numbers as written
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return redacted
+	}
+	return redactJSON(v, redact)
+}
+
+func redactJSON(v any, redact map[string]bool) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, e := range v {
+			if redact[k] {
+				v[k] = redacted
+			} else {
+				v[k] = redactJSON(e, redact)
+			}
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = redactJSON(e, redact)
+		}
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LogStats describes the state of a logger, for debug endpoints.
+type LogStats struct {
+	Level       Level // minimum level logged
+	Emitted     int64 // lines passed on to the underlying sink
+	Dropped     int64 // lines dropped by filtering or rate limiting
+	RateLimited bool  // whether the logger is currently dropping due to rate limits
+}
+
+// StatsSource is implemented by loggers that can report their LogStats.
+type StatsSource interface {
+	LogStats() LogStats
+}
+
+// NamedLogStats is a LogStats with the name its logger was registered as.
+type NamedLogStats struct {
+	Name string
+	LogStats
+}
+
+// A Registry is a set of named loggers, so that debug endpoints can
+// enumerate them. The zero value is an empty Registry ready to use.
+type Registry struct {
+	mu      sync.Mutex
+	sources map[string]*registration
+}
+
+// registration is a StatsSource registered with a Registry. Its address
+// identifies the registration, so that an unregister func removes only
+// its own, without comparing StatsSources, which may not be comparable.
+type registration struct {
+	src StatsSource
+}
+
+// DefaultRegistry is the Registry that subsystems register with.
+var DefaultRegistry = new(Registry)
+
+// Register adds src to r as name, and returns a func that removes it.
+//
+// Names need not be unique: if name is already registered, src is
+// registered as "name#2", or "name#3", and so on, so that multiple
+// instances of a subsystem (as in tests) can coexist.
+func (r *Registry) Register(name string, src StatsSource) (unregister func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sources == nil {
+		r.sources = make(map[string]*registration)
+	}
+	unique := name
+	for i := 2; r.sources[unique] != nil; i++ {
+		unique = name + "#" + strconv.Itoa(i)
+	}
+	reg := &registration{src}
+	r.sources[unique] = reg
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.sources[unique] == reg {
+			delete(r.sources, unique)
+		}
+	}
+}
+
+// Snapshot returns the current LogStats of every logger in r,
+// sorted by name.
+func (r *Registry) Snapshot() []NamedLogStats {
+	type entry struct {
+		name string
+		src  StatsSource
+	}
+	r.mu.Lock()
+	entries := make([]entry, 0, len(r.sources))
+	for name, reg := range r.sources {
+		entries = append(entries, entry{name, reg.src})
+	}
+	r.mu.Unlock() // release before calling into the sources
+
+	ret := make([]NamedLogStats, len(entries))
+	for i, e := range entries {
+		ret[i] = NamedLogStats{Name: e.name, LogStats: e.src.LogStats()}
+	}
+	slices.SortFunc(ret, func(a, b NamedLogStats) int { return strings.Compare(a.Name, b.Name) })
+	return ret
+}
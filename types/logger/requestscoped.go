@@ -0,0 +1,63 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// maxRequestScopedLines is the number of lines RequestScoped buffers
+// before flushing early, bounding the memory used by a long operation.
+const maxRequestScopedLines = 1000
+
+// RequestScoped returns a Logf that buffers the lines logged to it, and a
+// flush func that logs them all to logf in one call, each preceded by
+// prefix and separated by newlines, so that the lines of one logical
+// operation stay together instead of interleaving with those of concurrent
+// operations. It is intended for request handlers, which should call flush
+// when the request completes or fails.
+//
+// The buffer is also flushed when ctx is done, and whenever it holds
+// 1000 lines. Lines logged after a flush are buffered for the next one.
+// Calling flush with nothing buffered does nothing.
+func RequestScoped(ctx context.Context, logf Logf, prefix string) (buffered Logf, flush func()) {
+	var (
+		mu    sync.Mutex
+		lines []string
+	)
+	flushLocked := func() {
+		if len(lines) == 0 {
+			return
+		}
+		var sb strings.Builder
+		for i, line := range lines {
+			if i > 0 {
+				sb.WriteByte('\n')
+			}
+			sb.WriteString(prefix)
+			sb.WriteString(strings.TrimSuffix(line, "\n"))
+		}
+		lines = lines[:0]
+		logf("%s", sb.String())
+	}
+	flush = func() {
+		mu.Lock()
+		defer mu.Unlock()
+		flushLocked()
+	}
+	context.AfterFunc(ctx, flush)
+	buffered = func(format string, args ...any) {
+		line := fmt.Sprintf(format, args...)
+		mu.Lock()
+		defer mu.Unlock()
+		lines = append(lines, line)
+		if len(lines) >= maxRequestScopedLines {
+			flushLocked()
+		}
+	}
+	return buffered, flush
+}
@@ -0,0 +1,46 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"sync"
+	"time"
+)
+
+// AdaptiveSampling returns a LevelLogf that writes to sink only one in
+// every normal Debug messages, except within burstWindow after an Error
+// message, when every Debug message is written. This gives full detail
+// around errors without the constant volume of full verbose logging.
+//
+// Messages at Info and above are always written. If normal is less than
+// one, every message is written.
+func AdaptiveSampling(sink Logf, normal int, burstWindow time.Duration) LevelLogf {
+	return adaptiveSampling(sink, normal, burstWindow, time.Now)
+}
+
+func adaptiveSampling(sink Logf, normal int, burstWindow time.Duration, timeNow func() time.Time) LevelLogf {
+	var (
+		mu       sync.Mutex
+		n        int       // Debug messages seen since the last one written
+		burstEnd time.Time // end of the full-verbosity window
+	)
+	return func(level Level, format string, args ...any) {
+		if level == Debug && normal > 1 {
+			mu.Lock()
+			write := timeNow().Before(burstEnd) || n == 0
+			if n++; n == normal {
+				n = 0
+			}
+			mu.Unlock()
+			if !write {
+				return
+			}
+		} else if level >= Error {
+			mu.Lock()
+			burstEnd = timeNow().Add(burstWindow)
+			mu.Unlock()
+		}
+		sink(format, args...)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Schemas of the records written by the structured sinks, mapping each
+// field to its type, for their header records.
+var (
+	logfmtSchema = map[string]string{
+		"time":       "timestamp", // RFC 3339, UTC
+		"level":      "string",    // debug, info, warn or error
+		"msg":        "string",
+		"attachment": "json", // optional; see Event
+	}
+	gelfSchema = map[string]string{
+		"version":       "string",
+		"host":          "string",
+		"short_message": "string",
+		"timestamp":     "number", // seconds since the Unix epoch
+		"level":         "number", // syslog severity
+		"_attachment":   "json",   // optional; see Event
+	}
+)
+
+// LogfmtWithSchema is like Logfmt, but precedes the first record it
+// writes to w with a header record describing the fields of its records
+// and their types, for log consumers that configure their parsing from
+// it. The header is a record with msg "log schema", whose attachment, as
+// for Event, is a JSON object mapping field names to types:
+//
+//	time=... level=info msg="log schema" attachment="{\"attachment\":\"json\",\"level\":\"string\",...}"
+//
+// Keys from Fields args are not listed. When w is rotated, such as to a
+// new file, call rotated, and the header is written again before the
+// next record.
+func LogfmtWithSchema(w io.Writer) (logf Logf, rotated func()) {
+	return withSchema(logfmt(w, time.Now), logfmtSchema)
+}
+
+// GELFWithSchema is like GELF, but precedes the first message it writes
+// to w, and the first after each call to rotated, with a header message
+// describing its fields, as for LogfmtWithSchema, with short_message
+// "log schema" and the schema in _attachment.
+func GELFWithSchema(w io.Writer, host string) (logf Logf, rotated func()) {
+	return withSchema(gelf(w, host, time.Now), gelfSchema)
+}
+
+// withSchema returns a Logf that logs to sink, preceded by a header
+// record of schema when it starts and after rotated is called.
+func withSchema(sink Logf, schema map[string]string) (Logf, func()) {
+	var (
+		mu      sync.Mutex
+		pending = true // whether a header is due before the next record
+	)
+	logf := func(format string, args ...any) {
+		mu.Lock()
+		if pending {
+			pending = false
+			Event(sink, "log schema", schema)
+		}
+		mu.Unlock()
+		sink(format, args...)
+	}
+	rotated := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		pending = true
+	}
+	return logf, rotated
+}
@@ -0,0 +1,121 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import "strings"
+
+// severityMarkers maps the bracketed markers used by convention at the
+// start of log lines to the Level they imply.
+var severityMarkers = []struct {
+	marker string
+	level  Level
+}{
+	{"[v1] ", Debug},
+	{"[v2] ", Debug},
+	{"[unexpected] ", Warn},
+	{"[warning] ", Warn},
+	{"[error] ", Error},
+}
+
+// Normalize returns a Logf that renders each line as "<SEVERITY> message",
+// where SEVERITY is one of DEBUG, INFO, WARN, or ERROR, and passes it, with
+// its Level, to ll. It is intended to sit just before a final sink whose
+// parser requires every line to begin with a single uppercase severity token.
+//
+// The severity is derived from a conventional marker such as "[v1] " or
+// "[unexpected] " at the start of the line, or just after a leading
+// subsystem prefix like "wg: ", and the marker is removed. Lines without a
+// marker are INFO.
+func Normalize(ll LevelLogf) Logf {
+	return func(format string, args ...any) {
+		level, format := splitSeverity(format)
+		ll(level, severityToken(level)+" "+format, args...)
+	}
+}
+
+// Leveled returns a Logf that passes each line to ll with the Level
+// implied by its marker, as for Normalize, and with the marker removed
+// but without adding a severity token. It is for sinks such as syslog
+// that record severity out-of-band.
+func Leveled(ll LevelLogf) Logf {
+	return func(format string, args ...any) {
+		level, format := splitSeverity(format)
+		ll(level, format, args...)
+	}
+}
+
+// splitSeverity returns the Level implied by format's marker, if any,
+// and format with the marker removed.
+func splitSeverity(format string) (Level, string) {
+	level, start, end, ok := findSeverity(format)
+	if !ok {
+		return Info, format
+	}
+	return level, format[:start] + format[end:]
+}
+
+// findSeverity returns the Level implied by format's marker and the
+// marker's position in format, or ok false if it has none.
+func findSeverity(format string) (level Level, start, end int, ok bool) {
+	if i := strings.Index(format, ": ["); i > 0 && !strings.ContainsAny(format[:i], " []") {
+		start = i + 2
+	}
+	for _, m := range severityMarkers {
+		if strings.HasPrefix(format[start:], m.marker) {
+			return m.level, start, start + len(m.marker), true
+		}
+	}
+	return Info, 0, 0, false
+}
+
+// severityToken returns the uppercase token for l used by Normalize.
+// Levels other than the four named ones are rendered as the nearest one.
+func severityToken(l Level) string {
+	switch {
+	case l <= Debug:
+		return "DEBUG"
+	case l == Info:
+		return "INFO"
+	case l == Warn:
+		return "WARN"
+	}
+	return "ERROR"
+}
+
+// StripPrefixes returns a Logf that removes the first of prefixes that
+// the format starts with, if any, before logging to logf. It is for sinks
+// that record severity out-of-band, where inline tags like "[v2] " are
+// clutter. Lines without any of the prefixes are passed through unchanged.
+func StripPrefixes(logf Logf, prefixes ...string) Logf {
+	return StripPrefixesLeveled(func(_ Level, format string, args ...any) {
+		logf(format, args...)
+	}, prefixes...)
+}
+
+// StripPrefixesLeveled is like StripPrefixes, but logs to ll with the
+// Level implied by the stripped prefix: Debug for "[v1] " and "[v2] ",
+// and so on, as for Normalize. Lines whose prefix implies no level, or
+// that have no prefix, are logged at Info.
+func StripPrefixesLeveled(ll LevelLogf, prefixes ...string) Logf {
+	return func(format string, args ...any) {
+		for _, p := range prefixes {
+			if after, ok := strings.CutPrefix(format, p); ok {
+				ll(prefixLevel(p), after, args...)
+				return
+			}
+		}
+		ll(Info, format, args...)
+	}
+}
+
+// prefixLevel returns the Level implied by the severity marker prefix,
+// or Info if it is not one.
+func prefixLevel(prefix string) Level {
+	for _, m := range severityMarkers {
+		if m.marker == prefix {
+			return m.level
+		}
+	}
+	return Info
+}
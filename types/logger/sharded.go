@@ -0,0 +1,39 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+// Sharded returns a Logf that logs each message to one of sinks, chosen by
+// key(format, args) modulo len(sinks), so that volume is spread across the
+// sinks while all messages with the same key, such as those about one peer,
+// go to the same sink in order. If key is nil, messages are keyed by a hash
+// of their format string, which is stable across processes.
+//
+// key must not retain args. It panics if sinks is empty.
+func Sharded(sinks []Logf, key func(format string, args []any) uint64) Logf {
+	if len(sinks) == 0 {
+		panic("logger.Sharded: no sinks")
+	}
+	if key == nil {
+		key = formatKey
+	}
+	return func(format string, args ...any) {
+		sinks[key(format, args)%uint64(len(sinks))](format, args...)
+	}
+}
+
+// formatKey is Sharded's default key, a 64-bit FNV-1a hash of the format
+// string. It is computed here rather than with hash/fnv, which this package
+// does not otherwise depend on.
+func formatKey(format string, _ []any) uint64 {
+	const (
+		offset64 = 14695981039346656037
+		prime64  = 1099511628211
+	)
+	h := uint64(offset64)
+	for i := range len(format) {
+		h ^= uint64(format[i])
+		h *= prime64
+	}
+	return h
+}
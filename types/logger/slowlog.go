@@ -0,0 +1,49 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"time"
+)
+
+// SlowLog returns a func that brackets an operation, like a database's
+// slow query log: call it with a printf-style summary of the operation
+// when the operation starts, and call the func it returns when the
+// operation ends. The summary is then logged with the operation's
+// duration, as "<summary> took 12ms", to normal if the operation took
+// less than threshold, and otherwise to slow, with timing detail, as
+// "<summary> took 2.5s (threshold 1s, started 15:04:05.000)", so that
+// latency outliers can be isolated:
+//
+//	start := logger.SlowLog(logf, slowf, time.Second)
+//	...
+//	done := start("wgengine: Reconfig of %d peers", n)
+//	...
+//	done()
+//
+// The summary is formatted when it is logged, so its args must not
+// change in between. Calling done more than once has no effect.
+func SlowLog(normal, slow Logf, threshold time.Duration) func(format string, args ...any) (done func()) {
+	return slowLog(normal, slow, threshold, time.Now)
+}
+
+func slowLog(normal, slow Logf, threshold time.Duration, timeNow func() time.Time) func(string, ...any) func() {
+	return func(format string, args ...any) func() {
+		start := timeNow()
+		var done bool
+		return func() {
+			if done {
+				return
+			}
+			done = true
+			d := timeNow().Sub(start)
+			args := append(args[:len(args):len(args)], d.Round(time.Microsecond))
+			if d < threshold {
+				normal(format+" took %v", args...)
+				return
+			}
+			slow(format+" took %v (threshold %v, started %s)", append(args, threshold, start.Format("15:04:05.000"))...)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A SpecWrapper builds the stage of a BuildFromSpec pipeline it is
+// registered as, wrapping logf, from the stage's params.
+type SpecWrapper func(logf Logf, params []string) (Logf, error)
+
+var (
+	specMu       sync.Mutex
+	specWrappers = map[string]SpecWrapper{
+		"prefix":      specPrefix,
+		"ratelimit":   specRateLimit,
+		"once":        specNoParams(Once),
+		"serialized":  specNoParams(Serialized),
+		"multiline":   specNoParams(JoinMultiline),
+		"errordetail": specNoParams(WithErrorDetail),
+		"json":        specNoParams(toJSONLines),
+		"logfmt":      specNoParams(func(logf Logf) Logf { return Logfmt(FuncWriter(logf)) }),
+		"gelf":        specGELF,
+	}
+)
+
+// RegisterSpecWrapper registers build as the stage named name for
+// BuildFromSpec. It panics if name is already registered or contains
+// one of the separators ":", "," or "|".
+func RegisterSpecWrapper(name string, build SpecWrapper) {
+	if name == "" || strings.ContainsAny(name, ":,|") {
+		panic(fmt.Sprintf("logger: invalid spec wrapper name %q", name))
+	}
+	specMu.Lock()
+	defer specMu.Unlock()
+	if _, ok := specWrappers[name]; ok {
+		panic(fmt.Sprintf("logger: spec wrapper %q already registered", name))
+	}
+	specWrappers[name] = build
+}
+
+// BuildFromSpec returns a Logf that logs to sink through the pipeline of
+// wrappers described by spec, so that logging can be tuned from a config
+// file without code changes. For example,
+//
+//	prefix:wg|ratelimit:1s,10|json
+//
+// prefixes each line with "wg: ", then rate limits it, then renders it as
+// JSON for sink. Stages are separated by "|" and apply in order, the first
+// seeing each line first. A stage is a wrapper name, optionally followed by
+// ":" and its comma-separated params. The built-in wrappers are:
+//
+//   - prefix:P, which prefixes lines with "P: ", as WithPrefix
+//   - ratelimit:D,N[,M], which allows a line every D in bursts of N per
+//     format, tracking up to M formats (default 100), as RateLimitedFn
+//   - once, as Once
+//   - serialized, as Serialized
+//   - multiline, as JoinMultiline
+//   - errordetail, as WithErrorDetail
+//   - json, which renders each line as {"level":"info","msg":"..."},
+//     with the level taken from its severity marker, as for Normalize
+//   - logfmt, as Logfmt
+//   - gelf:HOST, as GELF
+//
+// Others can be added with RegisterSpecWrapper. An empty spec returns
+// sink. It returns an error for unknown wrappers and invalid params.
+func BuildFromSpec(spec string, sink Logf) (Logf, error) {
+	if spec == "" {
+		return sink, nil
+	}
+	type stage struct {
+		build  SpecWrapper
+		params []string
+	}
+	var stages []stage
+	specMu.Lock()
+	for i, s := range strings.Split(spec, "|") {
+		name, params, hasParams := strings.Cut(strings.TrimSpace(s), ":")
+		build, ok := specWrappers[name]
+		if !ok {
+			specMu.Unlock()
+			return nil, fmt.Errorf("logger: spec stage %d: unknown wrapper %q", i+1, name)
+		}
+		st := stage{build: build}
+		if hasParams {
+			st.params = strings.Split(params, ",")
+		}
+		stages = append(stages, st)
+	}
+	specMu.Unlock()
+
+	logf := sink
+	for i := len(stages) - 1; i >= 0; i-- {
+		var err error
+		if logf, err = stages[i].build(logf, stages[i].params); err != nil {
+			return nil, fmt.Errorf("logger: spec stage %d: %w", i+1, err)
+		}
+	}
+	return logf, nil
+}
+
+// specNoParams returns a SpecWrapper for wrap, which takes no params.
+func specNoParams(wrap func(Logf) Logf) SpecWrapper {
+	return func(logf Logf, params []string) (Logf, error) {
+		if len(params) > 0 {
+			return nil, fmt.Errorf("unexpected params %q", params)
+		}
+		return wrap(logf), nil
+	}
+}
+
+func specPrefix(logf Logf, params []string) (Logf, error) {
+	if len(params) != 1 || params[0] == "" {
+		return nil, fmt.Errorf("prefix: want 1 non-empty param, got %q", params)
+	}
+	return WithPrefix(logf, params[0]+": "), nil
+}
+
+func specRateLimit(logf Logf, params []string) (Logf, error) {
+	if len(params) != 2 && len(params) != 3 {
+		return nil, fmt.Errorf("ratelimit: want 2 or 3 params, got %q", params)
+	}
+	d, err := time.ParseDuration(params[0])
+	if err != nil || d <= 0 {
+		return nil, fmt.Errorf("ratelimit: invalid interval %q", params[0])
+	}
+	burst, err := strconv.Atoi(params[1])
+	if err != nil || burst < 1 {
+		return nil, fmt.Errorf("ratelimit: invalid burst %q", params[1])
+	}
+	maxCache := 100
+	if len(params) == 3 {
+		if maxCache, err = strconv.Atoi(params[2]); err != nil || maxCache < 1 {
+			return nil, fmt.Errorf("ratelimit: invalid max formats %q", params[2])
+		}
+	}
+	return RateLimitedFn(logf, d, burst, maxCache), nil
+}
+
+func specGELF(logf Logf, params []string) (Logf, error) {
+	if len(params) != 1 || params[0] == "" {
+		return nil, fmt.Errorf("gelf: want 1 non-empty param, got %q", params)
+	}
+	return GELF(FuncWriter(logf), params[0]), nil
+}
+
+// toJSONLines returns a Logf that logs each message to logf as a JSON
+// object with its level and message, for the "json" spec wrapper.
+func toJSONLines(logf Logf) Logf {
+	return func(format string, args ...any) {
+		// Find the marker in the formatted message, as earlier stages
+		// like once may have already formatted it.
+		level, msg := splitSeverity(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+		b, err := json.Marshal(struct {
+			Level string `json:"level"`
+			Msg   string `json:"msg"`
+		}{level.String(), msg})
+		if err != nil {
+			return // not reached; strings always marshal
+		}
+		logf("%s", b)
+	}
+}
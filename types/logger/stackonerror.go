@@ -0,0 +1,45 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithStackOnError wraps logf so that error-level lines, those with an
+// "[error] " marker as recognized by Normalize, have the logging
+// goroutine's stack appended as " stack=...", as for WithErrorDetail, but
+// at most one line each every, so that errors get occasional deep context
+// without the cost of capturing a stack each time. Other lines, and error
+// lines in between, are passed through unmodified.
+func WithStackOnError(logf Logf, every time.Duration) Logf {
+	return withStackOnError(logf, every, time.Now)
+}
+
+func withStackOnError(logf Logf, every time.Duration, timeNow func() time.Time) Logf {
+	var (
+		mu sync.Mutex
+		tb = newTokenBucket(every, 1, timeNow())
+	)
+	return func(format string, args ...any) {
+		if level, _, _, ok := findSeverity(format); !ok || level < Error {
+			logf(format, args...)
+			return
+		}
+		mu.Lock()
+		tb.AdvanceTo(timeNow())
+		ok := tb.Get()
+		mu.Unlock()
+		if !ok {
+			logf(format, args...)
+			return
+		}
+		stack := strconv.Quote(strings.TrimSuffix(string(debug.Stack()), "\n"))
+		logf(format+" stack=%s", append(args[:len(args):len(args)], stack)...)
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+)
+
+// Structured is implemented by prebuilt log messages, for callers that
+// would rather pass a message value than a printf format. Log one with
+// LogStructured, and receive it with StructuredSink.
+type Structured interface {
+	// LogFormat returns the message as a printf format and args. The
+	// format identifies the kind of message, like "peer %v connected",
+	// and should be the same for all messages of a kind, as wrappers
+	// such as RateLimitedFn key on it. It may start with a severity
+	// marker like "[v1] ", which Leveled and Normalize read as usual.
+	LogFormat() (format string, args []any)
+}
+
+// LogStructured logs m to logf, as its LogFormat, so that it passes
+// through the usual Logf wrappers, such as RateLimitedFn, DedupByKey and
+// Leveled, just as a printf-style line would. A StructuredSink at the end
+// of the chain receives m itself. If m implements Fields, structured
+// sinks such as Logfmt log its fields.
+func LogStructured(logf Logf, m Structured) {
+	format, args := m.LogFormat()
+	logf(format+"%v", append(args[:len(args):len(args)], structuredArg{m})...)
+}
+
+// structuredArg carries a Structured message alongside its LogFormat
+// args. It formats as nothing.
+type structuredArg struct{ m Structured }
+
+func (structuredArg) Format(fmt.State, rune) {}
+
+func (a structuredArg) Fields() []any {
+	if f, ok := a.m.(Fields); ok {
+		return f.Fields()
+	}
+	return nil
+}
+
+// A Message is a line received by a StructuredSink.
+type Message struct {
+	// Format and Args are the line as logged, including any changes
+	// made by wrappers along the way, such as a prefix. For a Structured
+	// message, Args include an arg that formats as nothing in its place.
+	Format string
+	Args   []any
+
+	// Structured is the message itself, if the line was logged with
+	// LogStructured, or nil for a printf-style line.
+	Structured Structured
+}
+
+// LogFormat returns m's Format and Args.
+func (m Message) LogFormat() (string, []any) { return m.Format, m.Args }
+
+// String returns the line as formatted text.
+func (m Message) String() string { return fmt.Sprintf(m.Format, m.Args...) }
+
+// StructuredSink returns a Logf that passes each line logged to it to
+// sink as a Message, so that sink accepts both printf-style lines and
+// Structured messages logged with LogStructured, even from callers, such
+// as wglog, that only log printf-style.
+func StructuredSink(sink func(Message)) Logf {
+	return func(format string, args ...any) {
+		msg := Message{Format: format, Args: args}
+		for _, arg := range args {
+			if a, ok := arg.(structuredArg); ok {
+				msg.Structured = a.m
+				break
+			}
+		}
+		sink(msg)
+	}
+}
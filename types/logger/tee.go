@@ -0,0 +1,38 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"strconv"
+	"sync/atomic"
+)
+
+// Tee returns a Logf that logs each line to every one of sinks, in order.
+func Tee(sinks ...Logf) Logf {
+	return func(format string, args ...any) {
+		for _, logf := range sinks {
+			logf(format, args...)
+		}
+	}
+}
+
+// TeeWithRecordIDs is like Tee, but stamps each line with a record ID,
+// like "[rec#42] ", that is the same in every sink's copy of it, so that
+// the sinks' outputs can be correlated after the fact. IDs start at 1 and
+// increase by one with each line logged through the returned Logf.
+//
+// The ID is inserted after the line's severity marker, if any, as in
+// "wg: [v1] [rec#42] ...", so that sinks still see the line's level.
+// Lines without a marker start with the ID.
+func TeeWithRecordIDs(sinks ...Logf) Logf {
+	var lastID atomic.Uint64
+	return func(format string, args ...any) {
+		_, _, end, _ := findSeverity(format)
+		id := "[rec#" + strconv.FormatUint(lastID.Add(1), 10) + "] "
+		format = format[:end] + id + format[end:]
+		for _, logf := range sinks {
+			logf(format, args...)
+		}
+	}
+}
@@ -34,6 +34,31 @@ func newTokenBucket(tick time.Duration, max int, now time.Time) *tokenBucket {
 	return &tokenBucket{max, max, tick, now}
 }
 
+// BucketState is the state of a rate limiter's token bucket,
+// which can be used to recreate the bucket without granting it
+// a fresh full burst.
+type BucketState struct {
+	Remaining int       // tokens available
+	Time      time.Time // time up to which refills have been accounted for
+}
+
+// newTokenBucketFromState returns a token bucket with the given tick and max,
+// resuming from st. st.Remaining is clamped to [0, max].
+func newTokenBucketFromState(tick time.Duration, max int, st BucketState) *tokenBucket {
+	remaining := st.Remaining
+	if remaining < 0 {
+		remaining = 0
+	} else if remaining > max {
+		remaining = max
+	}
+	return &tokenBucket{remaining, max, tick, st.Time}
+}
+
+// Snapshot returns tb's current state.
+func (tb *tokenBucket) Snapshot() BucketState {
+	return BucketState{Remaining: tb.remaining, Time: tb.t}
+}
+
 func (tb *tokenBucket) Get() bool {
 	if tb.remaining > 0 {
 		tb.remaining--
@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketSnapshot(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tb := newTokenBucket(time.Second, 5, start)
+	for range 4 {
+		tb.Get()
+	}
+	tb.AdvanceTo(start.Add(1500 * time.Millisecond)) // one whole tick
+
+	st := tb.Snapshot()
+	if want := (BucketState{Remaining: 2, Time: start.Add(time.Second)}); st != want {
+		t.Fatalf("Snapshot = %+v; want %+v", st, want)
+	}
+	restored := newTokenBucketFromState(time.Second, 5, st)
+
+	// Both buckets should now behave identically.
+	now := start.Add(1500 * time.Millisecond)
+	for i := range 10 {
+		if i == 6 {
+			now = now.Add(1600 * time.Millisecond)
+		}
+		tb.AdvanceTo(now)
+		restored.AdvanceTo(now)
+		if got, want := restored.Get(), tb.Get(); got != want {
+			t.Fatalf("Get #%d = %v; want %v", i, got, want)
+		}
+	}
+
+	if got := newTokenBucketFromState(time.Second, 5, BucketState{Remaining: 10}).remaining; got != 5 {
+		t.Errorf("restored remaining = %d; want clamped to 5", got)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"context"
+	"strings"
+
+	"tailscale.com/util/ctxkey"
+)
+
+// TraceParentKey is the context key for the W3C Trace Context
+// "traceparent" header value of the current request, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+// It is read by WithTraceID.
+var TraceParentKey = ctxkey.New("logger.TraceParent", "")
+
+// WithTraceID returns a Logf that prefixes each line logged to logf with
+// "trace=<id> ", where id is the trace ID of the traceparent stored in ctx
+// under TraceParentKey, so that logs can be correlated with spans in a
+// tracing backend. If ctx has no valid traceparent, it returns logf.
+func WithTraceID(ctx context.Context, logf Logf) Logf {
+	id, ok := parseTraceID(TraceParentKey.Value(ctx))
+	if !ok {
+		return logf
+	}
+	return WithPrefix(logf, "trace="+id+" ")
+}
+
+// parseTraceID returns the trace ID of the W3C traceparent header value
+// tp, which has the form "version-traceid-parentid-flags".
+func parseTraceID(tp string) (id string, ok bool) {
+	parts := strings.Split(tp, "-")
+	if len(parts) < 4 {
+		return "", false
+	}
+	version, id, parent, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" || !isLowerHex(version) ||
+		len(id) != 32 || !isLowerHex(id) || strings.Trim(id, "0") == "" ||
+		len(parent) != 16 || !isLowerHex(parent) || strings.Trim(parent, "0") == "" ||
+		len(flags) != 2 || !isLowerHex(flags) {
+		return "", false
+	}
+	if version == "00" && len(parts) != 4 {
+		// Only future versions may append fields.
+		return "", false
+	}
+	return id, true
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range []byte(s) {
+		if !isDigit(c) && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,22 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import "fmt"
+
+// Transform returns a Logf that formats each message, passes it through
+// fn, and logs the result to logf, for one-off redaction, relabeling or
+// reformatting that doesn't merit a dedicated wrapper.
+//
+// Each message is formatted once, here, so the sink only sees the
+// transformed string, logged as "%s". This forgoes the benefits of
+// deferred formatting: every line pays for formatting even if logf would
+// have dropped it, and wrappers after it that inspect the format string
+// or args, such as rate limiters keyed by format, see only "%s".
+// Prefer placing Transform as close to the sink as possible.
+func Transform(logf Logf, fn func(msg string) string) Logf {
+	return func(format string, args ...any) {
+		logf("%s", fn(fmt.Sprintf(format, args...)))
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// webhookQueueLen is the number of messages WithWebhook queues for post
+// before dropping new ones.
+const webhookQueueLen = 64
+
+// WithWebhook returns a Logf that logs to logf and also passes each
+// formatted message whose format satisfies match to post, such as to
+// deliver critical events like auth failures to an alerting webhook.
+//
+// post is called asynchronously, one message at a time and in order, so
+// a slow webhook never blocks logging. Up to 64 messages are queued while
+// post is busy; beyond that new messages are dropped, and the number
+// dropped is logged to logf once the queue has room again. No goroutine
+// runs while the queue is empty.
+func WithWebhook(logf Logf, match func(format string) bool, post func(msg string)) Logf {
+	w := &webhook{logf: logf, post: post}
+	return func(format string, args ...any) {
+		logf(format, args...)
+		if match(format) {
+			w.enqueue(strings.TrimSuffix(fmt.Sprintf(format, args...), "\n"))
+		}
+	}
+}
+
+type webhook struct {
+	logf Logf
+	post func(msg string)
+
+	mu      sync.Mutex
+	queue   []string // messages awaiting post
+	running bool     // whether a goroutine is draining queue
+	dropped int      // messages dropped since the last drop report
+}
+
+func (w *webhook) enqueue(msg string) {
+	w.mu.Lock()
+	if len(w.queue) >= webhookQueueLen {
+		w.dropped++
+		w.mu.Unlock()
+		return
+	}
+	dropped := w.dropped
+	w.dropped = 0
+	w.queue = append(w.queue, msg)
+	start := !w.running
+	w.running = true
+	w.mu.Unlock()
+
+	if dropped > 0 {
+		w.logf("[unexpected] webhook: queue full; dropped %d messages", dropped)
+	}
+	if start {
+		go w.drain()
+	}
+}
+
+// drain posts queued messages until the queue is empty.
+func (w *webhook) drain() {
+	for {
+		w.mu.Lock()
+		if len(w.queue) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		msg := w.queue[0]
+		w.queue = w.queue[1:]
+		w.mu.Unlock()
+		w.post(msg)
+	}
+}
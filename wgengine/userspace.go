@@ -103,6 +103,7 @@ type userspaceEngine struct {
 	health           *health.Tracker
 	netMonOwned      bool                // whether we created netMon (and thus need to close it)
 	netMonUnregister func()              // unsubscribes from changes; used regardless of netMonOwned
+	wgLogUnregister  func()              // removes wgLogger from logger.DefaultRegistry
 	birdClient       BIRDClient          // or nil
 	controlKnobs     *controlknobs.Knobs // or nil
 
@@ -418,6 +419,8 @@ func NewUserspaceEngine(logf logger.Logf, conf Config) (_ Engine, reterr error)
 	}
 
 	e.wgLogger = wglog.NewLogger(logf)
+	e.wgLogUnregister = logger.DefaultRegistry.Register("wireguard", e.wgLogger)
+	closePool.addFunc(e.wgLogUnregister)
 	e.tundev.OnTSMPPongReceived = func(pong packet.TSMPPongReply) {
 		e.mu.Lock()
 		defer e.mu.Unlock()
@@ -761,7 +764,7 @@ func (e *userspaceEngine) maybeReconfigWireguardLocked(discoChanged map[key.Node
 		}
 	}
 
-	e.logf("wgengine: Reconfig: configuring userspace WireGuard config (with %d/%d peers)", len(min.Peers), len(full.Peers))
+	e.logf("wgengine: Reconfig: configuring userspace WireGuard config (with %d/%d peers, ~%d KiB)", len(min.Peers), len(full.Peers), full.ApproxSize()/1024)
 	if err := wgcfg.ReconfigDevice(e.wgdev, &min, e.logf); err != nil {
 		e.logf("wgdev.Reconfig: %v", err)
 		return err
@@ -1170,12 +1173,16 @@ func (e *userspaceEngine) Close() {
 	e.wgdev.IpcSetOperation(r)
 	e.magicConn.Close()
 	e.netMonUnregister()
+	e.wgLogUnregister()
 	if e.netMonOwned {
 		e.netMon.Close()
 	}
 	e.dns.Down()
 	e.router.Close()
 	e.wgdev.Close()
+	e.wgLock.Lock()
+	e.lastCfgFull.ZeroizePresharedKeys()
+	e.wgLock.Unlock()
 	e.tundev.Close()
 	if e.birdClient != nil {
 		e.birdClient.DisableProtocol("tailscale")
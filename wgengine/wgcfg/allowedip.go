@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// An AllowedIP is one of a peer's AllowedIPs with its metric, which
+// expresses a preference between peers routing the same prefix.
+type AllowedIP struct {
+	Prefix netip.Prefix
+	Metric uint32 // lower is preferred; 0 is the default
+}
+
+// AllowedIPFromPrefix returns the AllowedIP for pfx with the default metric.
+func AllowedIPFromPrefix(pfx netip.Prefix) AllowedIP {
+	return AllowedIP{Prefix: pfx}
+}
+
+// String returns a like "10.0.0.0/8", or "10.0.0.0/8 metric 5" if it has
+// a non-default metric.
+func (a AllowedIP) String() string {
+	if a.Metric == 0 {
+		return a.Prefix.String()
+	}
+	return fmt.Sprintf("%v metric %d", a.Prefix, a.Metric)
+}
+
+// allowedIPJSON is the JSON form of an AllowedIP with a non-default metric.
+type allowedIPJSON struct {
+	Prefix netip.Prefix
+	Metric uint32
+}
+
+// MarshalJSON implements json.Marshaler. An AllowedIP with the default
+// metric is encoded as its prefix alone, like "10.0.0.0/8", and others as
+// an object, like {"Prefix":"10.0.0.0/8","Metric":5}.
+func (a AllowedIP) MarshalJSON() ([]byte, error) {
+	if a.Metric == 0 {
+		return json.Marshal(a.Prefix)
+	}
+	return json.Marshal(allowedIPJSON(a))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts either of the
+// forms written by MarshalJSON, so that existing JSON with plain prefixes
+// can be read as AllowedIPs.
+func (a *AllowedIP) UnmarshalJSON(b []byte) error {
+	if b = bytes.TrimSpace(b); len(b) > 0 && b[0] == '"' {
+		*a = AllowedIP{}
+		return json.Unmarshal(b, &a.Prefix)
+	}
+	var j allowedIPJSON
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	*a = AllowedIP(j)
+	return nil
+}
+
+// AllowedIPsWithMetrics returns p's AllowedIPs, in order, with their
+// metrics from p.AllowedIPMetrics.
+func (p *Peer) AllowedIPsWithMetrics() []AllowedIP {
+	ret := make([]AllowedIP, len(p.AllowedIPs))
+	for i, pfx := range p.AllowedIPs {
+		ret[i] = AllowedIP{Prefix: pfx, Metric: p.metric(pfx)}
+	}
+	return ret
+}
+
+// metric returns the metric of pfx, one of p's AllowedIPs.
+func (p *Peer) metric(pfx netip.Prefix) uint32 {
+	for _, a := range p.AllowedIPMetrics {
+		if a.Prefix == pfx {
+			return a.Metric
+		}
+	}
+	return 0
+}
+
+// metricStrings returns the non-default metrics in ams, sorted, as
+// strings like "10.0.0.0/8:5", for Dump and ChangesFrom.
+func metricStrings(ams []AllowedIP) []string {
+	var ret []string
+	for _, a := range ams {
+		if a.Metric != 0 {
+			ret = append(ret, fmt.Sprintf("%v:%d", a.Prefix, a.Metric))
+		}
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// writeMetrics writes the non-default metrics in ams to sb as
+// " metrics=10.0.0.0/8:5,...", if there are any.
+func writeMetrics(sb *strings.Builder, ams []AllowedIP) {
+	if strs := metricStrings(ams); len(strs) > 0 {
+		fmt.Fprintf(sb, " metrics=%s", strings.Join(strs, ","))
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"net/netip"
+
+	"go4.org/mem"
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+	"tailscale.com/types/logid"
+)
+
+// Anonymized returns a copy of cfg that is safe to share, such as in a bug
+// report, preserving its structure but none of its secrets or identities:
+//
+//   - Keys are replaced with pseudonyms. The same key is given the same
+//     pseudonym throughout the copy, but pseudonyms differ between calls,
+//     so that copies cannot be correlated with each other or with the keys.
+//     The private key and preshared keys are replaced with random keys.
+//   - Node IDs and peer names are replaced with "node1", "peer1" and so on,
+//     also consistently throughout the copy.
+//   - Endpoints are removed.
+//   - Addresses, allowed IPs, including those with metrics, and DNS
+//     servers are replaced with the unspecified address of the same
+//     family, keeping only prefix lengths.
+//   - Network logging IDs are removed.
+func (cfg *Config) Anonymized() *Config {
+	a := newAnonymizer()
+	out := cfg.Clone()
+	out.NodeID = a.nodeID(cfg.NodeID)
+	if !cfg.PrivateKey.IsZero() {
+		out.PrivateKey = key.NewNode()
+	}
+	out.Addresses = maskPrefixes(cfg.Addresses)
+	for i, ip := range out.DNS {
+		out.DNS[i] = unspecified(ip)
+	}
+	out.NetworkLogging.NodeID = logid.PrivateID{}
+	out.NetworkLogging.DomainID = logid.PrivateID{}
+	for i := range out.Peers {
+		p := &out.Peers[i]
+		p.PublicKey = a.nodeKey(p.PublicKey)
+		p.WGEndpoint = a.nodeKey(p.WGEndpoint)
+		p.DiscoKey = a.discoKey(p.DiscoKey)
+		p.NodeID = a.nodeID(p.NodeID)
+		if p.Name != "" {
+			p.Name = fmt.Sprintf("peer%d", i+1)
+		}
+		if !p.PresharedKey.IsZero() {
+			rand.Read(p.PresharedKey[:])
+		}
+		p.AllowedIPs = maskPrefixes(p.AllowedIPs)
+		for j := range p.AllowedIPMetrics {
+			a := &p.AllowedIPMetrics[j]
+			a.Prefix = netip.PrefixFrom(unspecified(a.Prefix.Addr()), a.Prefix.Bits())
+		}
+		if p.V4MasqAddr != nil {
+			*p.V4MasqAddr = unspecified(*p.V4MasqAddr)
+		}
+		if p.V6MasqAddr != nil {
+			*p.V6MasqAddr = unspecified(*p.V6MasqAddr)
+		}
+		p.Endpoints = nil
+	}
+	return out
+}
+
+// anonymizer maps identities to pseudonyms for Anonymized.
+type anonymizer struct {
+	salt    [32]byte
+	nodeIDs map[tailcfg.StableNodeID]tailcfg.StableNodeID
+}
+
+func newAnonymizer() *anonymizer {
+	a := &anonymizer{nodeIDs: make(map[tailcfg.StableNodeID]tailcfg.StableNodeID)}
+	rand.Read(a.salt[:])
+	return a
+}
+
+// pseudonym returns the pseudonym of raw, a key of the given kind.
+func (a *anonymizer) pseudonym(kind string, raw [32]byte) [32]byte {
+	h := hmac.New(sha256.New, a.salt[:])
+	h.Write([]byte(kind))
+	h.Write(raw[:])
+	var out [32]byte
+	h.Sum(out[:0])
+	return out
+}
+
+func (a *anonymizer) nodeKey(k key.NodePublic) key.NodePublic {
+	if k.IsZero() {
+		return k
+	}
+	p := a.pseudonym("node", k.Raw32())
+	return key.NodePublicFromRaw32(mem.B(p[:]))
+}
+
+func (a *anonymizer) discoKey(k key.DiscoPublic) key.DiscoPublic {
+	if k.IsZero() {
+		return k
+	}
+	p := a.pseudonym("disco", k.Raw32())
+	return key.DiscoPublicFromRaw32(mem.B(p[:]))
+}
+
+func (a *anonymizer) nodeID(id tailcfg.StableNodeID) tailcfg.StableNodeID {
+	if id == "" {
+		return ""
+	}
+	p, ok := a.nodeIDs[id]
+	if !ok {
+		p = tailcfg.StableNodeID(fmt.Sprintf("node%d", len(a.nodeIDs)+1))
+		a.nodeIDs[id] = p
+	}
+	return p
+}
+
+// maskPrefixes returns pfxs with each address replaced by the unspecified
+// address of its family.
+func maskPrefixes(pfxs []netip.Prefix) []netip.Prefix {
+	if pfxs == nil {
+		return nil
+	}
+	out := make([]netip.Prefix, len(pfxs))
+	for i, pfx := range pfxs {
+		out[i] = netip.PrefixFrom(unspecified(pfx.Addr()), pfx.Bits())
+	}
+	return out
+}
+
+// unspecified returns the unspecified address of ip's family.
+func unspecified(ip netip.Addr) netip.Addr {
+	switch {
+	case ip.Is4():
+		return netip.IPv4Unspecified()
+	case ip.Is6():
+		return netip.IPv6Unspecified()
+	}
+	return ip
+}
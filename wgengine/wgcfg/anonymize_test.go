@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/key"
+	"tailscale.com/types/logid"
+)
+
+func TestAnonymized(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	disco := key.NewDisco().Public()
+	nodeLogID, err := logid.NewPrivateID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &Config{
+		Name:       "tailscale",
+		NodeID:     "nSelf1CNTRL",
+		PrivateKey: key.NewNode(),
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32"), pfx("fd7a:115c:a1e0::1/128")},
+		DNS:        []netip.Addr{netip.MustParseAddr("100.100.100.100")},
+		Peers: []Peer{
+			{
+				PublicKey:        k1,
+				WGEndpoint:       k1,
+				DiscoKey:         disco,
+				NodeID:           "nPeer1CNTRL",
+				Name:             "laptop",
+				AllowedIPs:       []netip.Prefix{pfx("100.64.0.2/32"), pfx("192.168.7.0/24")},
+				AllowedIPMetrics: []AllowedIP{{Prefix: pfx("192.168.7.0/24"), Metric: 5}},
+				Endpoints:        []Endpoint{{Addr: netip.MustParseAddrPort("198.51.100.7:41641"), Type: EndpointDirect}},
+			},
+			{
+				PublicKey:  k2,
+				NodeID:     "nPeer2CNTRL",
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32")},
+			},
+		},
+	}
+	cfg.NetworkLogging.NodeID = nodeLogID
+	orig := cfg.Clone()
+
+	got := cfg.Anonymized()
+	if !cfg.Equal(orig) {
+		t.Errorf("Anonymized modified its receiver")
+	}
+
+	p0, p1 := got.Peers[0], got.Peers[1]
+	if p0.PublicKey == k1 || p1.PublicKey == k2 || p0.PublicKey == p1.PublicKey || p0.PublicKey.IsZero() {
+		t.Errorf("public keys not replaced with distinct pseudonyms: %v, %v", p0.PublicKey, p1.PublicKey)
+	}
+	if p0.WGEndpoint != p0.PublicKey {
+		t.Errorf("WGEndpoint pseudonym %v differs from PublicKey pseudonym %v", p0.WGEndpoint, p0.PublicKey)
+	}
+	if !p1.WGEndpoint.IsZero() {
+		t.Errorf("zero WGEndpoint became %v", p1.WGEndpoint)
+	}
+	if p0.DiscoKey == disco || p0.DiscoKey.IsZero() {
+		t.Errorf("disco key not replaced: %v", p0.DiscoKey)
+	}
+	if got.NodeID != "node1" || p0.NodeID != "node2" || p1.NodeID != "node3" {
+		t.Errorf("node IDs = %q, %q, %q", got.NodeID, p0.NodeID, p1.NodeID)
+	}
+	if p0.Name != "peer1" || p1.Name != "" {
+		t.Errorf("names = %q, %q", p0.Name, p1.Name)
+	}
+	if len(p0.Endpoints) != 0 {
+		t.Errorf("endpoints not removed: %v", p0.Endpoints)
+	}
+	if want := []netip.Prefix{pfx("0.0.0.0/32"), pfx("0.0.0.0/24")}; !slices.Equal(p0.AllowedIPs, want) {
+		t.Errorf("allowed IPs = %v; want %v", p0.AllowedIPs, want)
+	}
+	if want := []AllowedIP{{Prefix: pfx("0.0.0.0/24"), Metric: 5}}; !slices.Equal(p0.AllowedIPMetrics, want) {
+		t.Errorf("allowed IP metrics = %v; want %v", p0.AllowedIPMetrics, want)
+	}
+	if want := []netip.Prefix{pfx("0.0.0.0/32"), pfx("::/128")}; !slices.Equal(got.Addresses, want) {
+		t.Errorf("addresses = %v; want %v", got.Addresses, want)
+	}
+	if got.PrivateKey.IsZero() || got.PrivateKey.Equal(cfg.PrivateKey) {
+		t.Errorf("private key not replaced")
+	}
+	if !got.NetworkLogging.NodeID.IsZero() {
+		t.Errorf("network logging ID not removed")
+	}
+
+	// No real identity remains anywhere in the result.
+	b, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b) + " " + got.PrivateKey.Public().String() + " " + fmt.Sprint(got.Peers)
+	for _, secret := range []string{
+		k1.String(), k2.String(), disco.String(), cfg.PrivateKey.Public().String(),
+		"CNTRL", "laptop", "198.51.100.7", "100.64.0", "192.168", "100.100.100.100", "fd7a",
+		nodeLogID.String(),
+	} {
+		if strings.Contains(s, secret) {
+			t.Errorf("anonymized config contains %q: %s", secret, s)
+		}
+	}
+
+	// Pseudonyms differ between calls.
+	if again := cfg.Anonymized(); again.Peers[0].PublicKey == p0.PublicKey {
+		t.Errorf("pseudonyms repeated across calls")
+	}
+}
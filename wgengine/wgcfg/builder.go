@@ -0,0 +1,215 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+// Builder assembles a Config incrementally, validating each piece as it
+// is added. Validation errors are collected and returned by Build.
+//
+// The zero value is an empty Builder ready to use.
+type Builder struct {
+	cfg        Config
+	keys       map[key.NodePublic]bool     // public keys of peers added so far
+	groups     map[string][]netip.Prefix   // route groups, by name
+	peerGroups map[key.NodePublic][]string // route groups referenced by each peer
+	errs       []error
+}
+
+// SetPrivateKey sets the device's private key.
+func (b *Builder) SetPrivateKey(k key.NodePrivate) *Builder {
+	if k.IsZero() {
+		b.errs = append(b.errs, errors.New("private key is zero"))
+	}
+	b.cfg.PrivateKey = k
+	return b
+}
+
+// SetKeyProvider makes the device's private key be fetched from p when
+// the Config is applied, in place of a key set with SetPrivateKey.
+func (b *Builder) SetKeyProvider(p KeyProvider) *Builder {
+	if p == nil {
+		b.errs = append(b.errs, errors.New("key provider is nil"))
+	}
+	b.cfg.KeyProvider = p
+	return b
+}
+
+// RouteGroup defines a named group of prefixes, such as "corp-subnets",
+// that peers can reference with PeerBuilder.AllowRouteGroup instead of
+// listing the prefixes individually. Groups may be defined before or after
+// they are referenced. It is an error to define a group twice.
+func (b *Builder) RouteGroup(name string, prefixes ...netip.Prefix) *Builder {
+	if _, ok := b.groups[name]; ok {
+		b.errs = append(b.errs, fmt.Errorf("duplicate route group %q", name))
+		return b
+	}
+	for _, ipp := range prefixes {
+		if err := checkAllowedIP(ipp); err != nil {
+			b.errs = append(b.errs, fmt.Errorf("route group %q: %w", name, err))
+		}
+	}
+	if b.groups == nil {
+		b.groups = make(map[string][]netip.Prefix)
+	}
+	b.groups[name] = slices.Clone(prefixes)
+	return b
+}
+
+// AddPeer adds the peer built by pb. It is an error to add two peers with
+// the same public key.
+func (b *Builder) AddPeer(pb PeerBuilder) *Builder {
+	b.errs = append(b.errs, pb.errs...)
+	k := pb.peer.PublicKey
+	if b.keys[k] {
+		b.errs = append(b.errs, fmt.Errorf("duplicate peer %v", k.ShortString()))
+		return b
+	}
+	if b.keys == nil {
+		b.keys = make(map[key.NodePublic]bool)
+	}
+	b.keys[k] = true
+	b.cfg.Peers = append(b.cfg.Peers, *pb.peer.Clone())
+	if len(pb.groups) > 0 {
+		if b.peerGroups == nil {
+			b.peerGroups = make(map[key.NodePublic][]string)
+		}
+		b.peerGroups[k] = slices.Clone(pb.groups)
+	}
+	return b
+}
+
+// Build returns the assembled Config, or all the validation errors seen
+// while assembling it. The returned Config does not alias b.
+//
+// Route groups referenced by peers are expanded into their prefixes,
+// which are appended to the peers' allowed IPs, omitting any the peer
+// already has. It is an error for a peer to reference an undefined group.
+func (b *Builder) Build() (*Config, error) {
+	cfg := b.cfg.Clone()
+	errs := slices.Clip(b.errs)
+	for i := range cfg.Peers {
+		p := &cfg.Peers[i]
+		for _, name := range b.peerGroups[p.PublicKey] {
+			prefixes, ok := b.groups[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("peer %v: unknown route group %q", p.PublicKey.ShortString(), name))
+				continue
+			}
+			for _, ipp := range prefixes {
+				if !slices.Contains(p.AllowedIPs, ipp) {
+					p.AllowedIPs = append(p.AllowedIPs, ipp)
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("wgcfg: invalid config: %w", errors.Join(errs...))
+	}
+	// As in Validate, the device needs exactly one source of its key.
+	switch {
+	case cfg.KeyProvider != nil && !cfg.PrivateKey.IsZero():
+		return nil, errors.New("wgcfg: invalid config: both a private key and a key provider")
+	case cfg.KeyProvider == nil && cfg.PrivateKey.IsZero():
+		return nil, errors.New("wgcfg: invalid config: no private key")
+	}
+	return cfg, nil
+}
+
+// PeerBuilder assembles a Peer for Builder.AddPeer.
+// Its methods return an updated copy, so they can be chained.
+type PeerBuilder struct {
+	peer   Peer
+	groups []string // route groups to expand at Build
+	errs   []error
+}
+
+// NewPeerBuilder returns a PeerBuilder for the peer with public key k.
+func NewPeerBuilder(k key.NodePublic) PeerBuilder {
+	var pb PeerBuilder
+	if k.IsZero() {
+		pb.errs = append(pb.errs, errors.New("peer public key is zero"))
+	}
+	pb.peer.PublicKey = k
+	return pb
+}
+
+// AllowIP adds ipp to the peer's allowed IPs.
+// It must be valid and have no bits set beyond its prefix length.
+func (pb PeerBuilder) AllowIP(ipp netip.Prefix) PeerBuilder {
+	if err := checkAllowedIP(ipp); err != nil {
+		pb.errs = append(slices.Clip(pb.errs), fmt.Errorf("peer %v: %w", pb.peer.PublicKey.ShortString(), err))
+	}
+	pb.peer.AllowedIPs = append(slices.Clip(pb.peer.AllowedIPs), ipp)
+	return pb
+}
+
+// AllowIPWithMetric is like AllowIP, but also sets the metric of ipp;
+// see Peer.AllowedIPMetrics.
+func (pb PeerBuilder) AllowIPWithMetric(ipp netip.Prefix, metric uint32) PeerBuilder {
+	pb = pb.AllowIP(ipp)
+	pb.peer.AllowedIPMetrics = append(slices.Clip(pb.peer.AllowedIPMetrics), AllowedIP{Prefix: ipp, Metric: metric})
+	return pb
+}
+
+// AllowRouteGroup adds the prefixes of the route group name, as defined
+// by Builder.RouteGroup, to the peer's allowed IPs when the Config is built.
+func (pb PeerBuilder) AllowRouteGroup(name string) PeerBuilder {
+	pb.groups = append(slices.Clip(pb.groups), name)
+	return pb
+}
+
+// checkAllowedIP reports whether ipp is usable as an allowed IP.
+func checkAllowedIP(ipp netip.Prefix) error {
+	switch {
+	case !ipp.IsValid():
+		return fmt.Errorf("invalid allowed IP %v", ipp)
+	case ipp != ipp.Masked():
+		return fmt.Errorf("allowed IP %v has host bits set", ipp)
+	}
+	return nil
+}
+
+// DiscoKey sets the peer's disco key.
+func (pb PeerBuilder) DiscoKey(k key.DiscoPublic) PeerBuilder {
+	pb.peer.DiscoKey = k
+	return pb
+}
+
+// Name sets the peer's human-readable name.
+func (pb PeerBuilder) Name(name string) PeerBuilder {
+	pb.peer.Name = name
+	return pb
+}
+
+// Endpoint adds ep to the peer's candidate endpoints, after any already
+// added. Its address must be valid.
+func (pb PeerBuilder) Endpoint(ep Endpoint) PeerBuilder {
+	if !ep.Addr.IsValid() {
+		pb.errs = append(slices.Clip(pb.errs), fmt.Errorf("peer %v: invalid endpoint %v", pb.peer.PublicKey.ShortString(), ep.Addr))
+	}
+	pb.peer.Endpoints = append(slices.Clip(pb.peer.Endpoints), ep)
+	return pb
+}
+
+// IdleTimeout sets how long the peer may go without activity before it
+// is reported as idle; see Peer.IdleTimeout.
+func (pb PeerBuilder) IdleTimeout(d time.Duration) PeerBuilder {
+	pb.peer.IdleTimeout = d
+	return pb
+}
+
+// PersistentKeepalive sets the peer's keepalive interval, in seconds.
+func (pb PeerBuilder) PersistentKeepalive(secs uint16) PeerBuilder {
+	pb.peer.PersistentKeepalive = secs
+	return pb
+}
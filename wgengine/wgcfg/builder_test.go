@@ -0,0 +1,180 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+func TestBuilder(t *testing.T) {
+	priv := key.NewNode()
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	ip1 := netip.MustParsePrefix("100.64.0.1/32")
+	ip2 := netip.MustParsePrefix("10.0.0.0/8")
+	derp := Endpoint{Addr: netip.MustParseAddrPort("127.3.3.40:1"), Type: EndpointDERP, Region: "nyc"}
+
+	got, err := new(Builder).
+		SetPrivateKey(priv).
+		AddPeer(NewPeerBuilder(k1).AllowIP(ip1).AllowIP(ip2).PersistentKeepalive(25)).
+		AddPeer(NewPeerBuilder(k2).Name("laptop").Endpoint(derp)).
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		PrivateKey: priv,
+		Peers: []Peer{
+			{PublicKey: k1, AllowedIPs: []netip.Prefix{ip1, ip2}, PersistentKeepalive: 25},
+			{PublicKey: k2, Name: "laptop", Endpoints: []Endpoint{derp}},
+		},
+	}
+	if !got.Equal(want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	// Builders derived from a common PeerBuilder must not share state.
+	base := NewPeerBuilder(k1).AllowIP(ip1)
+	a := base.AllowIP(ip2)
+	b := base.AllowIP(netip.MustParsePrefix("10.1.0.0/16"))
+	cfgA, err := new(Builder).SetPrivateKey(priv).AddPeer(a).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := new(Builder).SetPrivateKey(priv).AddPeer(b).Build(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfgA.Peers[0].AllowedIPs; len(got) != 2 || got[1] != ip2 {
+		t.Errorf("derived builders share AllowedIPs: %v", got)
+	}
+}
+
+func TestBuilderRouteGroups(t *testing.T) {
+	priv := key.NewNode()
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	pfx := netip.MustParsePrefix
+
+	b := new(Builder).
+		SetPrivateKey(priv).
+		RouteGroup("corp-subnets", pfx("10.0.0.0/8"), pfx("172.16.0.0/12")).
+		AddPeer(NewPeerBuilder(k1).AllowIP(pfx("100.64.0.1/32")).AllowRouteGroup("corp-subnets").AllowRouteGroup("lab")).
+		AddPeer(NewPeerBuilder(k2).AllowIP(pfx("10.0.0.0/8")).AllowRouteGroup("corp-subnets")).
+		RouteGroup("lab", pfx("172.16.0.0/12"), pfx("192.168.0.0/24"))
+	got, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{
+		PrivateKey: priv,
+		Peers: []Peer{
+			{PublicKey: k1, AllowedIPs: []netip.Prefix{pfx("100.64.0.1/32"), pfx("10.0.0.0/8"), pfx("172.16.0.0/12"), pfx("192.168.0.0/24")}},
+			{PublicKey: k2, AllowedIPs: []netip.Prefix{pfx("10.0.0.0/8"), pfx("172.16.0.0/12")}},
+		},
+	}
+	if !got.Equal(want) {
+		t.Errorf("got %+v; want %+v", got, want)
+	}
+
+	// Building again gives the same result.
+	if again, err := b.Build(); err != nil || !again.Equal(want) {
+		t.Errorf("second Build = %+v, %v; want %+v", again, err, want)
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	priv := key.NewNode()
+	k := key.NewNode().Public()
+	tests := []struct {
+		name    string
+		b       *Builder
+		wantErr string
+	}{
+		{
+			name:    "no-private-key",
+			b:       new(Builder).AddPeer(NewPeerBuilder(k)),
+			wantErr: "no private key",
+		},
+		{
+			name:    "zero-private-key",
+			b:       new(Builder).SetPrivateKey(key.NodePrivate{}),
+			wantErr: "private key is zero",
+		},
+		{
+			name:    "private-key-and-key-provider",
+			b:       new(Builder).SetPrivateKey(priv).SetKeyProvider(&fakeKeyProvider{k: priv}),
+			wantErr: "both a private key and a key provider",
+		},
+		{
+			name:    "zero-peer-key",
+			b:       new(Builder).SetPrivateKey(priv).AddPeer(NewPeerBuilder(key.NodePublic{})),
+			wantErr: "peer public key is zero",
+		},
+		{
+			name:    "duplicate-peer",
+			b:       new(Builder).SetPrivateKey(priv).AddPeer(NewPeerBuilder(k)).AddPeer(NewPeerBuilder(k)),
+			wantErr: "duplicate peer",
+		},
+		{
+			name:    "invalid-allowed-ip",
+			b:       new(Builder).SetPrivateKey(priv).AddPeer(NewPeerBuilder(k).AllowIP(netip.Prefix{})),
+			wantErr: "invalid allowed IP",
+		},
+		{
+			name:    "unmasked-allowed-ip",
+			b:       new(Builder).SetPrivateKey(priv).AddPeer(NewPeerBuilder(k).AllowIP(netip.MustParsePrefix("10.1.2.3/8"))),
+			wantErr: "allowed IP 10.1.2.3/8 has host bits set",
+		},
+		{
+			name:    "invalid-endpoint",
+			b:       new(Builder).SetPrivateKey(priv).AddPeer(NewPeerBuilder(k).Endpoint(Endpoint{Type: EndpointDirect})),
+			wantErr: "invalid endpoint",
+		},
+		{
+			name:    "unknown-route-group",
+			b:       new(Builder).SetPrivateKey(priv).AddPeer(NewPeerBuilder(k).AllowRouteGroup("corp")),
+			wantErr: `unknown route group "corp"`,
+		},
+		{
+			name:    "duplicate-route-group",
+			b:       new(Builder).SetPrivateKey(priv).RouteGroup("corp").RouteGroup("corp"),
+			wantErr: `duplicate route group "corp"`,
+		},
+		{
+			name:    "invalid-route-group-prefix",
+			b:       new(Builder).SetPrivateKey(priv).RouteGroup("corp", netip.MustParsePrefix("10.1.2.3/8")),
+			wantErr: `route group "corp": allowed IP 10.1.2.3/8 has host bits set`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := tt.b.Build()
+			if err == nil {
+				t.Fatalf("Build succeeded with %+v; want error", cfg)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Build error = %q; want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestBuilderKeyProvider(t *testing.T) {
+	prov := &fakeKeyProvider{k: key.NewNode()}
+	cfg, err := new(Builder).SetKeyProvider(prov).AddPeer(NewPeerBuilder(key.NewNode().Public())).Build()
+	if err != nil {
+		t.Fatalf("Build with a key provider: %v", err)
+	}
+	if cfg.KeyProvider != prov || !cfg.PrivateKey.IsZero() {
+		t.Errorf("Build = %+v; want a config with the key provider alone", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate of built config: %v", err)
+	}
+	if prov.calls != 0 {
+		t.Errorf("Build fetched the key %d times; want 0", prov.calls)
+	}
+}
@@ -0,0 +1,318 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+// A ChangeSet describes the differences between two Configs, as returned
+// by Config.ChangesFrom. The zero value means no change.
+type ChangeSet struct {
+	Device  []FieldChange    // changes to device-level fields
+	Added   []key.NodePublic // peers only in the new Config, sorted
+	Removed []key.NodePublic // peers only in the old Config, sorted
+	Rotated []KeyRotation    // peers whose key changed; see KeyRotations
+	Peers   []PeerChange     // changes to peers present in both, sorted by key
+}
+
+// A PeerChange describes the changes to a single peer's fields.
+// For a rotated peer, Key is the new key.
+type PeerChange struct {
+	Key    key.NodePublic
+	Fields []FieldChange
+}
+
+// A FieldChange describes the change to a single field.
+//
+// Scalar fields, such as "mtu" or "keepalive", have their old and new
+// values rendered in Old and New, either of which is empty for a zero
+// value. Set-valued fields, such as "addrs" or "allowed", instead list
+// the elements added and removed, sorted, and leave Old and New empty.
+type FieldChange struct {
+	Field    string
+	Old, New string
+	Added    []string
+	Removed  []string
+}
+
+// String returns the change as "mtu=1280->1360" for a scalar field or
+// "allowed +10.0.0.0/8 -10.1.0.0/16" for a set-valued one.
+func (c FieldChange) String() string {
+	if c.Old != "" || c.New != "" {
+		return fmt.Sprintf("%s=%s->%s", c.Field, orNone(c.Old), orNone(c.New))
+	}
+	var sb strings.Builder
+	sb.WriteString(c.Field)
+	if len(c.Added) > 0 {
+		sb.WriteString(" +")
+		sb.WriteString(strings.Join(c.Added, ","))
+	}
+	if len(c.Removed) > 0 {
+		sb.WriteString(" -")
+		sb.WriteString(strings.Join(c.Removed, ","))
+	}
+	return sb.String()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+// IsEmpty reports whether cs describes no change.
+func (cs ChangeSet) IsEmpty() bool {
+	return len(cs.Device) == 0 && len(cs.Added) == 0 && len(cs.Removed) == 0 &&
+		len(cs.Rotated) == 0 && len(cs.Peers) == 0
+}
+
+// String summarizes cs on a single line, suitable for a log message like
+// "applied changes: %v", as in
+//
+//	mtu=1280->1360; +peer [AAAAA]; -peer [BBBBB]; peer [CCCCC] allowed +10.0.0.0/8 keepalive=none->25s
+//
+// It returns "none" if cs is empty.
+func (cs ChangeSet) String() string {
+	if cs.IsEmpty() {
+		return "none"
+	}
+	var parts []string
+	for _, c := range cs.Device {
+		parts = append(parts, c.String())
+	}
+	for _, k := range cs.Added {
+		parts = append(parts, "+peer "+k.ShortString())
+	}
+	for _, k := range cs.Removed {
+		parts = append(parts, "-peer "+k.ShortString())
+	}
+	for _, r := range cs.Rotated {
+		parts = append(parts, fmt.Sprintf("rotated %s %s->%s", r.NodeID, r.Old.ShortString(), r.New.ShortString()))
+	}
+	for _, pc := range cs.Peers {
+		fields := make([]string, len(pc.Fields))
+		for i, c := range pc.Fields {
+			fields[i] = c.String()
+		}
+		parts = append(parts, "peer "+pc.Key.ShortString()+" "+strings.Join(fields, " "))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ChangesFrom returns the changes that turn old into cfg.
+//
+// Peers are matched by public key, or, for peers that rotated their key,
+// by NodeID, in which case they are reported in Rotated and their other
+// field changes in Peers. Endpoints are compared in order, as for Equal.
+// Secrets are not included: the private key is reported by its public
+// key, a preshared key only as "set" or not, and network logging only as
+// on or off, so a change of network logging IDs alone is not reported.
+func (cfg *Config) ChangesFrom(old *Config) ChangeSet {
+	var cs ChangeSet
+
+	var d fieldChanges
+	d.scalar("name", old.Name, cfg.Name)
+	d.scalar("node", string(old.NodeID), string(cfg.NodeID))
+	d.scalar("key", privateKeyString(old), privateKeyString(cfg))
+	d.set("addrs", prefixStrings(old.Addresses), prefixStrings(cfg.Addresses))
+	d.scalar("mtu", uintString(old.MTU), uintString(cfg.MTU))
+	d.scalar("port", uintString(old.ListenPort), uintString(cfg.ListenPort))
+	d.set("dns", addrStrings(old.DNS), addrStrings(cfg.DNS))
+	d.scalar("netlog", netlogString(old), netlogString(cfg))
+	cs.Device = d
+
+	cs.Rotated = KeyRotations(old, cfg)
+	rotatedFrom := make(map[key.NodePublic]key.NodePublic, len(cs.Rotated)) // new to old
+	rotatedTo := make(map[key.NodePublic]bool, len(cs.Rotated))             // old keys
+	for _, r := range cs.Rotated {
+		rotatedFrom[r.New] = r.Old
+		rotatedTo[r.Old] = true
+	}
+
+	oldPeers := make(map[key.NodePublic]*Peer, len(old.Peers))
+	for i := range old.Peers {
+		oldPeers[old.Peers[i].PublicKey] = &old.Peers[i]
+	}
+	newKeys := make(map[key.NodePublic]bool, len(cfg.Peers))
+	for _, i := range sortedPeerIndices(cfg.Peers) {
+		p := &cfg.Peers[i]
+		newKeys[p.PublicKey] = true
+		oldKey := p.PublicKey
+		if k, ok := rotatedFrom[p.PublicKey]; ok {
+			oldKey = k
+		}
+		op, ok := oldPeers[oldKey]
+		if !ok {
+			cs.Added = append(cs.Added, p.PublicKey)
+			continue
+		}
+		if fields := peerChanges(op, p); len(fields) > 0 {
+			cs.Peers = append(cs.Peers, PeerChange{Key: p.PublicKey, Fields: fields})
+		}
+	}
+	for _, i := range sortedPeerIndices(old.Peers) {
+		p := &old.Peers[i]
+		if !newKeys[p.PublicKey] && !rotatedTo[p.PublicKey] {
+			cs.Removed = append(cs.Removed, p.PublicKey)
+		}
+	}
+	return cs
+}
+
+// peerChanges returns the changes to the fields of old that make new,
+// other than its public key.
+func peerChanges(old, new *Peer) []FieldChange {
+	var d fieldChanges
+	d.scalar("name", old.Name, new.Name)
+	if old.PublicKey == new.PublicKey {
+		// For a rotation, the NodeID matched, and is not worth repeating.
+		d.scalar("node", string(old.NodeID), string(new.NodeID))
+	}
+	d.scalar("disco", discoString(old.DiscoKey), discoString(new.DiscoKey))
+	d.set("allowed", prefixStrings(old.AllowedIPs), prefixStrings(new.AllowedIPs))
+	d.set("metrics", metricStrings(old.AllowedIPMetrics), metricStrings(new.AllowedIPMetrics))
+	d.scalar("endpoints", endpointsString(old.Endpoints), endpointsString(new.Endpoints))
+	d.scalar("keepalive", keepaliveString(old.PersistentKeepalive), keepaliveString(new.PersistentKeepalive))
+	d.scalar("idle", durationString(old.IdleTimeout), durationString(new.IdleTimeout))
+	d.scalar("masq4", addrPtrString(old.V4MasqAddr), addrPtrString(new.V4MasqAddr))
+	d.scalar("masq6", addrPtrString(old.V6MasqAddr), addrPtrString(new.V6MasqAddr))
+	if !old.PresharedKey.Equal(new.PresharedKey) {
+		d = append(d, FieldChange{Field: "psk", Old: pskString(old.PresharedKey), New: pskString(new.PresharedKey)})
+	}
+	d.scalar("jailed", boolString(old.IsJailed), boolString(new.IsJailed))
+	d.scalar("disabled", boolString(old.Disabled), boolString(new.Disabled))
+	return d
+}
+
+// fieldChanges accumulates the FieldChanges of a ChangeSet.
+type fieldChanges []FieldChange
+
+// scalar records a change to the field name if old and new differ.
+func (d *fieldChanges) scalar(name, old, new string) {
+	if old != new {
+		*d = append(*d, FieldChange{Field: name, Old: old, New: new})
+	}
+}
+
+// set records a change to the set-valued field name if old and new,
+// which must be sorted, have different elements.
+func (d *fieldChanges) set(name string, old, new []string) {
+	var added, removed []string
+	for _, s := range new {
+		if _, ok := slices.BinarySearch(old, s); !ok {
+			added = append(added, s)
+		}
+	}
+	for _, s := range old {
+		if _, ok := slices.BinarySearch(new, s); !ok {
+			removed = append(removed, s)
+		}
+	}
+	if len(added) > 0 || len(removed) > 0 {
+		*d = append(*d, FieldChange{Field: name, Added: added, Removed: removed})
+	}
+}
+
+func privateKeyString(cfg *Config) string {
+	if cfg.PrivateKey.IsZero() {
+		return ""
+	}
+	return cfg.PrivateKey.Public().ShortString()
+}
+
+func discoString(k key.DiscoPublic) string {
+	if k.IsZero() {
+		return ""
+	}
+	return k.ShortString()
+}
+
+func netlogString(cfg *Config) string {
+	switch {
+	case cfg.NetworkLogging.NodeID.IsZero() || cfg.NetworkLogging.DomainID.IsZero():
+		return ""
+	case cfg.NetworkLogging.LogExitFlowEnabled:
+		return "on+exits"
+	}
+	return "on"
+}
+
+// prefixStrings returns pfxs as sorted strings.
+func prefixStrings(pfxs []netip.Prefix) []string {
+	ret := make([]string, len(pfxs))
+	for i, pfx := range pfxs {
+		ret[i] = pfx.String()
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+// addrStrings returns addrs as sorted strings.
+func addrStrings(addrs []netip.Addr) []string {
+	ret := make([]string, len(addrs))
+	for i, ip := range addrs {
+		ret[i] = ip.String()
+	}
+	slices.Sort(ret)
+	return ret
+}
+
+func endpointsString(eps []Endpoint) string {
+	strs := make([]string, len(eps))
+	for i, ep := range eps {
+		strs[i] = dumpEndpoint(ep)
+	}
+	return strings.Join(strs, ",")
+}
+
+func addrPtrString(ip *netip.Addr) string {
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+func pskString(k PresharedKey) string {
+	if k.IsZero() {
+		return ""
+	}
+	return "set"
+}
+
+func keepaliveString(secs uint16) string {
+	if secs == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(secs)) + "s"
+}
+
+func durationString(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+func uintString(v uint16) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(int(v))
+}
+
+func boolString(b bool) string {
+	if !b {
+		return ""
+	}
+	return "true"
+}
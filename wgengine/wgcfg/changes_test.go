@@ -0,0 +1,128 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestChangesFrom(t *testing.T) {
+	nodeKey := func(b byte) key.NodePublic {
+		var raw [32]byte
+		raw[0] = b
+		return key.NodePublicFromRaw32(mem.B(raw[:]))
+	}
+	kA, kB, kC, kD := nodeKey(0x10), nodeKey(0x20), nodeKey(0x30), nodeKey(0x40)
+	pfx := netip.MustParsePrefix
+	ep := func(s string) Endpoint {
+		return Endpoint{Addr: netip.MustParseAddrPort(s), Type: EndpointDirect}
+	}
+	masq := netip.MustParseAddr("100.100.0.1")
+	priv := key.NewNode()
+	base := func() *Config {
+		return &Config{
+			Name:       "tailscale",
+			Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+			MTU:        1280,
+			ListenPort: 41641,
+			Peers: []Peer{
+				{PublicKey: kA, NodeID: "nA", AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32")}, Endpoints: []Endpoint{ep("1.2.3.4:41641")}},
+				{PublicKey: kB, NodeID: "nB", AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32")}},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   string
+	}{
+		{
+			name:   "none",
+			change: func(*Config) {},
+			want:   "none",
+		},
+		{
+			name: "device",
+			change: func(c *Config) {
+				c.MTU = 1360
+				c.ListenPort = 0
+				c.Addresses = append(c.Addresses, pfx("fd7a:115c:a1e0::1/128"))
+				c.DNS = []netip.Addr{netip.MustParseAddr("100.100.100.100")}
+			},
+			want: "addrs +fd7a:115c:a1e0::1/128; mtu=1280->1360; port=41641->none; dns +100.100.100.100",
+		},
+		{
+			name: "key",
+			change: func(c *Config) {
+				c.PrivateKey = priv
+			},
+			want: "key=none->" + priv.Public().ShortString(),
+		},
+		{
+			name: "added-removed",
+			change: func(c *Config) {
+				c.Peers[1] = Peer{PublicKey: kC, NodeID: "nC"}
+			},
+			want: "+peer [MAAAA]; -peer [IAAAA]",
+		},
+		{
+			name: "rotated",
+			change: func(c *Config) {
+				c.Peers[1].PublicKey = kD
+				c.Peers[1].PersistentKeepalive = 25
+			},
+			want: "rotated nB [IAAAA]->[QAAAA]; peer [QAAAA] keepalive=none->25s",
+		},
+		{
+			name: "allowed",
+			change: func(c *Config) {
+				c.Peers[0].AllowedIPs = []netip.Prefix{pfx("10.0.0.0/8"), pfx("100.64.0.2/32")}
+				c.Peers[1].AllowedIPs = nil
+			},
+			want: "peer [EAAAA] allowed +10.0.0.0/8; peer [IAAAA] allowed -100.64.0.3/32",
+		},
+		{
+			name: "endpoints",
+			change: func(c *Config) {
+				c.Peers[0].Endpoints = []Endpoint{
+					{Addr: netip.MustParseAddrPort("127.3.3.40:2"), Type: EndpointDERP, Region: "nyc"},
+					ep("1.2.3.4:41641"),
+				}
+			},
+			want: "peer [EAAAA] endpoints=direct:1.2.3.4:41641->derp:nyc,direct:1.2.3.4:41641",
+		},
+		{
+			name: "peer-flags",
+			change: func(c *Config) {
+				c.Peers[0].Name = "laptop"
+				c.Peers[0].V4MasqAddr = &masq
+				c.Peers[0].PresharedKey = PresharedKey{1}
+				c.Peers[0].IsJailed = true
+				c.Peers[0].Disabled = true
+			},
+			want: "peer [EAAAA] name=none->laptop masq4=none->100.100.0.1 psk=none->set jailed=none->true disabled=none->true",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, cfg := base(), base()
+			tt.change(cfg)
+			cs := cfg.ChangesFrom(old)
+			if got := cs.String(); got != tt.want {
+				t.Errorf("ChangesFrom = %q; want %q", got, tt.want)
+			}
+			if cs.IsEmpty() != (tt.want == "none") {
+				t.Errorf("IsEmpty = %v; want %v", cs.IsEmpty(), tt.want == "none")
+			}
+			if back := old.ChangesFrom(cfg); back.IsEmpty() != cs.IsEmpty() {
+				t.Errorf("reverse ChangesFrom = %v", back)
+			}
+		})
+	}
+}
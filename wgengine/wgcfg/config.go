@@ -5,7 +5,10 @@
 package wgcfg
 
 import (
+	"fmt"
 	"net/netip"
+	"slices"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
@@ -25,6 +28,17 @@ type Config struct {
 	DNS        []netip.Addr
 	Peers      []Peer
 
+	// KeyProvider, if non-nil, is where ToUAPI fetches the private key
+	// from, in place of PrivateKey, which should then be zero.
+	// See KeyProvider. Clones share the provider rather than copying it.
+	KeyProvider KeyProvider `json:"-" codegen:"noclone"`
+
+	// ListenPort is the UDP port on which WireGuard traffic is received,
+	// or 0 if unknown. It changes when magicsock rebinds. It is populated
+	// by DeviceConfig but not written by ToUAPI, as the port is owned by
+	// magicsock, not WireGuard.
+	ListenPort uint16
+
 	// NetworkLogging enables network logging.
 	// It is disabled if either ID is the zero value.
 	// LogExitFlowEnabled indicates whether or not exit flows should be logged.
@@ -38,11 +52,31 @@ type Config struct {
 type Peer struct {
 	PublicKey           key.NodePublic
 	DiscoKey            key.DiscoPublic // present only so we can handle restarts within wgengine, not passed to WireGuard
+	Name                string          // human-readable label for logs and dumps; not passed to WireGuard
+	PresharedKey        PresharedKey    `json:"-"` // optional; zero for none; never encoded as JSON
 	AllowedIPs          []netip.Prefix
 	V4MasqAddr          *netip.Addr // if non-nil, masquerade IPv4 traffic to this peer using this address
 	V6MasqAddr          *netip.Addr // if non-nil, masquerade IPv6 traffic to this peer using this address
 	IsJailed            bool        // if true, this peer is jailed and cannot initiate connections
+	Disabled            bool        // if true, this peer is kept in the Config but not configured in WireGuard
 	PersistentKeepalive uint16      // in seconds between keep-alives; 0 to disable
+	// NodeID is the peer's stable node ID, which, unlike PublicKey,
+	// survives key rotation. It is not passed to WireGuard.
+	NodeID tailcfg.StableNodeID
+	// Endpoints are the peer's candidate endpoints, in the order in which
+	// they should be tried. Like DiscoKey, they are not passed to WireGuard,
+	// which only ever sees WGEndpoint; they are carried so that logging and
+	// diagnostics can refer to the endpoint in use.
+	Endpoints []Endpoint
+	// IdleTimeout, if non-zero, is how long the peer may go without an
+	// observed handshake or keepalive before wglog reports it as idle.
+	// It is not passed to WireGuard.
+	IdleTimeout time.Duration
+	// AllowedIPMetrics optionally sets the metrics of some of AllowedIPs,
+	// for routing layers choosing between peers that route the same prefix.
+	// Prefixes of AllowedIPs without an entry have metric 0, and entries
+	// for other prefixes are ignored. It is not passed to WireGuard.
+	AllowedIPMetrics []AllowedIP
 	// wireguard-go's endpoint for this peer. It should always equal Peer.PublicKey.
 	// We represent it explicitly so that we can detect if they diverge and recover.
 	// There is no need to set WGEndpoint explicitly when constructing a Peer by hand.
@@ -59,3 +93,75 @@ func (config Config) PeerWithKey(k key.NodePublic) (Peer, bool) {
 	}
 	return Peer{}, false
 }
+
+// SubsetForPeer returns a copy of cfg containing only the peer with key k,
+// along with the local interface configuration, for reproducing
+// connectivity with that one peer in isolation. It returns an error if cfg
+// has no such peer.
+func (cfg *Config) SubsetForPeer(k key.NodePublic) (*Config, error) {
+	i := slices.IndexFunc(cfg.Peers, func(p Peer) bool { return p.PublicKey == k })
+	if i < 0 {
+		return nil, fmt.Errorf("wgcfg: no peer %v in config", k.ShortString())
+	}
+	out := cfg.Clone()
+	out.Peers = out.Peers[i : i+1 : i+1]
+	return out, nil
+}
+
+// Endpoint returns the peer's first (most preferred) candidate endpoint
+// and reports whether it has one.
+func (p *Peer) Endpoint() (Endpoint, bool) {
+	if len(p.Endpoints) == 0 {
+		return Endpoint{}, false
+	}
+	return p.Endpoints[0], true
+}
+
+// Equal reports whether p and o are equal.
+// Endpoint order is significant, as it is the order in which
+// candidates are tried.
+func (p *Peer) Equal(o *Peer) bool {
+	if p == nil || o == nil {
+		return p == o
+	}
+	return p.PublicKey == o.PublicKey &&
+		p.NodeID == o.NodeID &&
+		p.DiscoKey == o.DiscoKey &&
+		p.Name == o.Name &&
+		p.PresharedKey.Equal(o.PresharedKey) &&
+		slices.Equal(p.AllowedIPs, o.AllowedIPs) &&
+		ptrEqual(p.V4MasqAddr, o.V4MasqAddr) &&
+		ptrEqual(p.V6MasqAddr, o.V6MasqAddr) &&
+		p.IsJailed == o.IsJailed &&
+		p.Disabled == o.Disabled &&
+		p.PersistentKeepalive == o.PersistentKeepalive &&
+		slices.Equal(p.Endpoints, o.Endpoints) &&
+		p.IdleTimeout == o.IdleTimeout &&
+		slices.Equal(p.AllowedIPMetrics, o.AllowedIPMetrics) &&
+		p.WGEndpoint == o.WGEndpoint
+}
+
+// Equal reports whether c and o are equal.
+// Peers are compared in order.
+func (c *Config) Equal(o *Config) bool {
+	if c == nil || o == nil {
+		return c == o
+	}
+	return c.Name == o.Name &&
+		c.NodeID == o.NodeID &&
+		c.PrivateKey.Equal(o.PrivateKey) &&
+		keyProvidersEqual(c.KeyProvider, o.KeyProvider) &&
+		slices.Equal(c.Addresses, o.Addresses) &&
+		c.MTU == o.MTU &&
+		slices.Equal(c.DNS, o.DNS) &&
+		c.ListenPort == o.ListenPort &&
+		slices.EqualFunc(c.Peers, o.Peers, func(a, b Peer) bool { return a.Equal(&b) }) &&
+		c.NetworkLogging == o.NetworkLogging
+}
+
+func ptrEqual[T comparable](a, b *T) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
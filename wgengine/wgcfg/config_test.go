@@ -0,0 +1,145 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding/json"
+	"net/netip"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+func TestPeerEndpoints(t *testing.T) {
+	ep1 := Endpoint{Addr: netip.MustParseAddrPort("1.2.3.4:41641"), Type: EndpointDirect}
+	ep2 := Endpoint{Addr: netip.MustParseAddrPort("127.3.3.40:1"), Type: EndpointDERP, Region: "nyc"}
+	p := Peer{
+		PublicKey: key.NewNode().Public(),
+		Endpoints: []Endpoint{ep1, ep2},
+	}
+
+	if got, ok := p.Endpoint(); !ok || got != ep1 {
+		t.Errorf("Endpoint() = %v, %v; want %v, true", got, ok, ep1)
+	}
+	if _, ok := new(Peer).Endpoint(); ok {
+		t.Errorf("Endpoint() on peer without endpoints reported ok")
+	}
+
+	j, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back Peer
+	if err := json.Unmarshal(j, &back); err != nil {
+		t.Fatal(err)
+	}
+	if !p.Equal(&back) {
+		t.Errorf("JSON round trip mismatch\n got: %+v\nwant: %+v", back, p)
+	}
+
+	var raw struct{ Endpoints []map[string]any }
+	if err := json.Unmarshal(j, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if got := raw.Endpoints[1]["Type"]; got != "derp" {
+		t.Errorf("endpoint type serialized as %#v; want %q", got, "derp")
+	}
+
+	clone := p.Clone()
+	if !p.Equal(clone) {
+		t.Errorf("Clone not equal to original")
+	}
+	clone.Endpoints[0], clone.Endpoints[1] = clone.Endpoints[1], clone.Endpoints[0]
+	if p.Endpoints[0] != ep1 {
+		t.Errorf("Clone aliases Endpoints")
+	}
+	if p.Equal(clone) {
+		t.Errorf("peers with reordered endpoints compare equal")
+	}
+
+	c1 := &Config{Peers: []Peer{p}}
+	c2 := &Config{Peers: []Peer{*clone}}
+	if c1.Equal(c2) {
+		t.Errorf("configs with reordered peer endpoints compare equal")
+	}
+	if !c1.Equal(c1.Clone()) {
+		t.Errorf("Config Clone not equal to original")
+	}
+	if c1.Hash() == c2.Hash() {
+		t.Errorf("configs with reordered peer endpoints hash the same")
+	}
+	retyped := p.Clone()
+	retyped.Endpoints[0].Type = EndpointRelay
+	if p.Equal(retyped) || c1.Hash() == (&Config{Peers: []Peer{*retyped}}).Hash() {
+		t.Errorf("changing an endpoint's type did not change the peer")
+	}
+}
+
+func TestEndpointString(t *testing.T) {
+	ap := netip.MustParseAddrPort("1.2.3.4:41641")
+	tests := []struct {
+		ep   Endpoint
+		want string
+	}{
+		{Endpoint{Addr: ap}, "1.2.3.4:41641"},
+		{Endpoint{Addr: ap, Type: EndpointDirect}, "direct 1.2.3.4:41641"},
+		{Endpoint{Addr: ap, Type: EndpointRelay}, "relay 1.2.3.4:41641"},
+		{Endpoint{Addr: netip.MustParseAddrPort("127.3.3.40:1"), Type: EndpointDERP, Region: "nyc"}, "derp nyc"},
+		{Endpoint{Addr: netip.MustParseAddrPort("127.3.3.40:1"), Type: EndpointDERP}, "derp 127.3.3.40:1"},
+	}
+	for _, tt := range tests {
+		if got := tt.ep.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q; want %q", tt.ep, got, tt.want)
+		}
+	}
+
+	for _, et := range []EndpointType{EndpointUnknownType, EndpointDirect, EndpointRelay, EndpointDERP} {
+		b, err := et.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back EndpointType
+		if err := back.UnmarshalText(b); err != nil || back != et {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v", b, back, err, et)
+		}
+	}
+	var et EndpointType
+	if err := et.UnmarshalText([]byte("carrier-pigeon")); err == nil {
+		t.Errorf("UnmarshalText of unknown type succeeded")
+	}
+}
+
+func TestSubsetForPeer(t *testing.T) {
+	k1, k2, k3 := key.NewNode().Public(), key.NewNode().Public(), key.NewNode().Public()
+	cfg := &Config{
+		Name:       "tailscale",
+		PrivateKey: key.NewNode(),
+		Addresses:  []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+		MTU:        1280,
+		Peers: []Peer{
+			{PublicKey: k1, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")}},
+			{PublicKey: k2, Name: "laptop", AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.3/32")}},
+		},
+	}
+	orig := cfg.Clone()
+
+	got, err := cfg.SubsetForPeer(k2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := orig.Clone()
+	want.Peers = want.Peers[1:]
+	if !got.Equal(want) {
+		t.Errorf("SubsetForPeer = %+v; want %+v", got, want)
+	}
+	got.Peers[0].AllowedIPs[0] = netip.MustParsePrefix("100.64.0.9/32")
+	got.Addresses[0] = netip.MustParsePrefix("100.64.0.9/32")
+	if !cfg.Equal(orig) {
+		t.Errorf("modifying the subset modified the original")
+	}
+
+	if _, err := cfg.SubsetForPeer(k3); err == nil {
+		t.Errorf("SubsetForPeer of missing peer succeeded; want error")
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	"tailscale.com/types/key"
+)
+
+// DeltaUAPI writes to w the UAPI set operations that turn a device
+// configured with old into one configured with cfg, as computed by
+// ChangesFrom, and returns those changes, for logging what was applied.
+//
+// Unlike ToUAPI, which rewrites each changed peer's configuration in
+// full, DeltaUAPI writes only the fields that changed: allowed IPs that
+// were only added are added with allowed_ip lines, and are replaced
+// wholesale with replace_allowed_ips only if some were removed. Changes
+// that WireGuard does not know about, such as to a peer's Name or disco
+// key, write nothing.
+//
+// Peer keys are identities in UAPI, so a peer that rotated its key is
+// removed under its old key and added under its new one, and a peer
+// that was disabled or re-enabled is removed or added, as Disabled peers
+// are not configured in WireGuard. All removals are written before any
+// additions, so that allowed IPs moved from a removed peer to an added
+// one end up with the added peer. Updates to existing peers are written
+// with update_only, so that if the device does not have the peer after
+// all, because old does not describe it, WireGuard ignores the update
+// instead of creating a partially configured peer.
+func (cfg *Config) DeltaUAPI(w io.Writer, old *Config) (ChangeSet, error) {
+	cs := cfg.ChangesFrom(old)
+
+	var stickyErr error
+	set := func(key, value string) {
+		if stickyErr != nil {
+			return
+		}
+		_, err := fmt.Fprintf(w, "%s=%s\n", key, value)
+		if err != nil {
+			stickyErr = err
+		}
+	}
+	setUint16 := func(key string, value uint16) {
+		set(key, strconv.FormatUint(uint64(value), 10))
+	}
+	remove := func(k key.NodePublic) {
+		set("public_key", k.UntypedHexString())
+		set("remove", "true")
+	}
+	add := func(p *Peer) {
+		set("public_key", p.PublicKey.UntypedHexString())
+		set("protocol_version", "1")
+		set("endpoint", p.PublicKey.UntypedHexString())
+		if !p.PresharedKey.IsZero() {
+			set("preshared_key", p.PresharedKey.untypedHexString())
+		}
+		// The peer is new to old, but replace any allowed IPs that the
+		// device has for it anyway, so that the result does not depend
+		// on old being accurate.
+		set("replace_allowed_ips", "true")
+		for _, ipp := range sortedPrefixes(p.AllowedIPs) {
+			set("allowed_ip", ipp.String())
+		}
+		// As in ToUAPI, set PersistentKeepalive last, because it can
+		// trigger handshake packets.
+		if p.PersistentKeepalive != 0 {
+			setUint16("persistent_keepalive_interval", p.PersistentKeepalive)
+		}
+	}
+	update := func(p *Peer, fields []FieldChange) {
+		var psk, allowed, keepalive *FieldChange
+		for i, c := range fields {
+			switch c.Field {
+			case "psk":
+				psk = &fields[i]
+			case "allowed":
+				allowed = &fields[i]
+			case "keepalive":
+				keepalive = &fields[i]
+			}
+		}
+		if psk == nil && allowed == nil && keepalive == nil {
+			return
+		}
+		set("public_key", p.PublicKey.UntypedHexString())
+		set("update_only", "true")
+		if psk != nil {
+			set("preshared_key", p.PresharedKey.untypedHexString())
+		}
+		switch {
+		case allowed == nil:
+		case len(allowed.Removed) > 0:
+			// UAPI cannot remove individual allowed IPs.
+			set("replace_allowed_ips", "true")
+			for _, ipp := range sortedPrefixes(p.AllowedIPs) {
+				set("allowed_ip", ipp.String())
+			}
+		default:
+			for _, ipp := range allowed.Added {
+				set("allowed_ip", ipp)
+			}
+		}
+		if keepalive != nil {
+			setUint16("persistent_keepalive_interval", p.PersistentKeepalive)
+		}
+	}
+
+	// Device config.
+	switch {
+	case cfg.KeyProvider != nil:
+		stickyErr = cfg.writeProvidedKey(w, old)
+	case !old.PrivateKey.Equal(cfg.PrivateKey):
+		set("private_key", cfg.PrivateKey.UntypedHexString())
+	}
+
+	oldPeers := peersByKey(old.Peers)
+	newPeers := peersByKey(cfg.Peers)
+	rotated := make(map[key.NodePublic]bool, len(cs.Rotated)) // new keys
+	for _, r := range cs.Rotated {
+		rotated[r.New] = true
+	}
+
+	// Removals.
+	for _, k := range cs.Removed {
+		if !oldPeers[k].Disabled {
+			remove(k)
+		}
+	}
+	for _, r := range cs.Rotated {
+		if !oldPeers[r.Old].Disabled {
+			remove(r.Old)
+		}
+	}
+	for _, pc := range cs.Peers {
+		if !rotated[pc.Key] && !oldPeers[pc.Key].Disabled && newPeers[pc.Key].Disabled {
+			remove(pc.Key)
+		}
+	}
+
+	// Additions.
+	for _, k := range cs.Added {
+		if p := newPeers[k]; !p.Disabled {
+			add(p)
+		}
+	}
+	for _, r := range cs.Rotated {
+		if p := newPeers[r.New]; !p.Disabled {
+			add(p)
+		}
+	}
+	for _, pc := range cs.Peers {
+		if !rotated[pc.Key] && oldPeers[pc.Key].Disabled && !newPeers[pc.Key].Disabled {
+			add(newPeers[pc.Key])
+		}
+	}
+
+	// Updates.
+	for _, pc := range cs.Peers {
+		if !rotated[pc.Key] && !oldPeers[pc.Key].Disabled && !newPeers[pc.Key].Disabled {
+			update(newPeers[pc.Key], pc.Fields)
+		}
+	}
+
+	if stickyErr != nil {
+		stickyErr = fmt.Errorf("DeltaUAPI: %w", stickyErr)
+	}
+	return cs, stickyErr
+}
+
+// peersByKey returns peers indexed by public key.
+func peersByKey(peers []Peer) map[key.NodePublic]*Peer {
+	m := make(map[key.NodePublic]*Peer, len(peers))
+	for i := range peers {
+		m[peers[i].PublicKey] = &peers[i]
+	}
+	return m
+}
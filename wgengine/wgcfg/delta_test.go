@@ -0,0 +1,221 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/tailscale/wireguard-go/device"
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestDeltaUAPI(t *testing.T) {
+	nodeKey := func(b byte) key.NodePublic {
+		var raw [32]byte
+		raw[0] = b
+		return key.NodePublicFromRaw32(mem.B(raw[:]))
+	}
+	kA, kB, kC, kD := nodeKey(0x10), nodeKey(0x20), nodeKey(0x30), nodeKey(0x40)
+	hA, hB, hC, hD := kA.UntypedHexString(), kB.UntypedHexString(), kC.UntypedHexString(), kD.UntypedHexString()
+	pfx := netip.MustParsePrefix
+	priv, priv2 := key.NewNode(), key.NewNode()
+	base := func() *Config {
+		return &Config{
+			PrivateKey: priv,
+			Peers: []Peer{
+				{PublicKey: kA, NodeID: "nA", AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32")}},
+				{PublicKey: kB, NodeID: "nB", AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32"), pfx("10.0.0.0/8")}},
+			},
+		}
+	}
+	var psk PresharedKey
+	psk[0] = 1
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{
+			name:   "none",
+			change: func(*Config) {},
+		},
+		{
+			name: "not-in-uapi",
+			change: func(c *Config) {
+				c.Peers[0].Name = "a.example.ts.net"
+				c.Peers[0].IdleTimeout = 5
+				c.MTU = 1360
+			},
+		},
+		{
+			name: "allowed-added",
+			change: func(c *Config) {
+				c.Peers[1].AllowedIPs = append(c.Peers[1].AllowedIPs, pfx("192.168.0.0/16"))
+			},
+			want: []string{
+				"public_key=" + hB,
+				"update_only=true",
+				"allowed_ip=192.168.0.0/16",
+			},
+		},
+		{
+			name: "allowed-removed",
+			change: func(c *Config) {
+				c.Peers[1].AllowedIPs = []netip.Prefix{pfx("100.64.0.3/32"), pfx("192.168.0.0/16")}
+			},
+			want: []string{
+				"public_key=" + hB,
+				"update_only=true",
+				"replace_allowed_ips=true",
+				"allowed_ip=192.168.0.0/16",
+				"allowed_ip=100.64.0.3/32",
+			},
+		},
+		{
+			name: "psk-keepalive",
+			change: func(c *Config) {
+				c.Peers[0].PersistentKeepalive = 25
+				c.Peers[0].PresharedKey = psk
+			},
+			want: []string{
+				"public_key=" + hA,
+				"update_only=true",
+				"preshared_key=" + psk.untypedHexString(),
+				"persistent_keepalive_interval=25",
+			},
+		},
+		{
+			name: "added-removed",
+			change: func(c *Config) {
+				c.Peers[0] = Peer{PublicKey: kC, NodeID: "nC", AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32")}, PersistentKeepalive: 5}
+			},
+			want: []string{
+				"public_key=" + hA,
+				"remove=true",
+				"public_key=" + hC,
+				"protocol_version=1",
+				"endpoint=" + hC,
+				"replace_allowed_ips=true",
+				"allowed_ip=100.64.0.2/32",
+				"persistent_keepalive_interval=5",
+			},
+		},
+		{
+			name: "rotated",
+			change: func(c *Config) {
+				c.Peers[1].PublicKey = kD
+			},
+			want: []string{
+				"public_key=" + hB,
+				"remove=true",
+				"public_key=" + hD,
+				"protocol_version=1",
+				"endpoint=" + hD,
+				"replace_allowed_ips=true",
+				"allowed_ip=10.0.0.0/8",
+				"allowed_ip=100.64.0.3/32",
+			},
+		},
+		{
+			name: "disabled",
+			change: func(c *Config) {
+				c.Peers[0].Disabled = true
+				c.Peers[0].PersistentKeepalive = 25
+			},
+			want: []string{
+				"public_key=" + hA,
+				"remove=true",
+			},
+		},
+		{
+			name: "added-disabled",
+			change: func(c *Config) {
+				c.Peers = append(c.Peers, Peer{PublicKey: kC, Disabled: true})
+			},
+		},
+		{
+			name: "key",
+			change: func(c *Config) {
+				c.PrivateKey = priv2
+			},
+			want: []string{"private_key=" + priv2.UntypedHexString()},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			old, cfg := base(), base()
+			tt.change(cfg)
+			var buf strings.Builder
+			cs, err := cfg.DeltaUAPI(&buf, old)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := cs.String(), cfg.ChangesFrom(old).String(); got != want {
+				t.Errorf("ChangeSet = %q; want %q", got, want)
+			}
+			got := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+			if buf.Len() == 0 {
+				got = nil
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+// TestDeltaUAPIDevice checks that applying a delta to a device configured
+// with the old Config leaves it configured as with the new one.
+func TestDeltaUAPIDevice(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	kA, kB, kC := key.NewNode().Public(), key.NewNode().Public(), key.NewNode().Public()
+	old := &Config{
+		PrivateKey: key.NewNode(),
+		Peers: []Peer{
+			{PublicKey: kA, AllowedIPs: []netip.Prefix{pfx("10.0.0.1/32")}},
+			{PublicKey: kB, AllowedIPs: []netip.Prefix{pfx("10.0.0.2/32"), pfx("10.1.0.0/16")}},
+		},
+	}
+	cfg := &Config{
+		PrivateKey: old.PrivateKey,
+		Peers: []Peer{
+			{PublicKey: kB, AllowedIPs: []netip.Prefix{pfx("10.0.0.2/32"), pfx("10.1.0.0/16"), pfx("10.0.0.1/32")}, PersistentKeepalive: 25},
+			{PublicKey: kC, AllowedIPs: []netip.Prefix{pfx("10.0.0.3/32")}},
+		},
+	}
+
+	d := NewDevice(newNilTun(), new(noopBind), device.NewLogger(device.LogLevelError, "delta"))
+	defer d.Close()
+	if err := ReconfigDevice(d, old, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+	var delta strings.Builder
+	if _, err := cfg.DeltaUAPI(&delta, old); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.IpcSetOperation(strings.NewReader(delta.String())); err != nil {
+		t.Fatalf("applying delta:\n%s\nerror: %v", delta.String(), err)
+	}
+
+	got, err := DeviceConfig(d)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Compare the UAPI each would be configured with from scratch, which
+	// covers only what WireGuard knows.
+	var gotUAPI, wantUAPI strings.Builder
+	if err := got.ToUAPI(t.Logf, &gotUAPI, new(Config)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ToUAPI(t.Logf, &wantUAPI, new(Config)); err != nil {
+		t.Fatal(err)
+	}
+	if gotUAPI.String() != wantUAPI.String() {
+		t.Errorf("device config after delta:\n%s\nwant:\n%s\ndelta:\n%s", gotUAPI.String(), wantUAPI.String(), delta.String())
+	}
+}
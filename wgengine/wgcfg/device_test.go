@@ -259,3 +259,41 @@ func (e dummyEndpoint) DstToString() string { return string(e) }
 func (e dummyEndpoint) DstToBytes() []byte  { return nil }
 func (e dummyEndpoint) DstIP() netip.Addr   { return netip.Addr{} }
 func (dummyEndpoint) SrcIP() netip.Addr     { return netip.Addr{} }
+
+func TestDisabledPeer(t *testing.T) {
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	cfg := &Config{
+		PrivateKey: key.NewNode(),
+		Peers: []Peer{
+			{PublicKey: k1, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}},
+			{PublicKey: k2, AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.2/32")}},
+		},
+	}
+	dev := NewDevice(newNilTun(), new(noopBind), device.NewLogger(device.LogLevelError, "test"))
+	defer dev.Close()
+	hasPeer := func(k key.NodePublic) bool {
+		t.Helper()
+		got, err := DeviceConfig(dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ok := got.PeerWithKey(k)
+		return ok
+	}
+
+	for _, disabled := range []bool{true, false, true} {
+		cfg.Peers[1].Disabled = disabled
+		if err := ReconfigDevice(dev, cfg, t.Logf); err != nil {
+			t.Fatal(err)
+		}
+		if !hasPeer(k1) {
+			t.Errorf("disabled=%v: enabled peer missing from device", disabled)
+		}
+		if got := hasPeer(k2); got == disabled {
+			t.Errorf("disabled=%v: peer in device = %v", disabled, got)
+		}
+		if _, ok := cfg.PeerWithKey(k2); !ok {
+			t.Errorf("disabled=%v: peer removed from Config", disabled)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// Dump returns a compact, human-readable summary of cfg, meant for eyeballing
+// and diffing rather than parsing: a line describing the device, then one
+// line per peer, like
+//
+//	peer [IMTBr] name="laptop" allowed=10.0.0.0/8,100.64.0.2/32 endpoints=direct:1.2.3.4:41641,derp:nyc keepalive=25s
+//
+// Peers are sorted by public key and allowed IPs by address, so that the
+// output is the same for equivalent configs. Zero-valued fields are omitted.
+// No secrets are included; a preshared key is noted only by "psk".
+func (cfg *Config) Dump() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "device %q", cfg.Name)
+	if cfg.NodeID != "" {
+		fmt.Fprintf(&sb, " node=%s", cfg.NodeID)
+	}
+	if !cfg.PrivateKey.IsZero() {
+		fmt.Fprintf(&sb, " key=%s", cfg.PrivateKey.Public().ShortString())
+	}
+	writePrefixes(&sb, "addrs", cfg.Addresses)
+	if cfg.MTU != 0 {
+		fmt.Fprintf(&sb, " mtu=%d", cfg.MTU)
+	}
+	if cfg.ListenPort != 0 {
+		fmt.Fprintf(&sb, " port=%d", cfg.ListenPort)
+	}
+	if len(cfg.DNS) > 0 {
+		dns := make([]string, len(cfg.DNS))
+		for i, ip := range cfg.DNS {
+			dns[i] = ip.String()
+		}
+		fmt.Fprintf(&sb, " dns=%s", strings.Join(dns, ","))
+	}
+	fmt.Fprintf(&sb, " peers=%d\n", len(cfg.Peers))
+
+	for _, i := range sortedPeerIndices(cfg.Peers) {
+		p := &cfg.Peers[i]
+		fmt.Fprintf(&sb, "peer %s", p.PublicKey.ShortString())
+		if p.Name != "" {
+			fmt.Fprintf(&sb, " name=%q", p.Name)
+		}
+		if p.NodeID != "" {
+			fmt.Fprintf(&sb, " node=%s", p.NodeID)
+		}
+		writePrefixes(&sb, "allowed", p.AllowedIPs)
+		writeMetrics(&sb, p.AllowedIPMetrics)
+		if len(p.Endpoints) > 0 {
+			eps := make([]string, len(p.Endpoints))
+			for i, ep := range p.Endpoints {
+				eps[i] = dumpEndpoint(ep)
+			}
+			fmt.Fprintf(&sb, " endpoints=%s", strings.Join(eps, ","))
+		}
+		if p.PersistentKeepalive != 0 {
+			fmt.Fprintf(&sb, " keepalive=%ds", p.PersistentKeepalive)
+		}
+		if p.IdleTimeout != 0 {
+			fmt.Fprintf(&sb, " idle=%v", p.IdleTimeout)
+		}
+		if p.V4MasqAddr != nil {
+			fmt.Fprintf(&sb, " masq4=%v", *p.V4MasqAddr)
+		}
+		if p.V6MasqAddr != nil {
+			fmt.Fprintf(&sb, " masq6=%v", *p.V6MasqAddr)
+		}
+		if !p.PresharedKey.IsZero() {
+			sb.WriteString(" psk")
+		}
+		if p.IsJailed {
+			sb.WriteString(" jailed")
+		}
+		if p.Disabled {
+			sb.WriteString(" disabled")
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// writePrefixes writes pfxs to sb as " name=a,b,c", sorted, if non-empty.
+func writePrefixes(sb *strings.Builder, name string, pfxs []netip.Prefix) {
+	if len(pfxs) == 0 {
+		return
+	}
+	pfxs = slices.Clone(pfxs)
+	slices.SortFunc(pfxs, func(a, b netip.Prefix) int {
+		if c := a.Addr().Compare(b.Addr()); c != 0 {
+			return c
+		}
+		return a.Bits() - b.Bits()
+	})
+	strs := make([]string, len(pfxs))
+	for i, pfx := range pfxs {
+		strs[i] = pfx.String()
+	}
+	fmt.Fprintf(sb, " %s=%s", name, strings.Join(strs, ","))
+}
+
+// dumpEndpoint formats ep for Dump, without spaces.
+func dumpEndpoint(ep Endpoint) string {
+	switch {
+	case ep.Type == EndpointUnknownType:
+		return ep.Addr.String()
+	case ep.Type == EndpointDERP && ep.Region != "":
+		return "derp:" + ep.Region
+	}
+	return ep.Type.String() + ":" + ep.Addr.String()
+}
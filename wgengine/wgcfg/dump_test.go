@@ -0,0 +1,67 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestDump(t *testing.T) {
+	mustKey := func(s string) key.NodePublic {
+		k, err := key.ParseNodePublicUntyped(mem.S(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	pfx := netip.MustParsePrefix
+	masq := netip.MustParseAddr("100.100.0.1")
+	cfg := &Config{
+		Name:       "tailscale",
+		NodeID:     "nSelfCNTRL",
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32"), pfx("fd7a:115c:a1e0::1/128")},
+		MTU:        1280,
+		ListenPort: 41641,
+		Peers: []Peer{
+			{
+				PublicKey:  mustKey("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"),
+				Name:       "laptop",
+				NodeID:     "nLaptopCNTRL",
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/8")},
+				Endpoints: []Endpoint{
+					{Addr: netip.MustParseAddrPort("1.2.3.4:41641"), Type: EndpointDirect},
+					{Addr: netip.MustParseAddrPort("127.3.3.40:1"), Type: EndpointDERP, Region: "nyc"},
+				},
+				PersistentKeepalive: 25,
+			},
+			{
+				PublicKey:    mustKey("0000000000000000000000000000000000000000000000000000000000000001"),
+				AllowedIPs:   []netip.Prefix{pfx("100.64.0.3/32")},
+				PresharedKey: PresharedKey{1},
+				V4MasqAddr:   &masq,
+				Disabled:     true,
+			},
+		},
+	}
+	const want = `device "tailscale" node=nSelfCNTRL addrs=100.64.0.1/32,fd7a:115c:a1e0::1/128 mtu=1280 port=41641 peers=2
+peer [AAAAA] allowed=100.64.0.3/32 masq4=100.100.0.1 psk disabled
+peer [IMTBr] name="laptop" node=nLaptopCNTRL allowed=10.0.0.0/8,100.64.0.2/32 endpoints=direct:1.2.3.4:41641,derp:nyc keepalive=25s
+`
+	if got := cfg.Dump(); got != want {
+		t.Errorf("Dump mismatch\n got:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Reordering peers and allowed IPs doesn't change the output.
+	reordered := cfg.Clone()
+	slices.Reverse(reordered.Peers)
+	slices.Reverse(reordered.Peers[1].AllowedIPs)
+	if got := reordered.Dump(); got != want {
+		t.Errorf("Dump of reordered config differs:\n%s", got)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"fmt"
+	"net/netip"
+)
+
+// An Endpoint is a candidate endpoint of a Peer.
+type Endpoint struct {
+	Addr netip.AddrPort
+	Type EndpointType
+
+	// Region is the DERP region code, such as "nyc", of an EndpointDERP
+	// endpoint. It is empty for other types.
+	Region string `json:",omitempty"`
+}
+
+// String returns a description of ep for logs, such as
+// "direct 1.2.3.4:41641" or "derp nyc". Endpoints of unknown type
+// are described by their address alone.
+func (ep Endpoint) String() string {
+	switch {
+	case ep.Type == EndpointUnknownType:
+		return ep.Addr.String()
+	case ep.Type == EndpointDERP && ep.Region != "":
+		return "derp " + ep.Region
+	}
+	return ep.Type.String() + " " + ep.Addr.String()
+}
+
+// EndpointType is the kind of path an Endpoint represents.
+type EndpointType int
+
+const (
+	EndpointUnknownType = EndpointType(0)
+	EndpointDirect      = EndpointType(1) // a direct UDP path to the peer
+	EndpointRelay       = EndpointType(2) // a UDP path via a relay other than DERP
+	EndpointDERP        = EndpointType(3) // via a DERP server
+)
+
+func (et EndpointType) String() string {
+	switch et {
+	case EndpointUnknownType:
+		return "unknown"
+	case EndpointDirect:
+		return "direct"
+	case EndpointRelay:
+		return "relay"
+	case EndpointDERP:
+		return "derp"
+	}
+	return fmt.Sprintf("EndpointType(%d)", int(et))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (et EndpointType) MarshalText() ([]byte, error) {
+	return []byte(et.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (et *EndpointType) UnmarshalText(b []byte) error {
+	for t := EndpointUnknownType; t <= EndpointDERP; t++ {
+		if string(b) == t.String() {
+			*et = t
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown endpoint type %q", b)
+}
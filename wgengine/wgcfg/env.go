@@ -0,0 +1,74 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseINIWithEnv is like ParseINI, but first replaces each ${VAR} in the
+// text read from r with the value of VAR, as returned by lookupEnv, which
+// is typically os.LookupEnv. It lets a templated config take keys and
+// endpoints from the environment rather than from the file.
+//
+// It is an error for a variable to be undefined or for a "${" to be
+// unterminated. A "$" not followed by "{" is left as is. Errors never
+// contain the substituted values, which are often secret: any that a
+// parse error would quote are replaced by the ${VAR} they came from.
+func ParseINIWithEnv(r io.Reader, lookupEnv func(string) (string, bool)) (*Config, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	expanded, subs, err := expandEnv(b, lookupEnv)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(expanded)
+	cfg, err := ParseINI(bytes.NewReader(expanded))
+	if err != nil {
+		if len(subs) == 0 {
+			return nil, err
+		}
+		return nil, errors.New(strings.NewReplacer(subs...).Replace(err.Error()))
+	}
+	return cfg, nil
+}
+
+// expandEnv returns b with each ${VAR} replaced by its value from
+// lookupEnv, and the non-empty values substituted, each followed by the
+// ${VAR} it replaced, as arguments for strings.NewReplacer.
+func expandEnv(b []byte, lookupEnv func(string) (string, bool)) (expanded []byte, subs []string, err error) {
+	var buf bytes.Buffer
+	for {
+		i := bytes.Index(b, []byte("${"))
+		if i < 0 {
+			buf.Write(b)
+			return buf.Bytes(), subs, nil
+		}
+		buf.Write(b[:i])
+		b = b[i+len("${"):]
+		j := bytes.IndexByte(b, '}')
+		if j < 0 || bytes.IndexByte(b[:j], '\n') >= 0 {
+			return nil, nil, errors.New("wgcfg: unterminated ${ in config")
+		}
+		name := string(b[:j])
+		b = b[j+1:]
+		if name == "" {
+			return nil, nil, errors.New("wgcfg: empty variable name in config")
+		}
+		v, ok := lookupEnv(name)
+		if !ok {
+			return nil, nil, fmt.Errorf("wgcfg: undefined variable %q in config", name)
+		}
+		buf.WriteString(v)
+		if v != "" {
+			subs = append(subs, v, "${"+name+"}")
+		}
+	}
+}
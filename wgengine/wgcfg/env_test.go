@@ -0,0 +1,92 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestParseINIWithEnv(t *testing.T) {
+	rawPriv := randomRaw32(t)
+	priv := key.NodePrivateFromRaw32(mem.B(rawPriv[:]))
+	pub := key.NewNode().Public()
+	rawPub := pub.Raw32()
+	env := map[string]string{
+		"WG_PRIVATE_KEY": iniKey(rawPriv),
+		"PEER_KEY":       iniKey(rawPub),
+		"ROUTE":          "10.0.0.0/8",
+		"ENDPOINT":       "198.51.100.7:41641",
+		"BAD_KEY":        "c2VjcmV0",
+		"EMPTY":          "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+
+	cfg, err := ParseINIWithEnv(strings.NewReader(
+		"[Interface]\n"+
+			"PrivateKey = ${WG_PRIVATE_KEY}\n"+
+			"[Peer]\n"+
+			"PublicKey = ${PEER_KEY}${EMPTY}\n"+
+			"AllowedIPs = ${ROUTE}, 100.64.0.2/32\n"+
+			"Endpoint = ${ENDPOINT}\n"), lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.PrivateKey.Equal(priv) {
+		t.Errorf("PrivateKey not substituted")
+	}
+	want := Peer{
+		PublicKey:  pub,
+		AllowedIPs: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("100.64.0.2/32")},
+		Endpoints:  []Endpoint{{Addr: netip.MustParseAddrPort("198.51.100.7:41641")}},
+	}
+	if len(cfg.Peers) != 1 || !cfg.Peers[0].Equal(&want) {
+		t.Errorf("Peers = %+v; want %+v", cfg.Peers, []Peer{want})
+	}
+
+	for _, tt := range []struct {
+		name, in, wantErr string
+	}{
+		{"undefined", "[Interface]\nPrivateKey = ${NOPE}\n", `undefined variable "NOPE"`},
+		{"unterminated", "[Interface]\nPrivateKey = ${WG_PRIVATE_KEY\n", "unterminated"},
+		{"empty-name", "[Interface]\nPrivateKey = ${}\n", "empty variable name"},
+		{"redacted", "[Interface]\nAddress = ${BAD_KEY}\n", `invalid Address "${BAD_KEY}"`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseINIWithEnv(strings.NewReader(tt.in), lookup)
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), env["BAD_KEY"]) {
+				t.Errorf("error %q contains the substituted value", err)
+			}
+		})
+	}
+}
+
+// iniKey returns raw as a base64 key, as in an INI config.
+func iniKey(raw [32]byte) string {
+	return base64.StdEncoding.EncodeToString(raw[:])
+}
+
+func randomRaw32(t testing.TB) [32]byte {
+	t.Helper()
+	var raw [32]byte
+	if _, err := rand.Read(raw[:]); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
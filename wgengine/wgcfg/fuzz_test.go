@@ -0,0 +1,225 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+// fuzzConfig returns a Config like those in the other tests, for deriving
+// seed inputs from.
+func fuzzConfig() *Config {
+	pfx := netip.MustParsePrefix
+	return &Config{
+		PrivateKey: key.NewNode(),
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+		Peers: sortedPeers([]Peer{
+			{
+				PublicKey:           key.NewNode().Public(),
+				Name:                "laptop",
+				AllowedIPs:          []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/8")},
+				AllowedIPMetrics:    []AllowedIP{{Prefix: pfx("10.0.0.0/8"), Metric: 5}},
+				PersistentKeepalive: 25,
+				Endpoints:           []Endpoint{{Addr: netip.MustParseAddrPort("198.51.100.7:41641"), Type: EndpointDirect}},
+			},
+			{
+				PublicKey:  key.NewNode().Public(),
+				AllowedIPs: []netip.Prefix{pfx("fd7a:115c:a1e0::2/128")},
+			},
+		}),
+	}
+}
+
+func FuzzFromUAPI(f *testing.F) {
+	var buf bytes.Buffer
+	if err := fuzzConfig().WriteAnnotatedUAPI(&buf); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.String())
+	buf.Reset()
+	if err := fuzzConfig().ToUAPI(f.Logf, &buf, new(Config)); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.String())
+	k := key.NewNode().Public().UntypedHexString()
+	f.Add("public_key=" + k + "\nendpoint=" + k + "\nallowed_ip=10.0.0.1/8\nlast_handshake_time_sec=0\n")
+	f.Add("private_key=5ec7e7\n")
+	f.Add("public_key=" + k[:17] + "\n")
+	f.Add("allowed_ip=10.0.0.0/8\n")
+	f.Add("public_key=" + k + "\npreshared_key=" + strings.Repeat("ab", 31) + "\n")
+	f.Add("public_key=" + k + "\nallowed_ip=" + strings.Repeat("10.0.0.0/8\nallowed_ip=", 100) + "::/0\n")
+	f.Add("listen_port=65536\n")
+
+	f.Fuzz(func(t *testing.T, in string) {
+		cfg, err := FromUAPI(strings.NewReader(in))
+		if err != nil {
+			return
+		}
+		keys := make(map[key.NodePublic]bool)
+		for _, p := range cfg.Peers {
+			if keys[p.PublicKey] {
+				return // duplicate peers don't round trip in order
+			}
+			keys[p.PublicKey] = true
+		}
+
+		// The annotated form round trips everything it writes.
+		var buf bytes.Buffer
+		if err := cfg.WriteAnnotatedUAPI(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := FromUAPI(&buf)
+		if err != nil {
+			t.Fatalf("parsing written config: %v\n%s", err, buf.Bytes())
+		}
+		if !got.PrivateKey.Equal(cfg.PrivateKey) {
+			t.Errorf("private key changed")
+		}
+		want := sortedPeers(cfg.Peers)
+		if len(got.Peers) != len(want) {
+			t.Fatalf("got %d peers; want %d", len(got.Peers), len(want))
+		}
+		for i, p := range got.Peers {
+			w := want[i]
+			if p.PublicKey != w.PublicKey || p.Name != w.Name || p.PersistentKeepalive != w.PersistentKeepalive ||
+				!slices.Equal(p.AllowedIPs, sortedPrefixes(w.AllowedIPs)) {
+				t.Errorf("peer %d = %+v; want %+v", i, p, w)
+			}
+		}
+	})
+}
+
+func FuzzParseINIWithEnv(f *testing.F) {
+	f.Add("[Interface]\nPrivateKey = ${WG_PRIVATE_KEY}\n[Peer]\nPublicKey = ${PEER_KEY}${EMPTY}\nAllowedIPs = ${ROUTE}\n")
+	f.Add("[Interface]\nPrivateKey = ${NOPE}\n")
+	f.Add("[Interface]\nPrivateKey = ${WG_PRIVATE_KEY\n")
+	f.Add("[Interface]\nPrivateKey = ${}\n")
+	f.Add("[Peer]\n${BAD_KEY}\n")
+	rawPub := key.NewNode().Public().Raw32()
+	env := map[string]string{
+		"WG_PRIVATE_KEY": iniKey(randomRaw32(f)),
+		"PEER_KEY":       iniKey(rawPub),
+		"ROUTE":          "10.0.0.0/8",
+		"BAD_KEY":        "c2VjcmV0",
+		"EMPTY":          "",
+	}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		ParseINIWithEnv(strings.NewReader(in), lookup)
+	})
+}
+
+func FuzzParseSimpleNetmap(f *testing.F) {
+	cfg := fuzzConfig()
+	nm := &SimpleNetmap{PrivateKey: cfg.PrivateKey, Addresses: cfg.Addresses}
+	for _, p := range cfg.Peers {
+		nm.Peers = append(nm.Peers, SimpleNode{
+			Name:       p.Name,
+			Key:        p.PublicKey,
+			Addresses:  p.AllowedIPs[:1],
+			Routes:     p.AllowedIPs[1:],
+			Endpoints:  p.Endpoints,
+			DERPRegion: "nyc",
+		})
+	}
+	b, err := json.Marshal(nm)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	f.Add([]byte(`{"PrivateKey":"privkey:5ec7e7","Peers":[{}]}`))
+	f.Add([]byte(`{"Peers":[{"Key":"nodekey:` + strings.Repeat("00", 32) + `","Addresses":["100.64.0.2/32"]}]}`))
+	f.Add([]byte(`{"Peers":[{"Endpoints":[{"Addr":"1.2.3.4:5","Type":"bogus"}]}]}`))
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		nm, err := ParseSimpleNetmap(in)
+		if err != nil {
+			return
+		}
+		b, err := json.Marshal(nm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ParseSimpleNetmap(b)
+		if err != nil {
+			t.Fatalf("parsing marshaled netmap: %v\n%s", err, b)
+		}
+		// Compare what the netmaps mean, as empty and nil slices
+		// marshal differently.
+		gotCfg, _ := got.Config()
+		wantCfg, _ := nm.Config()
+		if !gotCfg.Equal(wantCfg) || !maps.Equal(got.Regions(), nm.Regions()) {
+			t.Errorf("round trip mismatch:\n got: %+v\nwant: %+v", got, nm)
+		}
+	})
+}
+
+func FuzzConfigJSON(f *testing.F) {
+	b, err := json.Marshal(fuzzConfig())
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b)
+	b, err = json.Marshal((*configNoMethods)(fuzzConfig()))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(b) // version 1
+	f.Add([]byte(`{"Version":3}`))
+	f.Add([]byte(`{"Version":2,"Peers":[{"AllowedIPs":[{"Prefix":"10.0.0.0/8","Metric":5},"bogus"]}]}`))
+	f.Add([]byte(`{"Version":2,"Peers":[null]}`))
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		var cfg Config
+		if err := json.Unmarshal(in, &cfg); err != nil {
+			return
+		}
+		b, err := json.Marshal(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Config
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("unmarshaling marshaled config: %v\n%s", err, b)
+		}
+		b2, err := json.Marshal(&got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, b2) {
+			t.Errorf("round trip mismatch:\n got: %s\nwant: %s", b2, b)
+		}
+	})
+}
+
+func FuzzParsePresharedKey(f *testing.F) {
+	f.Add(strings.Repeat("ab", 32))
+	f.Add(strings.Repeat("AB", 32))
+	f.Add(strings.Repeat("zz", 32))
+	f.Add("5ec7e7")
+	f.Fuzz(func(t *testing.T, in string) {
+		k, err := ParsePresharedKey(in)
+		if err != nil {
+			return
+		}
+		got, err := ParsePresharedKey(k.untypedHexString())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Equal(k) {
+			t.Errorf("round trip of %q mismatch", in)
+		}
+	})
+}
@@ -0,0 +1,142 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"net/netip"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// Hash returns a hash of cfg, for cheaply detecting whether a configuration
+// changed. The hash is independent of the order of cfg.Peers and of each
+// peer's AllowedIPs. Endpoint order is significant, as it is for Equal.
+//
+// The private key is hashed via its public key, so the hash reveals nothing
+// about it and may be logged.
+func (cfg *Config) Hash() [32]byte {
+	h := cfgHasher{h: sha256.New()}
+	h.str(cfg.Name)
+	h.str(string(cfg.NodeID))
+	if cfg.PrivateKey.IsZero() {
+		h.bool(false)
+		h.bool(cfg.KeyProvider != nil) // its key is not fetched
+	} else {
+		h.bool(true)
+		h.raw32(cfg.PrivateKey.Public().Raw32())
+	}
+	h.prefixes(cfg.Addresses)
+	h.uint(uint64(cfg.MTU))
+	h.uint(uint64(len(cfg.DNS)))
+	for _, ip := range cfg.DNS {
+		h.addr(ip)
+	}
+	h.uint(uint64(cfg.ListenPort))
+	h.str(cfg.NetworkLogging.NodeID.String())
+	h.str(cfg.NetworkLogging.DomainID.String())
+	h.bool(cfg.NetworkLogging.LogExitFlowEnabled)
+
+	h.uint(uint64(len(cfg.Peers)))
+	for _, i := range sortedPeerIndices(cfg.Peers) {
+		h.peer(&cfg.Peers[i])
+	}
+
+	var sum [32]byte
+	h.h.Sum(sum[:0])
+	return sum
+}
+
+// ShortHash returns a short hex prefix of cfg.Hash, like "cfg:ab12cd34",
+// suitable for logging as a configuration fingerprint.
+func (cfg *Config) ShortHash() string {
+	sum := cfg.Hash()
+	return "cfg:" + hex.EncodeToString(sum[:4])
+}
+
+// cfgHasher writes an unambiguous encoding of Config fields to h.
+type cfgHasher struct {
+	h   hash.Hash
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (h *cfgHasher) uint(v uint64) {
+	n := binary.PutUvarint(h.buf[:], v)
+	h.h.Write(h.buf[:n])
+}
+
+func (h *cfgHasher) bool(v bool) {
+	if v {
+		h.uint(1)
+	} else {
+		h.uint(0)
+	}
+}
+
+func (h *cfgHasher) str(s string) {
+	h.uint(uint64(len(s)))
+	h.h.Write([]byte(s))
+}
+
+func (h *cfgHasher) raw32(b [32]byte) {
+	h.h.Write(b[:])
+}
+
+func (h *cfgHasher) addr(ip netip.Addr) {
+	h.uint(uint64(ip.BitLen()))
+	a := ip.As16()
+	h.h.Write(a[:])
+}
+
+func (h *cfgHasher) addrPtr(ip *netip.Addr) {
+	h.bool(ip != nil)
+	if ip != nil {
+		h.addr(*ip)
+	}
+}
+
+// prefixes hashes ipps independent of their order.
+func (h *cfgHasher) prefixes(ipps []netip.Prefix) {
+	if !slices.IsSortedFunc(ipps, netipx.ComparePrefix) {
+		ipps = slices.Clone(ipps)
+		slices.SortFunc(ipps, netipx.ComparePrefix)
+	}
+	h.uint(uint64(len(ipps)))
+	for _, ipp := range ipps {
+		h.addr(ipp.Addr())
+		h.uint(uint64(ipp.Bits()))
+	}
+}
+
+func (h *cfgHasher) peer(p *Peer) {
+	h.raw32(p.PublicKey.Raw32())
+	h.str(string(p.NodeID))
+	h.raw32(p.DiscoKey.Raw32())
+	h.str(p.Name)
+	h.raw32([32]byte(p.PresharedKey)) // safe: the hash does not reveal a random 256-bit key
+	h.prefixes(p.AllowedIPs)
+	h.addrPtr(p.V4MasqAddr)
+	h.addrPtr(p.V6MasqAddr)
+	h.bool(p.IsJailed)
+	h.bool(p.Disabled)
+	h.uint(uint64(p.PersistentKeepalive))
+	h.uint(uint64(len(p.Endpoints)))
+	for _, ep := range p.Endpoints {
+		h.addr(ep.Addr.Addr())
+		h.uint(uint64(ep.Addr.Port()))
+		h.uint(uint64(ep.Type))
+		h.str(ep.Region)
+	}
+	h.uint(uint64(p.IdleTimeout))
+	metrics := metricStrings(p.AllowedIPMetrics)
+	h.uint(uint64(len(metrics)))
+	for _, m := range metrics {
+		h.str(m)
+	}
+	h.raw32(p.WGEndpoint.Raw32())
+}
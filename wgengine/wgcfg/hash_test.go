@@ -0,0 +1,97 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"regexp"
+	"slices"
+	"testing"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+func TestConfigHash(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	newCfg := func() *Config {
+		return &Config{
+			PrivateKey: key.NewNode(),
+			Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+			Peers: []Peer{
+				{PublicKey: key.NewNode().Public(), AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/8")}},
+				{PublicKey: key.NewNode().Public(), AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32")}},
+				{PublicKey: key.NewNode().Public(), AllowedIPs: []netip.Prefix{pfx("100.64.0.4/32")}, PersistentKeepalive: 25},
+			},
+		}
+	}
+	cfg := newCfg()
+	want := cfg.Hash()
+	if got := cfg.Clone().Hash(); got != want {
+		t.Errorf("hash of clone differs")
+	}
+
+	reordered := cfg.Clone()
+	slices.Reverse(reordered.Peers)
+	slices.Reverse(reordered.Peers[2].AllowedIPs)
+	if got := reordered.Hash(); got != want {
+		t.Errorf("reordering peers and allowed IPs changed the hash")
+	}
+
+	rekeyed := cfg.Clone()
+	rekeyed.Peers[1].PublicKey = key.NewNode().Public()
+	if got := rekeyed.Hash(); got == want {
+		t.Errorf("changing a peer key did not change the hash")
+	}
+
+	newPrivate := cfg.Clone()
+	newPrivate.PrivateKey = key.NewNode()
+	if got := newPrivate.Hash(); got == want {
+		t.Errorf("changing the private key did not change the hash")
+	}
+
+	moreIPs := cfg.Clone()
+	moreIPs.Peers[0].AllowedIPs = append(moreIPs.Peers[0].AllowedIPs, pfx("192.168.0.0/24"))
+	if got := moreIPs.Hash(); got == want {
+		t.Errorf("adding an allowed IP did not change the hash")
+	}
+
+	newPort := cfg.Clone()
+	newPort.ListenPort = 41641
+	if got := newPort.Hash(); got == want {
+		t.Errorf("changing the listen port did not change the hash")
+	}
+	if newPort.Equal(cfg) {
+		t.Errorf("configs differing only by listen port compare equal")
+	}
+	if !newPort.Equal(newPort.Clone()) {
+		t.Errorf("clone of config with listen port not equal to original")
+	}
+
+	idle := cfg.Clone()
+	idle.Peers[0].IdleTimeout = 5 * time.Minute
+	if got := idle.Hash(); got == want {
+		t.Errorf("changing a peer's idle timeout did not change the hash")
+	}
+	if idle.Equal(cfg) {
+		t.Errorf("configs differing only by idle timeout compare equal")
+	}
+
+	metric := cfg.Clone()
+	metric.Peers[0].AllowedIPMetrics = []AllowedIP{{Prefix: pfx("10.0.0.0/8"), Metric: 5}}
+	if got := metric.Hash(); got == want {
+		t.Errorf("setting an allowed IP metric did not change the hash")
+	}
+	if !metric.Equal(metric.Clone()) {
+		t.Errorf("clone of config with allowed IP metrics not equal to original")
+	}
+
+	if got := newCfg().Hash(); got == want {
+		t.Errorf("distinct configs hashed the same")
+	}
+
+	if s := cfg.ShortHash(); !regexp.MustCompile(`^cfg:[0-9a-f]{8}$`).MatchString(s) {
+		t.Errorf("ShortHash = %q; want cfg: followed by 8 hex digits", s)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+// ParseINI parses a Config from r in the INI form used by wg(8) and
+// wg-quick(8) config files:
+//
+//	[Interface]
+//	PrivateKey = <base64>
+//	Address = 100.64.0.1/32
+//
+//	[Peer]
+//	PublicKey = <base64>
+//	AllowedIPs = 100.64.0.2/32, 10.0.0.0/8
+//	Endpoint = 198.51.100.7:41641
+//
+// The [Interface] keys are PrivateKey, ListenPort, and wg-quick's Address,
+// DNS and MTU. The [Peer] keys are PublicKey, PresharedKey, AllowedIPs,
+// Endpoint, which must be an IP address and port, and PersistentKeepalive.
+// Keys are case-insensitive, and "#" starts a comment. Other keys, such as
+// wg-quick's PostUp, are an error, as are lines outside any section.
+//
+// Errors never contain key material.
+func ParseINI(r io.Reader) (*Config, error) {
+	cfg := new(Config)
+	var section string
+	var peer *Peer // current peer, in a [Peer] section
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			switch section {
+			case "interface":
+			case "peer":
+				cfg.Peers = append(cfg.Peers, Peer{})
+				peer = &cfg.Peers[len(cfg.Peers)-1]
+			default:
+				return nil, fmt.Errorf("wgcfg: line %d: unknown section %q", n, line)
+			}
+			continue
+		}
+		k, v, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("wgcfg: line %d: missing =", n)
+		}
+		k, v = strings.ToLower(strings.TrimSpace(k)), strings.TrimSpace(v)
+		var err error
+		switch section {
+		case "interface":
+			err = cfg.handleINIInterfaceLine(k, v)
+		case "peer":
+			err = handleINIPeerLine(peer, k, v)
+		default:
+			err = fmt.Errorf("%s outside any section", k)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("wgcfg: line %d: %w", n, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := range cfg.Peers {
+		if cfg.Peers[i].PublicKey.IsZero() {
+			return nil, fmt.Errorf("wgcfg: peer %d has no PublicKey", i)
+		}
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) handleINIInterfaceLine(k, v string) error {
+	switch k {
+	case "privatekey":
+		raw, err := parseINIKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid PrivateKey: %w", err)
+		}
+		cfg.PrivateKey = key.NodePrivateFromRaw32(mem.B(raw[:]))
+		clear(raw[:])
+	case "listenport":
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid ListenPort %q", v)
+		}
+		cfg.ListenPort = uint16(port)
+	case "address":
+		for _, s := range splitINIList(v) {
+			pfx, err := parseINIPrefix(s)
+			if err != nil {
+				return fmt.Errorf("invalid Address %q", s)
+			}
+			cfg.Addresses = append(cfg.Addresses, pfx)
+		}
+	case "dns":
+		for _, s := range splitINIList(v) {
+			ip, err := netip.ParseAddr(s)
+			if err != nil {
+				return fmt.Errorf("invalid DNS %q", s)
+			}
+			cfg.DNS = append(cfg.DNS, ip)
+		}
+	case "mtu":
+		mtu, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid MTU %q", v)
+		}
+		cfg.MTU = uint16(mtu)
+	default:
+		return fmt.Errorf("unsupported [Interface] key %q", k)
+	}
+	return nil
+}
+
+func handleINIPeerLine(peer *Peer, k, v string) error {
+	switch k {
+	case "publickey":
+		raw, err := parseINIKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid PublicKey: %w", err)
+		}
+		peer.PublicKey = key.NodePublicFromRaw32(mem.B(raw[:]))
+	case "presharedkey":
+		raw, err := parseINIKey(v)
+		if err != nil {
+			return fmt.Errorf("invalid PresharedKey: %w", err)
+		}
+		peer.PresharedKey = PresharedKey(raw)
+		clear(raw[:])
+	case "allowedips":
+		for _, s := range splitINIList(v) {
+			pfx, err := parseINIPrefix(s)
+			if err != nil {
+				return fmt.Errorf("invalid AllowedIPs %q", s)
+			}
+			peer.AllowedIPs = append(peer.AllowedIPs, pfx)
+		}
+	case "endpoint":
+		ap, err := netip.ParseAddrPort(v)
+		if err != nil {
+			return fmt.Errorf("invalid Endpoint %q: want an IP address and port", v)
+		}
+		peer.Endpoints = append(peer.Endpoints, Endpoint{Addr: ap})
+	case "persistentkeepalive":
+		if strings.EqualFold(v, "off") {
+			peer.PersistentKeepalive = 0
+			break
+		}
+		secs, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid PersistentKeepalive %q", v)
+		}
+		peer.PersistentKeepalive = uint16(secs)
+	default:
+		return fmt.Errorf("unsupported [Peer] key %q", k)
+	}
+	return nil
+}
+
+// parseINIKey parses a 32-byte key in base64, as written by wg genkey.
+// Its errors do not contain s.
+func parseINIKey(s string) (raw [32]byte, err error) {
+	if len(s) != base64.StdEncoding.EncodedLen(len(raw)) {
+		return raw, fmt.Errorf("want %d base64 characters, got %d", base64.StdEncoding.EncodedLen(len(raw)), len(s))
+	}
+	var buf [33]byte // DecodedLen of the padded encoding
+	defer clear(buf[:])
+	n, err := base64.StdEncoding.Decode(buf[:], []byte(s))
+	if err != nil || n != len(raw) {
+		return raw, errors.New("not base64")
+	}
+	copy(raw[:], buf[:n])
+	return raw, nil
+}
+
+// parseINIPrefix parses a prefix, or a bare IP address as a single-address
+// prefix, as wg(8) accepts in AllowedIPs.
+func parseINIPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		return netip.ParsePrefix(s)
+	}
+	ip, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(ip, ip.BitLen()), nil
+}
+
+// splitINIList splits a comma-separated INI value into its elements.
+func splitINIList(v string) []string {
+	var ret []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,99 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestParseINI(t *testing.T) {
+	rawPriv := randomRaw32(t)
+	pub1, pub2 := key.NewNode().Public(), key.NewNode().Public()
+	rawPSK := randomRaw32(t)
+	in := `# generated by wg-quick
+[Interface]
+PrivateKey = ` + iniKey(rawPriv) + `
+ListenPort = 51820
+Address = 100.64.0.1/32, fd7a:115c:a1e0::1
+DNS = 100.100.100.100
+MTU = 1280
+
+[Peer]
+PublicKey = ` + iniKey(pub1.Raw32()) + `
+PresharedKey = ` + iniKey(rawPSK) + `
+AllowedIPs = 100.64.0.2/32, 10.0.0.0/8
+Endpoint = 198.51.100.7:41641
+PersistentKeepalive = 25 # seconds
+
+[peer]
+publickey = ` + iniKey(pub2.Raw32()) + `
+AllowedIPs = 100.64.0.3
+PersistentKeepalive = off
+`
+	cfg, err := ParseINI(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfx := netip.MustParsePrefix
+	want := &Config{
+		PrivateKey: key.NodePrivateFromRaw32(mem.B(rawPriv[:])),
+		ListenPort: 51820,
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32"), pfx("fd7a:115c:a1e0::1/128")},
+		DNS:        []netip.Addr{netip.MustParseAddr("100.100.100.100")},
+		MTU:        1280,
+		Peers: []Peer{
+			{
+				PublicKey:           pub1,
+				PresharedKey:        PresharedKey(rawPSK),
+				AllowedIPs:          []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/8")},
+				Endpoints:           []Endpoint{{Addr: netip.MustParseAddrPort("198.51.100.7:41641")}},
+				PersistentKeepalive: 25,
+			},
+			{
+				PublicKey:  pub2,
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32")},
+			},
+		},
+	}
+	if !cfg.Equal(want) {
+		t.Errorf("ParseINI =\n%+v\nwant\n%+v", cfg, want)
+	}
+}
+
+func TestParseINIErrors(t *testing.T) {
+	rawPriv := randomRaw32(t)
+	secret := iniKey(rawPriv)
+	tests := []struct {
+		name, in, wantErr string
+	}{
+		{"outside-section", "PrivateKey = " + secret + "\n", "outside any section"},
+		{"unknown-section", "[Wat]\n", `unknown section "[Wat]"`},
+		{"unsupported-key", "[Interface]\nPostUp = iptables -A FORWARD\n", `unsupported [Interface] key "postup"`},
+		{"missing-equals", "[Interface]\nPrivateKey\n", "line 2: missing ="},
+		{"bad-key", "[Interface]\nPrivateKey = " + secret[:40] + "\n", "invalid PrivateKey"},
+		{"bad-psk", "[Peer]\nPresharedKey = " + strings.Repeat("!", 44) + "\n", "invalid PresharedKey: not base64"},
+		{"hostname-endpoint", "[Peer]\nEndpoint = example.com:51820\n", "invalid Endpoint"},
+		{"no-public-key", "[Peer]\nAllowedIPs = 10.0.0.0/8\n", "peer 0 has no PublicKey"},
+		{"bad-port", "[Interface]\nListenPort = 70000\n", `invalid ListenPort "70000"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseINI(strings.NewReader(tt.in))
+			if err == nil {
+				t.Fatal("unexpected success")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error %q does not contain %q", err, tt.wantErr)
+			}
+			if strings.Contains(err.Error(), secret[:40]) {
+				t.Errorf("error %q contains the key", err)
+			}
+		})
+	}
+}
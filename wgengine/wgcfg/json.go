@@ -0,0 +1,105 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// configJSONVersion is the version of the JSON form of Config written by
+// MarshalJSON.
+//
+// Versions:
+//
+//  1. The default encoding/json form of Config, without a Version field.
+//     Metrics are in each peer's AllowedIPMetrics.
+//  2. Version is 2. Each peer's AllowedIPs are AllowedIPs, with their
+//     metrics, and it has no AllowedIPMetrics.
+const configJSONVersion = 2
+
+// Types without the methods of Config and Peer, for encoding their
+// fields with encoding/json's defaults.
+type (
+	configNoMethods Config
+	peerNoMethods   Peer
+)
+
+// configJSON is the version 2 JSON form of a Config.
+type configJSON struct {
+	Version int
+	*configNoMethods
+	Peers []peerJSON // shadows configNoMethods.Peers
+}
+
+// peerJSON is the version 2 JSON form of a Peer.
+type peerJSON struct {
+	peerNoMethods
+	AllowedIPs       []AllowedIP // shadows peerNoMethods.AllowedIPs
+	AllowedIPMetrics []AllowedIP `json:",omitempty"` // always empty; shadows peerNoMethods.AllowedIPMetrics
+}
+
+// MarshalJSON implements json.Marshaler. The Config is encoded as an
+// object with a Version field, so that UnmarshalJSON can read configs
+// stored by older versions of this package.
+func (cfg Config) MarshalJSON() ([]byte, error) {
+	j := configJSON{
+		Version:         configJSONVersion,
+		configNoMethods: (*configNoMethods)(&cfg),
+		Peers:           make([]peerJSON, len(cfg.Peers)),
+	}
+	for i := range cfg.Peers {
+		p := &cfg.Peers[i]
+		j.Peers[i] = peerJSON{
+			peerNoMethods: peerNoMethods(*p),
+			AllowedIPs:    p.AllowedIPsWithMetrics(),
+		}
+		j.Peers[i].peerNoMethods.AllowedIPMetrics = nil
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It accepts the JSON form of
+// a Config written by any version of MarshalJSON up to the current one,
+// migrating older forms, and rejects newer ones.
+func (cfg *Config) UnmarshalJSON(b []byte) error {
+	var v struct{ Version int }
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	switch v.Version {
+	case 0, 1: // version 1 has no Version field
+		var c configNoMethods
+		if err := json.Unmarshal(b, &c); err != nil {
+			return err
+		}
+		*cfg = Config(c)
+		return nil
+	case configJSONVersion:
+		var c configNoMethods
+		j := configJSON{configNoMethods: &c}
+		if err := json.Unmarshal(b, &j); err != nil {
+			return err
+		}
+		c.Peers = nil
+		for _, pj := range j.Peers {
+			p := Peer(pj.peerNoMethods)
+			p.AllowedIPs = nil
+			p.AllowedIPMetrics = nil
+			for _, a := range pj.AllowedIPs {
+				p.AllowedIPs = append(p.AllowedIPs, a.Prefix)
+				if a.Metric != 0 {
+					p.AllowedIPMetrics = append(p.AllowedIPMetrics, a)
+				}
+			}
+			c.Peers = append(c.Peers, p)
+		}
+		*cfg = Config(c)
+		return nil
+	}
+	if v.Version < 0 {
+		return fmt.Errorf("wgcfg: invalid config JSON version %d", v.Version)
+	}
+	return fmt.Errorf("wgcfg: config JSON version %d is newer than supported version %d", v.Version, configJSONVersion)
+}
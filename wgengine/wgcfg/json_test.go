@@ -0,0 +1,148 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+func TestConfigJSON(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	masq := netip.MustParseAddr("100.64.0.9")
+	cfg := &Config{
+		Name:       "tailscale0",
+		NodeID:     "nSelf1CNTRL",
+		PrivateKey: key.NewNode(),
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+		MTU:        1280,
+		DNS:        []netip.Addr{netip.MustParseAddr("100.100.100.100")},
+		ListenPort: 41641,
+		Peers: []Peer{
+			{
+				PublicKey:        key.NewNode().Public(),
+				Name:             "router",
+				AllowedIPs:       []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/8")},
+				AllowedIPMetrics: []AllowedIP{{Prefix: pfx("10.0.0.0/8"), Metric: 5}},
+				V4MasqAddr:       &masq,
+				Endpoints:        []Endpoint{{Addr: netip.MustParseAddrPort("198.51.100.7:41641"), Type: EndpointDirect}},
+				IdleTimeout:      5 * time.Minute,
+			},
+			{PublicKey: key.NewNode().Public()},
+		},
+	}
+	cfg.NetworkLogging.LogExitFlowEnabled = true
+
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"Version":2`, `"AllowedIPs":["100.64.0.2/32",{"Prefix":"10.0.0.0/8","Metric":5}]`} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("JSON %s does not contain %s", b, want)
+		}
+	}
+	if strings.Contains(string(b), "AllowedIPMetrics") {
+		t.Errorf("JSON %s contains AllowedIPMetrics", b)
+	}
+
+	var got Config
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(cfg) {
+		t.Errorf("round trip mismatch:\n got: %+v\nwant: %+v", got, cfg)
+	}
+
+	// A Config value encodes the same as a pointer to it.
+	if b2, err := json.Marshal(*cfg); err != nil || string(b2) != string(b) {
+		t.Errorf("Marshal of value = %s, %v; want %s", b2, err, b)
+	}
+}
+
+func TestConfigJSONMigrateV1(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	priv := key.NewNode()
+	pub := key.NewNode().Public()
+	want := &Config{
+		PrivateKey: priv,
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+		Peers: []Peer{{
+			PublicKey:        pub,
+			AllowedIPs:       []netip.Prefix{pfx("100.64.0.2/32"), pfx("10.0.0.0/8")},
+			AllowedIPMetrics: []AllowedIP{{Prefix: pfx("10.0.0.0/8"), Metric: 5}},
+		}},
+	}
+	// Version 1 is the default encoding of Config, without a Version.
+	v1, err := json.Marshal((*configNoMethods)(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(v1), "Version") {
+		t.Fatalf("v1 JSON %s has a Version", v1)
+	}
+
+	var got Config
+	if err := json.Unmarshal(v1, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(want) {
+		t.Errorf("migrated v1 mismatch:\n got: %+v\nwant: %+v", got, want)
+	}
+
+	// Migrated configs are written in the current version.
+	b, err := json.Marshal(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"Version":2`) {
+		t.Errorf("re-encoded JSON %s is not version 2", b)
+	}
+}
+
+func TestConfigJSONFutureVersion(t *testing.T) {
+	var cfg Config
+	err := json.Unmarshal([]byte(`{"Version":3,"Peers":[]}`), &cfg)
+	if err == nil || !strings.Contains(err.Error(), "version 3 is newer than supported version 2") {
+		t.Errorf("Unmarshal of future version = %v; want version error", err)
+	}
+}
+
+func TestConfigJSONOmitsPresharedKey(t *testing.T) {
+	var psk PresharedKey
+	for i := range psk {
+		psk[i] = byte(0xa0 + i%16)
+	}
+	cfg := &Config{Peers: []Peer{{PublicKey: key.NewNode().Public(), PresharedKey: psk}}}
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(psk[:]) // as a byte slice, base64
+	if err != nil {
+		t.Fatal(err)
+	}
+	arr, err := json.Marshal([32]byte(psk)) // as an array of numbers
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{psk.untypedHexString(), strings.Trim(string(raw), `"`), strings.Trim(string(arr), "[]"), "PresharedKey"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("JSON %s contains %s", b, secret)
+		}
+	}
+
+	var got Config
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Peers[0].PresharedKey.IsZero() {
+		t.Errorf("preshared key survived a JSON round trip")
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"tailscale.com/types/key"
+)
+
+// A KeyProvider supplies a Config's private key on demand, for deployments
+// that keep it in an agent or KMS rather than in the Config itself.
+//
+// ToUAPI fetches the key each time it applies a Config, and clears its
+// copies of the key once it is written. No other method of Config fetches
+// it: dumps, hashes and JSON describe a Config with a KeyProvider without
+// its key. Config.Equal compares implementations with ==, or, for those
+// that are not comparable, such as funcs and maps, by identity; others,
+// such as structs holding slices, are never equal, so implementations
+// should be comparable, such as pointers.
+type KeyProvider interface {
+	// PrivateKey returns the private key, which must not be zero.
+	PrivateKey() (key.NodePrivate, error)
+}
+
+// keyProvidersEqual reports whether a and b are the same KeyProvider,
+// without panicking if they are not comparable.
+func keyProvidersEqual(a, b KeyProvider) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() {
+		return false
+	}
+	if va.Comparable() && vb.Comparable() {
+		return a == b
+	}
+	switch va.Kind() {
+	case reflect.Func, reflect.Map, reflect.Slice:
+		return va.Pointer() == vb.Pointer() && (va.Kind() != reflect.Slice || va.Len() == vb.Len())
+	}
+	return false
+}
+
+// writeProvidedKey writes the private_key line for cfg's key, fetched from
+// cfg.KeyProvider, to w, unless prev already has that key.
+//
+// The line is written from buffers that are cleared once w returns, so w
+// must not retain it, as io.Writer requires. This keeps the key out of
+// memory that outlives the apply, as far as Go allows.
+func (cfg *Config) writeProvidedKey(w io.Writer, prev *Config) error {
+	k, err := cfg.KeyProvider.PrivateKey()
+	if err != nil {
+		return fmt.Errorf("wgcfg: fetching private key: %w", err)
+	}
+	defer func() { k = key.NodePrivate{} }()
+	if k.IsZero() {
+		return errors.New("wgcfg: key provider returned a zero private key")
+	}
+	if prev.PrivateKey.Equal(k) {
+		return nil
+	}
+	var text, line [80]byte
+	defer clear(text[:])
+	defer clear(line[:])
+	t, _ := k.AppendText(text[:0]) // "privkey:" followed by 64 hex digits; never fails
+	l := append(line[:0], "private_key="...)
+	l = append(l, bytes.TrimPrefix(t, []byte("privkey:"))...)
+	l = append(l, '\n')
+	_, err = w.Write(l)
+	return err
+}
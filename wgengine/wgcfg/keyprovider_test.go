@@ -0,0 +1,163 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+type fakeKeyProvider struct {
+	k     key.NodePrivate
+	err   error
+	calls int
+}
+
+func (p *fakeKeyProvider) PrivateKey() (key.NodePrivate, error) {
+	p.calls++
+	return p.k, p.err
+}
+
+// retainingWriter records what is written to it, both as copied at the
+// time and as the slices passed to Write, which it retains to check that
+// they are cleared afterwards.
+type retainingWriter struct {
+	buf      bytes.Buffer
+	retained [][]byte
+}
+
+func (w *retainingWriter) Write(p []byte) (int, error) {
+	w.retained = append(w.retained, p)
+	return w.buf.Write(p)
+}
+
+func TestKeyProvider(t *testing.T) {
+	k := key.NewNode()
+	hexKey := k.UntypedHexString()
+	prov := &fakeKeyProvider{k: k}
+	peer := key.NewNode().Public()
+	cfg := &Config{
+		KeyProvider: prov,
+		Peers:       []Peer{{PublicKey: peer}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate: %v", err)
+	}
+
+	// Nothing but ToUAPI fetches the key.
+	var logs strings.Builder
+	logf := func(format string, args ...any) { fmt.Fprintf(&logs, format+"\n", args...) }
+	cfg.Clone()
+	cfg.Equal(cfg.Clone())
+	cfg.Hash()
+	dump := cfg.Dump()
+	j, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var annotated bytes.Buffer
+	if err := cfg.WriteAnnotatedUAPI(&annotated); err != nil {
+		t.Fatal(err)
+	}
+	if prov.calls != 0 {
+		t.Fatalf("key fetched %d times before ToUAPI; want 0", prov.calls)
+	}
+	for _, s := range []string{dump, string(j), annotated.String()} {
+		if strings.Contains(s, hexKey) || strings.Contains(s, "private_key=") {
+			t.Errorf("output contains private key:\n%s", s)
+		}
+	}
+
+	var w retainingWriter
+	if err := cfg.ToUAPI(logf, &w, new(Config)); err != nil {
+		t.Fatal(err)
+	}
+	if prov.calls != 1 {
+		t.Errorf("key fetched %d times by ToUAPI; want 1", prov.calls)
+	}
+	if !strings.HasPrefix(w.buf.String(), "private_key="+hexKey+"\n") {
+		t.Errorf("ToUAPI wrote:\n%s\nwant private_key of provided key first", w.buf.String())
+	}
+	if got, err := FromUAPI(&w.buf); err != nil || !got.PrivateKey.Equal(k) {
+		t.Errorf("FromUAPI of written config = %v, %v; want provided private key", got, err)
+	}
+	// The buffer the key was written from is zeroed once ToUAPI returns.
+	if p := w.retained[0]; !bytes.Equal(p, make([]byte, len(p))) {
+		t.Errorf("private_key line not zeroed after write: %q", p)
+	}
+	if strings.Contains(logs.String(), hexKey) {
+		t.Errorf("logs contain private key:\n%s", logs.String())
+	}
+
+	// The key is not rewritten if the device already has it.
+	w = retainingWriter{}
+	if err := cfg.ToUAPI(logf, &w, &Config{PrivateKey: k, Peers: cfg.Peers}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(w.buf.String(), "private_key=") {
+		t.Errorf("ToUAPI rewrote unchanged key:\n%s", w.buf.String())
+	}
+
+	// Failures are reported without applying anything.
+	prov.err = errors.New("agent unavailable")
+	w = retainingWriter{}
+	if err := cfg.ToUAPI(logf, &w, new(Config)); err == nil || !strings.Contains(err.Error(), "agent unavailable") {
+		t.Errorf("ToUAPI with failing provider: err = %v", err)
+	}
+	if w.buf.Len() != 0 {
+		t.Errorf("ToUAPI with failing provider wrote:\n%s", w.buf.String())
+	}
+	prov.k, prov.err = key.NodePrivate{}, nil
+	if err := cfg.ToUAPI(logf, new(bytes.Buffer), new(Config)); err == nil {
+		t.Errorf("ToUAPI with zero provided key succeeded")
+	}
+
+	cfg.PrivateKey = k
+	if err := cfg.Validate(); err == nil {
+		t.Errorf("Validate of config with both a key and a provider succeeded")
+	}
+}
+
+// keyProviderFunc is a KeyProvider that is not comparable.
+type keyProviderFunc func() (key.NodePrivate, error)
+
+func (f keyProviderFunc) PrivateKey() (key.NodePrivate, error) { return f() }
+
+// keyProviderSlice is a KeyProvider of a non-comparable struct type.
+type keyProviderSlice struct{ keys []key.NodePrivate }
+
+func (p keyProviderSlice) PrivateKey() (key.NodePrivate, error) { return p.keys[0], nil }
+
+func TestKeyProviderEqual(t *testing.T) {
+	k := key.NewNode()
+	f := keyProviderFunc(func() (key.NodePrivate, error) { return k, nil })
+	g := keyProviderFunc(func() (key.NodePrivate, error) { return k, nil })
+	s := keyProviderSlice{keys: []key.NodePrivate{k}}
+	p := &fakeKeyProvider{k: k}
+	tests := []struct {
+		a, b KeyProvider
+		want bool
+	}{
+		{nil, nil, true},
+		{p, nil, false},
+		{p, p, true},
+		{p, &fakeKeyProvider{k: k}, false},
+		{f, f, true},
+		{f, g, false},
+		{f, p, false},
+		{s, s, false}, // neither comparable nor with an identity
+	}
+	for i, tt := range tests {
+		a, b := &Config{KeyProvider: tt.a}, &Config{KeyProvider: tt.b}
+		if got := a.Equal(b); got != tt.want {
+			t.Errorf("%d: Equal(%T, %T) = %v; want %v", i, tt.a, tt.b, got, tt.want)
+		}
+	}
+}
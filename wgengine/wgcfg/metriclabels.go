@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import "strings"
+
+// MetricLabels returns labels identifying p for per-peer metrics, such as
+// handshake latency or traffic, exported to Prometheus:
+//
+//	peer_key_short  the short form of p's public key, like "IMTBr"
+//	name            p's Name, if any
+//	region          the DERP region of p's first DERP endpoint, if any
+//
+// Optional labels are omitted when empty. Exporters whose label names
+// are fixed per metric, as with Prometheus vectors, should use "" for
+// them. The labels are stable for as long as the peer keeps its key,
+// name and DERP region, so a peer's series survive reconfiguration.
+//
+// The labels deliberately leave out the full key and the endpoints, but
+// every peer still makes its own series for each metric labeled with
+// them. On large tailnets, that is one series per peer per metric, which
+// can be many thousands; export per-peer metrics only for a bounded set
+// of peers there, or aggregate by region instead. The short key is short
+// for readability, not uniqueness: two peers may share it, and their
+// series then collide unless their names differ.
+func (p *Peer) MetricLabels() map[string]string {
+	labels := map[string]string{
+		"peer_key_short": strings.Trim(p.PublicKey.ShortString(), "[]"),
+	}
+	if p.Name != "" {
+		labels["name"] = p.Name
+	}
+	for _, ep := range p.Endpoints {
+		if ep.Type == EndpointDERP && ep.Region != "" {
+			labels["region"] = ep.Region
+			break
+		}
+	}
+	return labels
+}
@@ -0,0 +1,53 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"maps"
+	"net/netip"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestMetricLabels(t *testing.T) {
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct := Endpoint{Addr: netip.MustParseAddrPort("1.2.3.4:41641"), Type: EndpointDirect}
+	derp := func(region string) Endpoint {
+		return Endpoint{Addr: netip.MustParseAddrPort("127.3.3.40:1"), Type: EndpointDERP, Region: region}
+	}
+
+	tests := []struct {
+		name string
+		peer Peer
+		want map[string]string
+	}{
+		{
+			name: "key-only",
+			peer: Peer{PublicKey: k, Endpoints: []Endpoint{direct}},
+			want: map[string]string{"peer_key_short": "IMTBr"},
+		},
+		{
+			name: "all",
+			peer: Peer{PublicKey: k, Name: "laptop", Endpoints: []Endpoint{direct, derp("nyc"), derp("sfo")}},
+			want: map[string]string{"peer_key_short": "IMTBr", "name": "laptop", "region": "nyc"},
+		},
+		{
+			name: "derp-without-region",
+			peer: Peer{PublicKey: k, Endpoints: []Endpoint{derp("")}},
+			want: map[string]string{"peer_key_short": "IMTBr"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.peer.MetricLabels(); !maps.Equal(got, tt.want) {
+				t.Errorf("MetricLabels = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
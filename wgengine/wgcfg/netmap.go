@@ -0,0 +1,96 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// A SimpleNetmap is a simplified, JSON-friendly network map: the self node's
+// key and addresses, and its peers. It bridges hand-written or exported
+// control-plane data and Config, such as for tests and tools, without the
+// full netmap.NetworkMap.
+type SimpleNetmap struct {
+	PrivateKey key.NodePrivate
+	Addresses  []netip.Prefix
+	Peers      []SimpleNode
+}
+
+// A SimpleNode is a peer in a SimpleNetmap.
+type SimpleNode struct {
+	Name      string               // optional; used to label the peer in logs
+	StableID  tailcfg.StableNodeID `json:",omitempty"`
+	Key       key.NodePublic       // required
+	DiscoKey  key.DiscoPublic      `json:",omitempty"`
+	Addresses []netip.Prefix       // required; the node's own addresses
+	Routes    []netip.Prefix       `json:",omitempty"` // subnet routes, in addition to Addresses
+	Endpoints []Endpoint           `json:",omitempty"`
+
+	// DERPRegion is the code of the node's DERP home region, such as
+	// "nyc", for labeling it in logs. See SimpleNetmap.Regions.
+	DERPRegion string `json:",omitempty"`
+}
+
+// ParseSimpleNetmap parses the JSON encoding of a SimpleNetmap and reports
+// whether it is valid, as for SimpleNetmap.Config.
+func ParseSimpleNetmap(b []byte) (*SimpleNetmap, error) {
+	nm := new(SimpleNetmap)
+	if err := json.Unmarshal(b, nm); err != nil {
+		return nil, fmt.Errorf("wgcfg: parsing netmap: %w", err)
+	}
+	if _, err := nm.Config(); err != nil {
+		return nil, err
+	}
+	return nm, nil
+}
+
+// Config returns the Config for nm. Each peer's allowed IPs are its
+// addresses followed by its routes.
+//
+// It is an error for nm to lack a private key, for a peer to lack a key
+// or addresses, or for two peers to share a key.
+func (nm *SimpleNetmap) Config() (*Config, error) {
+	var b Builder
+	b.SetPrivateKey(nm.PrivateKey)
+	for _, n := range nm.Peers {
+		if len(n.Addresses) == 0 {
+			b.errs = append(b.errs, fmt.Errorf("peer %v: no addresses", n.Key.ShortString()))
+		}
+		pb := NewPeerBuilder(n.Key).DiscoKey(n.DiscoKey).Name(n.Name)
+		pb.peer.NodeID = n.StableID
+		for _, ipp := range n.Addresses {
+			pb = pb.AllowIP(ipp)
+		}
+		for _, ipp := range n.Routes {
+			pb = pb.AllowIP(ipp)
+		}
+		for _, ep := range n.Endpoints {
+			pb = pb.Endpoint(ep)
+		}
+		b.AddPeer(pb)
+	}
+	cfg, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	cfg.Addresses = append(cfg.Addresses, nm.Addresses...)
+	return cfg, nil
+}
+
+// Regions returns the DERP home region codes of nm's peers that have one,
+// for wglog.Logger.SetPeerRegions.
+func (nm *SimpleNetmap) Regions() map[key.NodePublic]string {
+	regions := make(map[key.NodePublic]string)
+	for _, n := range nm.Peers {
+		if n.DERPRegion != "" {
+			regions[n.Key] = n.DERPRegion
+		}
+	}
+	return regions
+}
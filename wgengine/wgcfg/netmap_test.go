@@ -0,0 +1,102 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding"
+	"fmt"
+	"maps"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+func TestSimpleNetmap(t *testing.T) {
+	priv := key.NewNode()
+	k1, k2 := key.NewNode().Public(), key.NewNode().Public()
+	j := fmt.Sprintf(`{
+		"PrivateKey": %q,
+		"Addresses": ["100.64.0.1/32"],
+		"Peers": [
+			{
+				"Name": "laptop",
+				"StableID": "nLaptopCNTRL",
+				"Key": %q,
+				"Addresses": ["100.64.0.2/32"],
+				"Endpoints": [{"Addr": "1.2.3.4:41641", "Type": "direct"}],
+				"DERPRegion": "nyc"
+			},
+			{
+				"Name": "router",
+				"Key": %q,
+				"Addresses": ["100.64.0.3/32"],
+				"Routes": ["192.168.0.0/24"]
+			}
+		]
+	}`, mustText(priv), mustText(k1), mustText(k2))
+
+	nm, err := ParseSimpleNetmap([]byte(j))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := nm.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfx := netip.MustParsePrefix
+	want := &Config{
+		PrivateKey: priv,
+		Addresses:  []netip.Prefix{pfx("100.64.0.1/32")},
+		Peers: []Peer{
+			{
+				PublicKey:  k1,
+				NodeID:     "nLaptopCNTRL",
+				Name:       "laptop",
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32")},
+				Endpoints:  []Endpoint{{Addr: netip.MustParseAddrPort("1.2.3.4:41641"), Type: EndpointDirect}},
+			},
+			{
+				PublicKey:  k2,
+				Name:       "router",
+				AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32"), pfx("192.168.0.0/24")},
+			},
+		},
+	}
+	if !cfg.Equal(want) {
+		t.Errorf("got %+v\nwant %+v", cfg, want)
+	}
+	if got, want := nm.Regions(), map[key.NodePublic]string{k1: "nyc"}; !maps.Equal(got, want) {
+		t.Errorf("Regions = %v; want %v", got, want)
+	}
+}
+
+func TestSimpleNetmapErrors(t *testing.T) {
+	k := key.NewNode().Public()
+	tests := []struct {
+		name, json, wantErr string
+	}{
+		{"syntax", `{`, "parsing netmap"},
+		{"no-private-key", fmt.Sprintf(`{"Peers": [{"Key": %q, "Addresses": ["100.64.0.2/32"]}]}`, mustText(k)), "private key is zero"},
+		{"no-addresses", fmt.Sprintf(`{"PrivateKey": %q, "Peers": [{"Key": %q}]}`, mustText(key.NewNode()), mustText(k)), "no addresses"},
+		{"no-key", fmt.Sprintf(`{"PrivateKey": %q, "Peers": [{"Addresses": ["100.64.0.2/32"]}]}`, mustText(key.NewNode())), "peer public key is zero"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSimpleNetmap([]byte(tt.json))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseSimpleNetmap error = %v; want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func mustText(k encoding.TextMarshaler) []byte {
+	b, err := k.MarshalText()
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -102,6 +102,7 @@ func WGCfg(nm *netmap.NetworkMap, logf logger.Logf, flags netmap.WGConfigFlags,
 
 		cfg.Peers = append(cfg.Peers, wgcfg.Peer{
 			PublicKey: peer.Key(),
+			NodeID:    peer.StableID(),
 			DiscoKey:  peer.DiscoKey(),
 		})
 		cpeer := &cfg.Peers[len(cfg.Peers)-1]
@@ -0,0 +1,148 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"slices"
+
+	"go4.org/netipx"
+)
+
+// NormalizeAllowedIPs canonicalizes each peer's AllowedIPs in place:
+// prefixes are masked, exact duplicates are removed, and the result is
+// sorted. The prefixes of AllowedIPMetrics are masked to match.
+//
+// If merge is true, pairs of adjacent prefixes that together make up their
+// parent prefix (such as 10.0.0.0/25 and 10.0.0.128/25) are also merged into
+// the parent, repeatedly. Merging is conservative: because WireGuard routes
+// by longest prefix match across all peers, two prefixes are only merged if
+// no other peer has the parent prefix, so that routing is unchanged. For
+// the same reason, prefixes are only merged if they have the same metric,
+// as does the parent if the peer already has it, and the parent gets that
+// metric.
+func (cfg *Config) NormalizeAllowedIPs(merge bool) {
+	for i := range cfg.Peers {
+		p := &cfg.Peers[i]
+		p.AllowedIPs = dedupePrefixes(p.AllowedIPs)
+		for j := range p.AllowedIPMetrics {
+			a := &p.AllowedIPMetrics[j]
+			a.Prefix = a.Prefix.Masked()
+		}
+	}
+	if !merge {
+		return
+	}
+
+	// owner maps each prefix to the index of the peer that has it,
+	// or -1 if more than one peer does.
+	owner := make(map[netip.Prefix]int)
+	for i, p := range cfg.Peers {
+		for _, ipp := range p.AllowedIPs {
+			if o, ok := owner[ipp]; ok && o != i {
+				owner[ipp] = -1
+			} else {
+				owner[ipp] = i
+			}
+		}
+	}
+	for i := range cfg.Peers {
+		p := &cfg.Peers[i]
+		// metrics maps each of p's prefixes, including merged parents,
+		// to its metric.
+		metrics := make(map[netip.Prefix]uint32, len(p.AllowedIPs))
+		for _, ipp := range p.AllowedIPs {
+			metrics[ipp] = p.metric(ipp)
+		}
+		p.AllowedIPs = mergePrefixes(p.AllowedIPs, func(parent, lower, upper netip.Prefix) bool {
+			m := metrics[lower]
+			if metrics[upper] != m {
+				return false
+			}
+			if mp, ok := metrics[parent]; ok && mp != m {
+				return false
+			}
+			if o, ok := owner[parent]; ok && o != i {
+				return false
+			}
+			owner[parent] = i
+			metrics[parent] = m
+			return true
+		})
+		if len(p.AllowedIPMetrics) > 0 {
+			// Rebuild the metrics, dropping those of merged prefixes.
+			p.AllowedIPMetrics = nil
+			for _, ipp := range p.AllowedIPs {
+				if m := metrics[ipp]; m != 0 {
+					p.AllowedIPMetrics = append(p.AllowedIPMetrics, AllowedIP{Prefix: ipp, Metric: m})
+				}
+			}
+		}
+	}
+}
+
+// dedupePrefixes returns ipps masked, sorted, and without duplicates.
+// It modifies ipps in place.
+func dedupePrefixes(ipps []netip.Prefix) []netip.Prefix {
+	for i, ipp := range ipps {
+		ipps[i] = ipp.Masked()
+	}
+	slices.SortFunc(ipps, netipx.ComparePrefix)
+	return slices.Compact(ipps)
+}
+
+// mergePrefixes repeatedly merges pairs of sibling prefixes in ipps, which
+// must be the sorted and deduplicated output of dedupePrefixes, into their
+// parent, provided canMerge reports true for the parent and the pair,
+// its lower and upper halves. It returns the sorted result.
+func mergePrefixes(ipps []netip.Prefix, canMerge func(parent, lower, upper netip.Prefix) bool) []netip.Prefix {
+	have := make(map[netip.Prefix]bool, len(ipps))
+	for _, ipp := range ipps {
+		have[ipp] = true
+	}
+	for merged := true; merged; {
+		merged = false
+		for _, ipp := range ipps {
+			if !have[ipp] || ipp.Bits() == 0 {
+				continue
+			}
+			parent := netip.PrefixFrom(ipp.Addr(), ipp.Bits()-1).Masked()
+			if parent.Addr() != ipp.Addr() {
+				continue // ipp is the upper half; handle the pair from the lower half
+			}
+			upper := netip.PrefixFrom(setBit(ipp.Addr(), ipp.Bits()-1), ipp.Bits())
+			if !have[upper] || !canMerge(parent, ipp, upper) {
+				continue
+			}
+			delete(have, ipp)
+			delete(have, upper)
+			if !have[parent] {
+				have[parent] = true
+				ipps = append(ipps, parent)
+			}
+			merged = true
+		}
+	}
+	ipps = slices.DeleteFunc(ipps, func(ipp netip.Prefix) bool {
+		if !have[ipp] {
+			return true
+		}
+		delete(have, ipp) // so that any duplicate is removed
+		return false
+	})
+	slices.SortFunc(ipps, netipx.ComparePrefix)
+	return ipps
+}
+
+// setBit returns ip with bit i set, counting from the most significant bit.
+func setBit(ip netip.Addr, i int) netip.Addr {
+	if ip.Is4() {
+		a := ip.As4()
+		a[i/8] |= 0x80 >> (i % 8)
+		return netip.AddrFrom4(a)
+	}
+	a := ip.As16()
+	a[i/8] |= 0x80 >> (i % 8)
+	return netip.AddrFrom16(a)
+}
@@ -0,0 +1,134 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func prefixes(ss ...string) []netip.Prefix {
+	var ret []netip.Prefix
+	for _, s := range ss {
+		ret = append(ret, netip.MustParsePrefix(s))
+	}
+	return ret
+}
+
+func TestNormalizeAllowedIPs(t *testing.T) {
+	tests := []struct {
+		name  string
+		merge bool
+		in    [][]netip.Prefix // per peer
+		want  [][]netip.Prefix
+	}{
+		{
+			name: "dedupe_and_sort",
+			in: [][]netip.Prefix{
+				prefixes("100.64.0.2/32", "fd7a:115c:a1e0::2/128", "10.0.0.0/8", "100.64.0.2/32", "10.1.2.3/8", "fd7a:115c:a1e0::2/128"),
+			},
+			want: [][]netip.Prefix{
+				prefixes("10.0.0.0/8", "100.64.0.2/32", "fd7a:115c:a1e0::2/128"),
+			},
+		},
+		{
+			name: "no_merge_without_flag",
+			in:   [][]netip.Prefix{prefixes("10.0.0.0/25", "10.0.0.128/25")},
+			want: [][]netip.Prefix{prefixes("10.0.0.0/25", "10.0.0.128/25")},
+		},
+		{
+			name:  "merge_v4",
+			merge: true,
+			in:    [][]netip.Prefix{prefixes("10.0.0.128/25", "10.0.1.0/24", "10.0.0.0/25", "192.168.0.0/24")},
+			want:  [][]netip.Prefix{prefixes("10.0.0.0/23", "192.168.0.0/24")},
+		},
+		{
+			name:  "merge_v6",
+			merge: true,
+			in:    [][]netip.Prefix{prefixes("2001:db8::/33", "2001:db8:8000::/33", "2001:dba::/32")},
+			want:  [][]netip.Prefix{prefixes("2001:db8::/32", "2001:dba::/32")},
+		},
+		{
+			name:  "merge_into_existing_parent",
+			merge: true,
+			in:    [][]netip.Prefix{prefixes("10.0.0.0/24", "10.0.0.0/25", "10.0.0.128/25")},
+			want:  [][]netip.Prefix{prefixes("10.0.0.0/24")},
+		},
+		{
+			name:  "non_adjacent",
+			merge: true,
+			in:    [][]netip.Prefix{prefixes("10.0.0.128/25", "10.0.1.0/25", "100.64.0.1/32", "100.64.0.2/32")},
+			want:  [][]netip.Prefix{prefixes("10.0.0.128/25", "10.0.1.0/25", "100.64.0.1/32", "100.64.0.2/32")},
+		},
+		{
+			name:  "parent_owned_by_other_peer",
+			merge: true,
+			in: [][]netip.Prefix{
+				prefixes("10.0.0.0/25", "10.0.0.128/25", "fd00::/65", "fd00:0:0:0:8000::/65"),
+				prefixes("10.0.0.0/24"),
+			},
+			want: [][]netip.Prefix{
+				prefixes("10.0.0.0/25", "10.0.0.128/25", "fd00::/64"),
+				prefixes("10.0.0.0/24"),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{}
+			for _, ipps := range tt.in {
+				cfg.Peers = append(cfg.Peers, Peer{AllowedIPs: ipps})
+			}
+			cfg.NormalizeAllowedIPs(tt.merge)
+			var got [][]netip.Prefix
+			for _, p := range cfg.Peers {
+				got = append(got, p.AllowedIPs)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got  %v\nwant %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeAllowedIPsMetrics(t *testing.T) {
+	pfx := netip.MustParsePrefix
+	cfg := &Config{Peers: []Peer{{
+		AllowedIPs: prefixes(
+			"10.0.0.0/25", "10.0.0.128/25", // same metric: merged
+			"10.1.0.0/25", "10.1.0.128/25", // different metrics: kept
+			"10.2.0.0/25", "10.2.0.128/25", "10.2.0.0/24", // parent with another metric: kept
+			"10.3.0.1/24", // unmasked
+		),
+		AllowedIPMetrics: []AllowedIP{
+			{Prefix: pfx("10.0.0.0/25"), Metric: 5},
+			{Prefix: pfx("10.0.0.128/25"), Metric: 5},
+			{Prefix: pfx("10.1.0.0/25"), Metric: 5},
+			{Prefix: pfx("10.2.0.0/24"), Metric: 7},
+			{Prefix: pfx("10.3.0.1/24"), Metric: 9},
+		},
+	}}}
+	cfg.NormalizeAllowedIPs(true)
+
+	p := cfg.Peers[0]
+	want := []AllowedIP{
+		{Prefix: pfx("10.0.0.0/24"), Metric: 5},
+		{Prefix: pfx("10.2.0.0/24"), Metric: 7},
+		{Prefix: pfx("10.3.0.0/24"), Metric: 9},
+		{Prefix: pfx("10.1.0.0/25"), Metric: 5},
+		{Prefix: pfx("10.1.0.128/25")},
+		{Prefix: pfx("10.2.0.0/25")},
+		{Prefix: pfx("10.2.0.128/25")},
+	}
+	if got := p.AllowedIPsWithMetrics(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+	for _, a := range p.AllowedIPMetrics {
+		if a.Metric == 0 || !slices.Contains(p.AllowedIPs, a.Prefix) {
+			t.Errorf("stale metric %v", a)
+		}
+	}
+}
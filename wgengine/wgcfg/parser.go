@@ -65,8 +65,10 @@ func memROCut(s mem.RO, sep byte) (before, after mem.RO, found bool) {
 }
 
 // FromUAPI generates a Config from r.
-// r should be generated by calling device.IpcGetOperation;
-// it is not compatible with other uapi streams.
+// r should be generated by calling device.IpcGetOperation or
+// Config.WriteAnnotatedUAPI; it is not compatible with other uapi streams.
+// Comment lines are ignored, except for the peer name comments written by
+// WriteAnnotatedUAPI, which set Peer.Name.
 func FromUAPI(r io.Reader) (*Config, error) {
 	cfg := new(Config)
 	var peer *Peer // current peer being operated on
@@ -78,6 +80,13 @@ func FromUAPI(r io.Reader) (*Config, error) {
 		if line.Len() == 0 {
 			continue
 		}
+		if mem.HasPrefix(line, mem.S("#")) {
+			// A comment, as written by WriteAnnotatedUAPI.
+			if peer != nil && mem.HasPrefix(line, mem.S(uapiNameComment)) {
+				peer.Name = line.SliceFrom(len(uapiNameComment)).StringCopy()
+			}
+			continue
+		}
 		key, value, ok := memROCut(line, '=')
 		if !ok {
 			return nil, fmt.Errorf("failed to cut line %q on =", line.StringCopy())
@@ -124,7 +133,13 @@ func (cfg *Config) handleDeviceLine(k, value mem.RO, valueBytes []byte) error {
 		if err != nil {
 			return err
 		}
-	case k.EqualString("listen_port") || k.EqualString("fwmark"):
+	case k.EqualString("listen_port"):
+		n, err := mem.ParseUint(value, 10, 16)
+		if err != nil {
+			return err
+		}
+		cfg.ListenPort = uint16(n)
+	case k.EqualString("fwmark"):
 	// ignore
 	default:
 		return fmt.Errorf("unexpected IpcGetOperation key: %q", k.StringCopy())
@@ -167,13 +182,22 @@ func (cfg *Config) handlePeerLine(peer *Peer, k, value mem.RO, valueBytes []byte
 		if err != nil {
 			return err
 		}
+		if !ipp.IsValid() {
+			// UnmarshalText accepts an empty value as the zero Prefix.
+			return fmt.Errorf("invalid allowed_ip %q for peer %q", valueBytes, peer.PublicKey.ShortString())
+		}
 		peer.AllowedIPs = append(peer.AllowedIPs, ipp)
 	case k.EqualString("protocol_version"):
 		if !value.EqualString("1") {
 			return fmt.Errorf("invalid protocol version: %q", value.StringCopy())
 		}
+	case k.EqualString("preshared_key"):
+		psk, err := parsePresharedKey(valueBytes)
+		if err != nil {
+			return fmt.Errorf("peer %q: %w", peer.PublicKey.ShortString(), err)
+		}
+		peer.PresharedKey = psk
 	case k.EqualString("replace_allowed_ips") ||
-		k.EqualString("preshared_key") ||
 		k.EqualString("last_handshake_time_sec") ||
 		k.EqualString("last_handshake_time_nsec") ||
 		k.EqualString("tx_bytes") ||
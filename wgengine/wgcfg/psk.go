@@ -0,0 +1,82 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// PresharedKey is a WireGuard preshared key, mixed into the handshake in
+// addition to the peers' public keys for defense in depth.
+// The zero value means no preshared key.
+//
+// Its String and GoString methods never reveal the key, so that it is not
+// logged by accident, and Peer.PresharedKey is left out of the JSON form
+// of a Config.
+type PresharedKey [32]byte
+
+// ParsePresharedKey parses a preshared key from its 64 character hex
+// representation, as used by UAPI.
+func ParsePresharedKey(s string) (PresharedKey, error) {
+	b := []byte(s)
+	defer clear(b)
+	return parsePresharedKey(b)
+}
+
+// parsePresharedKey is like ParsePresharedKey, but parses from b,
+// so that the caller can avoid copying the key into a string.
+func parsePresharedKey(b []byte) (PresharedKey, error) {
+	var k PresharedKey
+	if len(b) != hex.EncodedLen(len(k)) {
+		return PresharedKey{}, fmt.Errorf("invalid preshared key: want %d hex characters, got %d", hex.EncodedLen(len(k)), len(b))
+	}
+	if _, err := hex.Decode(k[:], b); err != nil {
+		k.Zeroize()
+		return PresharedKey{}, errors.New("invalid preshared key: not hex")
+	}
+	return k, nil
+}
+
+// IsZero reports whether k is the zero value, meaning no preshared key.
+func (k PresharedKey) IsZero() bool {
+	return subtle.ConstantTimeCompare(k[:], make([]byte, len(k))) == 1
+}
+
+// Equal reports whether k and o are equal, in constant time.
+func (k PresharedKey) Equal(o PresharedKey) bool {
+	return subtle.ConstantTimeCompare(k[:], o[:]) == 1
+}
+
+// untypedHexString returns k in hex, for UAPI.
+func (k PresharedKey) untypedHexString() string {
+	return hex.EncodeToString(k[:])
+}
+
+// Zeroize overwrites k with zeros.
+func (k *PresharedKey) Zeroize() {
+	clear(k[:])
+}
+
+// String returns a placeholder that does not reveal k.
+func (k PresharedKey) String() string {
+	if k.IsZero() {
+		return "psk:none"
+	}
+	return "psk:redacted"
+}
+
+// GoString is like String, so that k is not revealed by %#v either.
+func (k PresharedKey) GoString() string { return k.String() }
+
+// ZeroizePresharedKeys overwrites the preshared keys of all of cfg's peers
+// with zeros. Callers should use it when tearing down a Config that is no
+// longer needed.
+func (cfg *Config) ZeroizePresharedKeys() {
+	for i := range cfg.Peers {
+		cfg.Peers[i].PresharedKey.Zeroize()
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tailscale/wireguard-go/device"
+	"tailscale.com/types/key"
+)
+
+func newPSK(t *testing.T) PresharedKey {
+	t.Helper()
+	var k PresharedKey
+	if _, err := rand.Read(k[:]); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestParsePresharedKey(t *testing.T) {
+	k := newPSK(t)
+	got, err := ParsePresharedKey(k.untypedHexString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(k) {
+		t.Errorf("round trip changed key")
+	}
+	for _, bad := range []string{"", "abcd", strings.Repeat("zz", 32), strings.Repeat("00", 33)} {
+		if _, err := ParsePresharedKey(bad); err == nil {
+			t.Errorf("ParsePresharedKey(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestPresharedKeyUAPI(t *testing.T) {
+	psk := newPSK(t)
+	cfg := &Config{
+		PrivateKey: key.NewNode(),
+		Peers: []Peer{{
+			PublicKey:    key.NewNode().Public(),
+			PresharedKey: psk,
+			AllowedIPs:   []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+		}},
+	}
+	// wireguard-go logs from its own goroutines.
+	var (
+		mu   sync.Mutex
+		logs strings.Builder
+	)
+	logf := func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(&logs, format+"\n", args...)
+	}
+	dev := NewDevice(newNilTun(), new(noopBind), &device.Logger{Verbosef: logf, Errorf: logf})
+	defer dev.Close()
+
+	if err := ReconfigDevice(dev, cfg, logf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := DeviceConfig(dev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Peers[0].PresharedKey.Equal(psk) {
+		t.Errorf("preshared key did not round trip through wireguard-go")
+	}
+
+	// Removing the key is written as a change, too.
+	cfg.Peers[0].PresharedKey = PresharedKey{}
+	if err := ReconfigDevice(dev, cfg, logf); err != nil {
+		t.Fatal(err)
+	}
+	if got, err = DeviceConfig(dev); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Peers[0].PresharedKey.IsZero() {
+		t.Errorf("preshared key not removed")
+	}
+
+	// Neither wireguard-go's logs nor formatting a Peer reveal the key.
+	// Read the logs once the device has stopped logging.
+	dev.Close()
+	logf("%v %+v %#v %s", cfg.Peers[0], got.Peers[0], psk, psk)
+	if s, h := logs.String(), psk.untypedHexString(); strings.Contains(s, h) {
+		t.Errorf("logs contain the preshared key:\n%s", s)
+	}
+	if !strings.Contains(logs.String(), "psk:redacted") {
+		t.Errorf("logs do not contain the placeholder:\n%s", logs.String())
+	}
+
+	cfg.Peers[0].PresharedKey = psk
+	cfg.ZeroizePresharedKeys()
+	if !cfg.Peers[0].PresharedKey.IsZero() {
+		t.Errorf("ZeroizePresharedKeys left a key")
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"cmp"
+	"slices"
+
+	"tailscale.com/tailcfg"
+	"tailscale.com/types/key"
+)
+
+// A KeyRotation is a peer whose public key changed between two Configs.
+type KeyRotation struct {
+	NodeID tailcfg.StableNodeID
+	Old    key.NodePublic
+	New    key.NodePublic
+}
+
+// KeyRotations reports the peers that rotated their keys between old and
+// new: those with the same NodeID in both but different public keys,
+// sorted by NodeID. Peers without a NodeID are ignored, as are peers that
+// were only added or only removed.
+func KeyRotations(old, new *Config) []KeyRotation {
+	oldKeys := make(map[tailcfg.StableNodeID]key.NodePublic, len(old.Peers))
+	for _, p := range old.Peers {
+		if p.NodeID != "" {
+			oldKeys[p.NodeID] = p.PublicKey
+		}
+	}
+	var ret []KeyRotation
+	for _, p := range new.Peers {
+		if p.NodeID == "" {
+			continue
+		}
+		if k, ok := oldKeys[p.NodeID]; ok && k != p.PublicKey {
+			ret = append(ret, KeyRotation{NodeID: p.NodeID, Old: k, New: p.PublicKey})
+		}
+	}
+	slices.SortFunc(ret, func(a, b KeyRotation) int { return cmp.Compare(a.NodeID, b.NodeID) })
+	return ret
+}
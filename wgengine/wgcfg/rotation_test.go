@@ -0,0 +1,41 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"slices"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+func TestKeyRotations(t *testing.T) {
+	kA1, kA2 := key.NewNode().Public(), key.NewNode().Public()
+	kB := key.NewNode().Public()
+	kC := key.NewNode().Public()
+	kD := key.NewNode().Public()
+	kNoID1, kNoID2 := key.NewNode().Public(), key.NewNode().Public()
+
+	old := &Config{Peers: []Peer{
+		{NodeID: "nA", PublicKey: kA1},
+		{NodeID: "nB", PublicKey: kB},
+		{NodeID: "nC", PublicKey: kC}, // removed
+		{PublicKey: kNoID1},
+	}}
+	new := &Config{Peers: []Peer{
+		{NodeID: "nD", PublicKey: kD}, // added
+		{NodeID: "nB", PublicKey: kB}, // unchanged
+		{NodeID: "nA", PublicKey: kA2},
+		{PublicKey: kNoID2}, // no NodeID; indistinguishable from add and remove
+	}}
+
+	got := KeyRotations(old, new)
+	want := []KeyRotation{{NodeID: "nA", Old: kA1, New: kA2}}
+	if !slices.Equal(got, want) {
+		t.Errorf("KeyRotations = %+v; want %+v", got, want)
+	}
+	if got := KeyRotations(old, old); len(got) != 0 {
+		t.Errorf("KeyRotations(old, old) = %+v; want none", got)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+
+	"github.com/gaissmai/bart"
+)
+
+// PreferredRoutes maps destination addresses to the peer preferred for
+// them: by longest prefix match over the peers' AllowedIPs, and then by
+// metric (see Peer.AllowedIPMetrics). It describes the routing intended
+// by the config, for logging and diagnostics.
+//
+// It does not predict where WireGuard sends traffic: WireGuard ignores
+// metrics, and when several peers claim the same prefix, it uses the one
+// that claimed it most recently, which depends on the history of updates
+// that configured it.
+type PreferredRoutes struct {
+	peers []Peer
+	t     bart.Table[route]
+}
+
+// route is the preferred route for a prefix in a PreferredRoutes.
+type route struct {
+	peer   int // index into peers
+	metric uint32
+}
+
+// PreferredRoutes returns the PreferredRoutes of cfg. It does not alias cfg.
+//
+// Disabled peers are not routed to. If more than one peer has the same
+// prefix, the one with the lowest metric wins. Among those, the one with
+// the greatest public key wins, so that the result does not depend on the
+// order of cfg.Peers.
+func (cfg *Config) PreferredRoutes() *PreferredRoutes {
+	pr := new(PreferredRoutes)
+	best := make(map[netip.Prefix]route)
+	for _, i := range sortedPeerIndices(cfg.Peers) {
+		p := &cfg.Peers[i]
+		if p.Disabled {
+			continue
+		}
+		pr.peers = append(pr.peers, *p.Clone())
+		for _, a := range p.AllowedIPsWithMetrics() {
+			r := route{peer: len(pr.peers) - 1, metric: a.Metric}
+			if old, ok := best[a.Prefix]; ok && old.metric < r.metric {
+				continue
+			}
+			best[a.Prefix] = r
+			pr.t.Insert(a.Prefix, r)
+		}
+	}
+	return pr
+}
+
+// Lookup returns the peer preferred for traffic to addr,
+// and reports whether there is one.
+func (pr *PreferredRoutes) Lookup(addr netip.Addr) (Peer, bool) {
+	p, _, ok := pr.LookupRoute(addr)
+	return p, ok
+}
+
+// LookupRoute is like Lookup, but also returns the allowed IP of the peer
+// that matched addr, with its metric.
+func (pr *PreferredRoutes) LookupRoute(addr netip.Addr) (Peer, AllowedIP, bool) {
+	pfx, r, ok := pr.t.Lookup(addr)
+	if !ok {
+		return Peer{}, AllowedIP{}, false
+	}
+	return pr.peers[r.peer], AllowedIP{Prefix: pfx, Metric: r.metric}, true
+}
@@ -0,0 +1,116 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"encoding/json"
+	"net/netip"
+	"slices"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestPreferredRoutes(t *testing.T) {
+	exit := Peer{PublicKey: key.NewNode().Public(), Name: "exit", AllowedIPs: prefixes("0.0.0.0/0", "::/0")}
+	subnet := Peer{PublicKey: key.NewNode().Public(), Name: "subnet", AllowedIPs: prefixes("10.0.0.0/8", "fd00::/8")}
+	node := Peer{PublicKey: key.NewNode().Public(), Name: "node", AllowedIPs: prefixes("10.1.2.3/32", "100.64.0.1/32", "fd00:1::/64")}
+	off := Peer{PublicKey: key.NewNode().Public(), Name: "off", AllowedIPs: prefixes("192.168.0.0/16"), Disabled: true}
+	cfg := &Config{Peers: []Peer{exit, subnet, node, off}}
+	pr := cfg.PreferredRoutes()
+
+	tests := []struct {
+		addr string
+		want string // peer name; empty for none
+	}{
+		{"8.8.8.8", "exit"},
+		{"10.9.9.9", "subnet"},
+		{"10.1.2.3", "node"},
+		{"10.1.2.4", "subnet"},
+		{"100.64.0.1", "node"},
+		{"192.168.1.1", "exit"}, // the disabled peer is not routed to
+		{"2001:db8::1", "exit"},
+		{"fd00:2::1", "subnet"},
+		{"fd00:1::1", "node"},
+	}
+	for _, tt := range tests {
+		p, ok := pr.Lookup(netip.MustParseAddr(tt.addr))
+		if got := p.Name; got != tt.want || ok != (tt.want != "") {
+			t.Errorf("Lookup(%s) = %q, %v; want %q", tt.addr, got, ok, tt.want)
+		}
+	}
+
+	if _, ok := (&Config{Peers: []Peer{subnet}}).PreferredRoutes().Lookup(netip.MustParseAddr("8.8.8.8")); ok {
+		t.Error("Lookup outside all AllowedIPs succeeded")
+	}
+}
+
+func TestPreferredRoutesMetrics(t *testing.T) {
+	nodeKey := func(b byte) key.NodePublic {
+		var raw [32]byte
+		raw[0] = b
+		return key.NodePublicFromRaw32(mem.B(raw[:]))
+	}
+	k1, k2 := nodeKey(0x10), nodeKey(0x20) // k1 sorts first
+	primary := Peer{PublicKey: k1, Name: "primary", AllowedIPs: prefixes("10.0.0.0/8", "192.168.0.0/16"),
+		AllowedIPMetrics: []AllowedIP{{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Metric: 10}}}
+	backup := Peer{PublicKey: k2, Name: "backup", AllowedIPs: prefixes("10.0.0.0/8", "192.168.0.0/16"),
+		AllowedIPMetrics: []AllowedIP{{Prefix: netip.MustParsePrefix("10.0.0.0/8"), Metric: 20}}}
+	pr := (&Config{Peers: []Peer{backup, primary}}).PreferredRoutes()
+
+	tests := []struct {
+		addr       string
+		want       string
+		wantMetric uint32
+	}{
+		{"10.1.1.1", "primary", 10},  // lower metric wins over sort order
+		{"192.168.1.1", "backup", 0}, // equal metrics: the greatest key wins
+	}
+	for _, tt := range tests {
+		p, a, ok := pr.LookupRoute(netip.MustParseAddr(tt.addr))
+		if !ok || p.Name != tt.want || a.Metric != tt.wantMetric {
+			t.Errorf("LookupRoute(%s) = %q, %v, %v; want %q, metric %d", tt.addr, p.Name, a, ok, tt.want, tt.wantMetric)
+		}
+	}
+}
+
+func TestAllowedIPJSON(t *testing.T) {
+	pfx := netip.MustParsePrefix("10.0.0.0/8")
+	tests := []struct {
+		in   AllowedIP
+		want string
+	}{
+		{AllowedIPFromPrefix(pfx), `"10.0.0.0/8"`},
+		{AllowedIP{Prefix: pfx, Metric: 5}, `{"Prefix":"10.0.0.0/8","Metric":5}`},
+	}
+	for _, tt := range tests {
+		b, err := json.Marshal(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tt.want {
+			t.Errorf("Marshal(%v) = %s; want %s", tt.in, b, tt.want)
+		}
+		var got AllowedIP
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.in {
+			t.Errorf("Unmarshal(%s) = %v; want %v", b, got, tt.in)
+		}
+	}
+
+	var got []AllowedIP
+	if err := json.Unmarshal([]byte(`["10.0.0.0/8", {"Prefix":"fd00::/8","Metric":3}]`), &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []AllowedIP{AllowedIPFromPrefix(pfx), {Prefix: netip.MustParsePrefix("fd00::/8"), Metric: 3}}
+	if !slices.Equal(got, want) {
+		t.Errorf("Unmarshal mixed = %v; want %v", got, want)
+	}
+	if err := json.Unmarshal([]byte(`"bogus"`), new(AllowedIP)); err == nil {
+		t.Error("Unmarshal of invalid prefix succeeded")
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"unsafe"
+)
+
+// ApproxSize returns an estimate of the number of bytes of memory that
+// cfg occupies, for warning about configs that are getting too large on
+// constrained devices with thousands of peers, such as when deciding
+// whether to trim routes.
+//
+// It is only an estimate: it counts the Config and Peer structs, the
+// backing arrays of their slices, by capacity, and the bytes of their
+// strings, but not allocator overhead, data that strings or netip.Addrs
+// share, or anything wireguard-go allocates for the config. It grows
+// linearly with the number of peers and of their AllowedIPs.
+func (cfg *Config) ApproxSize() int {
+	n := int(unsafe.Sizeof(*cfg))
+	n += len(cfg.Name) + len(cfg.NodeID)
+	n += cap(cfg.Addresses) * int(unsafe.Sizeof(netip.Prefix{}))
+	n += cap(cfg.DNS) * int(unsafe.Sizeof(netip.Addr{}))
+	n += cap(cfg.Peers) * int(unsafe.Sizeof(Peer{}))
+	for i := range cfg.Peers {
+		n += cfg.Peers[i].approxSize()
+	}
+	return n
+}
+
+// approxSize returns the estimated size of what p refers to, not
+// including p itself; see Config.ApproxSize.
+func (p *Peer) approxSize() int {
+	n := len(p.Name) + len(p.NodeID)
+	n += cap(p.AllowedIPs) * int(unsafe.Sizeof(netip.Prefix{}))
+	n += cap(p.AllowedIPMetrics) * int(unsafe.Sizeof(AllowedIP{}))
+	n += cap(p.Endpoints) * int(unsafe.Sizeof(Endpoint{}))
+	for _, ep := range p.Endpoints {
+		n += len(ep.Region)
+	}
+	if p.V4MasqAddr != nil {
+		n += int(unsafe.Sizeof(netip.Addr{}))
+	}
+	if p.V6MasqAddr != nil {
+		n += int(unsafe.Sizeof(netip.Addr{}))
+	}
+	return n
+}
@@ -0,0 +1,58 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"testing"
+
+	"tailscale.com/types/key"
+)
+
+func TestApproxSize(t *testing.T) {
+	makeConfig := func(peers, allowedIPs int) *Config {
+		cfg := &Config{PrivateKey: key.NewNode()}
+		for i := range peers {
+			p := Peer{PublicKey: key.NewNode().Public()}
+			for j := range allowedIPs {
+				p.AllowedIPs = append(p.AllowedIPs, netip.PrefixFrom(netip.AddrFrom4([4]byte{10, byte(i >> 8), byte(i), byte(j)}), 32))
+			}
+			p.AllowedIPs = p.AllowedIPs[:len(p.AllowedIPs):len(p.AllowedIPs)]
+			cfg.Peers = append(cfg.Peers, p)
+		}
+		cfg.Peers = cfg.Peers[:len(cfg.Peers):len(cfg.Peers)]
+		return cfg
+	}
+
+	empty := new(Config).ApproxSize()
+	if empty <= 0 {
+		t.Fatalf("empty config ApproxSize = %d; want > 0", empty)
+	}
+	one := makeConfig(1, 1).ApproxSize()
+	if one <= empty {
+		t.Errorf("ApproxSize with 1 peer = %d; want more than empty config's %d", one, empty)
+	}
+
+	// The estimate is linear in the number of peers...
+	perPeer := makeConfig(2, 1).ApproxSize() - one
+	if got, want := makeConfig(1000, 1).ApproxSize(), one+999*perPeer; got != want {
+		t.Errorf("ApproxSize with 1000 peers = %d; want %d", got, want)
+	}
+	// ... and of their AllowedIPs.
+	perIP := makeConfig(1, 2).ApproxSize() - one
+	if perIP <= 0 {
+		t.Fatalf("ApproxSize grew by %d for another AllowedIP; want > 0", perIP)
+	}
+	if got, want := makeConfig(1000, 10).ApproxSize(), one+999*perPeer+1000*9*perIP; got != want {
+		t.Errorf("ApproxSize with 1000 peers of 10 AllowedIPs = %d; want %d", got, want)
+	}
+
+	// Names and endpoints count too.
+	cfg := makeConfig(1, 1)
+	cfg.Peers[0].Name = "laptop"
+	cfg.Peers[0].Endpoints = []Endpoint{{Addr: netip.MustParseAddrPort("1.2.3.4:41641"), Type: EndpointDirect}}
+	if got := cfg.ApproxSize(); got <= one+len("laptop") {
+		t.Errorf("ApproxSize with name and endpoint = %d; want more than %d", got, one+len("laptop"))
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"errors"
+	"fmt"
+
+	"tailscale.com/types/key"
+)
+
+// Validate reports whether cfg is a usable configuration, by the same
+// rules that Builder enforces: it must have a private key, or instead a
+// KeyProvider, which Validate does not consult, and each peer a unique,
+// non-zero public key, valid allowed IPs without host bits set, and valid
+// endpoints. No peer may have the interface's own public key,
+// which wireguard-go otherwise handles confusingly. It returns all the
+// problems found, joined.
+func (cfg *Config) Validate() error {
+	var errs []error
+	var self key.NodePublic
+	if cfg.KeyProvider != nil && !cfg.PrivateKey.IsZero() {
+		errs = append(errs, errors.New("both a private key and a key provider"))
+	}
+	if cfg.PrivateKey.IsZero() {
+		if cfg.KeyProvider == nil {
+			errs = append(errs, errors.New("no private key"))
+		}
+	} else {
+		self = cfg.PrivateKey.Public()
+	}
+	seen := make(map[key.NodePublic]bool, len(cfg.Peers))
+	for _, p := range cfg.Peers {
+		k := p.PublicKey
+		switch {
+		case k.IsZero():
+			errs = append(errs, errors.New("peer public key is zero"))
+		case seen[k]:
+			errs = append(errs, fmt.Errorf("duplicate peer %v", k.ShortString()))
+		case k == self:
+			errs = append(errs, fmt.Errorf("peer %v has the local node's own public key", k.ShortString()))
+		}
+		seen[k] = true
+		for _, ipp := range p.AllowedIPs {
+			if err := checkAllowedIP(ipp); err != nil {
+				errs = append(errs, fmt.Errorf("peer %v: %w", k.ShortString(), err))
+			}
+		}
+		for _, ep := range p.Endpoints {
+			if !ep.Addr.IsValid() {
+				errs = append(errs, fmt.Errorf("peer %v: invalid endpoint %v", k.ShortString(), ep.Addr))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("wgcfg: invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// DryRun returns the changes that reconfiguring a device from old to new
+// would make, for logging what a reconfiguration will do before doing it.
+// It has no side effects. A nil old is treated as an empty Config.
+//
+// If new is nil or does not pass Validate, DryRun returns an error and an
+// empty ChangeSet, as the reconfiguration should not go ahead.
+func DryRun(old, new *Config) (ChangeSet, error) {
+	if new == nil {
+		return ChangeSet{}, errors.New("wgcfg: DryRun of nil config")
+	}
+	if err := new.Validate(); err != nil {
+		return ChangeSet{}, err
+	}
+	if old == nil {
+		old = &Config{}
+	}
+	return new.ChangesFrom(old), nil
+}
@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"net/netip"
+	"strings"
+	"testing"
+
+	"go4.org/mem"
+	"tailscale.com/types/key"
+)
+
+func TestDryRun(t *testing.T) {
+	nodeKey := func(b byte) key.NodePublic {
+		var raw [32]byte
+		raw[0] = b
+		return key.NodePublicFromRaw32(mem.B(raw[:]))
+	}
+	kA, kB, kC := nodeKey(0x10), nodeKey(0x20), nodeKey(0x30)
+	pfx := netip.MustParsePrefix
+	priv := key.NewNode()
+	old := &Config{PrivateKey: priv, Peers: []Peer{
+		{PublicKey: kA, AllowedIPs: []netip.Prefix{pfx("100.64.0.1/32")}},
+		{PublicKey: kB, AllowedIPs: []netip.Prefix{pfx("100.64.0.2/32")}},
+	}}
+	next := &Config{PrivateKey: priv, MTU: 1280, Peers: []Peer{
+		{PublicKey: kA, AllowedIPs: []netip.Prefix{pfx("100.64.0.1/32"), pfx("10.0.0.0/8")}},
+		{PublicKey: kC, AllowedIPs: []netip.Prefix{pfx("100.64.0.3/32")}},
+	}}
+	oldCopy, nextCopy := old.Clone(), next.Clone()
+
+	cs, err := DryRun(old, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "mtu=none->1280; +peer [MAAAA]; -peer [IAAAA]; peer [EAAAA] allowed +10.0.0.0/8"
+	if got := cs.String(); got != want {
+		t.Errorf("DryRun = %q; want %q", got, want)
+	}
+	if !old.Equal(oldCopy) || !next.Equal(nextCopy) {
+		t.Error("DryRun modified its arguments")
+	}
+
+	cs, err = DryRun(nil, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cs.Added) != 2 {
+		t.Errorf("DryRun from nil added %v; want both peers", cs.Added)
+	}
+
+	bad := next.Clone()
+	bad.Peers = append(bad.Peers, Peer{PublicKey: kA}, Peer{PublicKey: kB, AllowedIPs: []netip.Prefix{pfx("10.0.0.1/8")}})
+	cs, err = DryRun(old, bad)
+	if err == nil {
+		t.Fatal("DryRun of invalid config succeeded")
+	}
+	if !cs.IsEmpty() {
+		t.Errorf("DryRun of invalid config returned changes %v", cs)
+	}
+	for _, want := range []string{"duplicate peer [EAAAA]", "peer [IAAAA]: allowed IP 10.0.0.1/8 has host bits set"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not contain %q", err, want)
+		}
+	}
+
+	cs, err = DryRun(old, nil)
+	if err == nil {
+		t.Fatal("DryRun of nil config succeeded")
+	}
+	if !cs.IsEmpty() {
+		t.Errorf("DryRun of nil config returned changes %v", cs)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	k := key.NewNode().Public()
+	priv := key.NewNode()
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string // empty for valid
+	}{
+		{"valid", &Config{PrivateKey: key.NewNode(), Peers: []Peer{{PublicKey: k}}}, ""},
+		{"no-private-key", &Config{}, "no private key"},
+		{"zero-peer-key", &Config{PrivateKey: key.NewNode(), Peers: []Peer{{}}}, "peer public key is zero"},
+		{"invalid-endpoint", &Config{PrivateKey: key.NewNode(), Peers: []Peer{{PublicKey: k, Endpoints: []Endpoint{{}}}}}, "invalid endpoint"},
+		{"self-key", &Config{PrivateKey: priv, Peers: []Peer{{PublicKey: k}, {PublicKey: priv.Public()}}}, "has the local node's own public key"},
+		{"duplicate-peer-key", &Config{PrivateKey: priv, Peers: []Peer{{PublicKey: k}, {PublicKey: k}}}, "duplicate peer " + k.ShortString()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate = %v; want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v; want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
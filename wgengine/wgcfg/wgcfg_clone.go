@@ -7,6 +7,7 @@
 
 import (
 	"net/netip"
+	"time"
 
 	"tailscale.com/tailcfg"
 	"tailscale.com/types/key"
@@ -42,6 +43,8 @@ func (src *Config) Clone() *Config {
 	MTU            uint16
 	DNS            []netip.Addr
 	Peers          []Peer
+	KeyProvider    KeyProvider
+	ListenPort     uint16
 	NetworkLogging struct {
 		NodeID             logid.PrivateID
 		DomainID           logid.PrivateID
@@ -64,6 +67,8 @@ func (src *Peer) Clone() *Peer {
 	if dst.V6MasqAddr != nil {
 		dst.V6MasqAddr = ptr.To(*src.V6MasqAddr)
 	}
+	dst.Endpoints = append(src.Endpoints[:0:0], src.Endpoints...)
+	dst.AllowedIPMetrics = append(src.AllowedIPMetrics[:0:0], src.AllowedIPMetrics...)
 	return dst
 }
 
@@ -71,10 +76,17 @@ func (src *Peer) Clone() *Peer {
 var _PeerCloneNeedsRegeneration = Peer(struct {
 	PublicKey           key.NodePublic
 	DiscoKey            key.DiscoPublic
+	Name                string
+	PresharedKey        PresharedKey
 	AllowedIPs          []netip.Prefix
 	V4MasqAddr          *netip.Addr
 	V6MasqAddr          *netip.Addr
 	IsJailed            bool
+	Disabled            bool
 	PersistentKeepalive uint16
+	NodeID              tailcfg.StableNodeID
+	Endpoints           []Endpoint
+	IdleTimeout         time.Duration
+	AllowedIPMetrics    []AllowedIP
 	WGEndpoint          key.NodePublic
 }{})
@@ -7,8 +7,11 @@
 	"fmt"
 	"io"
 	"net/netip"
+	"slices"
 	"strconv"
+	"strings"
 
+	"go4.org/netipx"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 )
@@ -20,7 +23,30 @@
 // remove and re-add all peers, and so that we can avoid writing information
 // about peers that have not changed since the previous time we wrote our
 // Config.
+//
+// The output is deterministic for a given cfg and prev: peers are written
+// in public key order, each peer's fields in a fixed order, and allowed IPs
+// sorted, so that the output of two runs can be meaningfully diffed.
 func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
+	return cfg.toUAPI(logf, w, prev, false)
+}
+
+// uapiNameComment is the prefix of the comment line that carries a
+// Peer's Name in annotated UAPI output.
+const uapiNameComment = "# name="
+
+// WriteAnnotatedUAPI writes cfg's full configuration to w in UAPI format,
+// with a "# name=<Name>" comment line after the public_key line of each
+// peer that has a Name.
+//
+// The output is for dumps and debugging tools, and can be read back with
+// FromUAPI. Preshared keys are omitted. It must not be sent to wireguard-go, which rejects comment
+// lines; use ToUAPI for that.
+func (cfg *Config) WriteAnnotatedUAPI(w io.Writer) error {
+	return cfg.toUAPI(logger.Discard, w, new(Config), true)
+}
+
+func (cfg *Config) toUAPI(logf logger.Logf, w io.Writer, prev *Config, annotate bool) error {
 	var stickyErr error
 	set := func(key, value string) {
 		if stickyErr != nil {
@@ -34,22 +60,40 @@ func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
 	setUint16 := func(key string, value uint16) {
 		set(key, strconv.FormatUint(uint64(value), 10))
 	}
-	setPeer := func(peer Peer) {
+	setPeer := func(peer *Peer) {
 		set("public_key", peer.PublicKey.UntypedHexString())
+		if annotate && peer.Name != "" && stickyErr == nil {
+			name := strings.ReplaceAll(peer.Name, "\n", " ")
+			_, stickyErr = fmt.Fprintf(w, "%s%s\n", uapiNameComment, name)
+		}
 	}
 
 	// Device config.
-	if !prev.PrivateKey.Equal(cfg.PrivateKey) {
+	switch {
+	case cfg.KeyProvider != nil:
+		// Annotated output is for dumps, which must not contain the key.
+		if !annotate {
+			stickyErr = cfg.writeProvidedKey(w, prev)
+		}
+	case !prev.PrivateKey.Equal(cfg.PrivateKey):
 		set("private_key", cfg.PrivateKey.UntypedHexString())
 	}
 
+	// Disabled peers are not configured in WireGuard, so treat them as
+	// absent from both configs: newly disabled peers are removed.
 	old := make(map[key.NodePublic]Peer)
 	for _, p := range prev.Peers {
-		old[p.PublicKey] = p
+		if !p.Disabled {
+			old[p.PublicKey] = p
+		}
 	}
 
 	// Add/configure all new peers.
-	for _, p := range cfg.Peers {
+	for _, i := range sortedPeerIndices(cfg.Peers) {
+		p := &cfg.Peers[i]
+		if p.Disabled {
+			continue
+		}
 		oldPeer, wasPresent := old[p.PublicKey]
 
 		// We only want to write the peer header/version if we're about
@@ -63,8 +107,9 @@ func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
 		willSetEndpoint := oldPeer.WGEndpoint != p.PublicKey || !wasPresent
 		willChangeIPs := !cidrsEqual(oldPeer.AllowedIPs, p.AllowedIPs) || !wasPresent
 		willChangeKeepalive := oldPeer.PersistentKeepalive != p.PersistentKeepalive // if not wasPresent, no need to redundantly set zero (default)
+		willChangePSK := !oldPeer.PresharedKey.Equal(p.PresharedKey)                // likewise
 
-		if !willSetEndpoint && !willChangeIPs && !willChangeKeepalive {
+		if !willSetEndpoint && !willChangeIPs && !willChangeKeepalive && !willChangePSK {
 			// It's safe to skip doing anything here; wireguard-go
 			// will not remove a peer if it's unspecified unless we
 			// tell it to (which we do below if necessary).
@@ -90,13 +135,17 @@ func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
 			set("endpoint", p.PublicKey.UntypedHexString())
 		}
 
+		if willChangePSK && !annotate { // keep secrets out of dumps
+			set("preshared_key", p.PresharedKey.untypedHexString())
+		}
+
 		// TODO: replace_allowed_ips is expensive.
 		// If p.AllowedIPs is a strict superset of oldPeer.AllowedIPs,
 		// then skip replace_allowed_ips and instead add only
 		// the new ipps with allowed_ip.
 		if willChangeIPs {
 			set("replace_allowed_ips", "true")
-			for _, ipp := range p.AllowedIPs {
+			for _, ipp := range sortedPrefixes(p.AllowedIPs) {
 				set("allowed_ip", ipp.String())
 			}
 		}
@@ -110,10 +159,18 @@ func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
 
 	// Remove peers that were present but should no longer be.
 	for _, p := range cfg.Peers {
-		delete(old, p.PublicKey)
+		if !p.Disabled {
+			delete(old, p.PublicKey)
+		}
 	}
-	for _, p := range old {
-		setPeer(p)
+	removed := make([]key.NodePublic, 0, len(old))
+	for k := range old {
+		removed = append(removed, k)
+	}
+	slices.SortFunc(removed, comparePublicKeys)
+	for _, k := range removed {
+		p := old[k]
+		setPeer(&p)
 		set("remove", "true")
 	}
 
@@ -123,6 +180,40 @@ func (cfg *Config) ToUAPI(logf logger.Logf, w io.Writer, prev *Config) error {
 	return stickyErr
 }
 
+// sortedPeerIndices returns the indices of peers in order of public key,
+// so that callers can visit peers in a stable order without copying them.
+func sortedPeerIndices(peers []Peer) []int {
+	idx := make([]int, len(peers))
+	for i := range idx {
+		idx[i] = i
+	}
+	slices.SortFunc(idx, func(a, b int) int {
+		return comparePublicKeys(peers[a].PublicKey, peers[b].PublicKey)
+	})
+	return idx
+}
+
+func comparePublicKeys(a, b key.NodePublic) int {
+	switch {
+	case a.Less(b):
+		return -1
+	case b.Less(a):
+		return 1
+	}
+	return 0
+}
+
+// sortedPrefixes returns ipps in sorted order.
+// It returns ipps itself if it is already sorted, and a sorted copy otherwise.
+func sortedPrefixes(ipps []netip.Prefix) []netip.Prefix {
+	if slices.IsSortedFunc(ipps, netipx.ComparePrefix) {
+		return ipps
+	}
+	ipps = slices.Clone(ipps)
+	slices.SortFunc(ipps, netipx.ComparePrefix)
+	return ipps
+}
+
 func cidrsEqual(x, y []netip.Prefix) bool {
 	// TODO: re-implement using netaddr.IPSet.Equal.
 	if len(x) != len(y) {
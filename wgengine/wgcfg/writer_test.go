@@ -0,0 +1,131 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wgcfg
+
+import (
+	"math/rand/v2"
+	"net/netip"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tailscale/wireguard-go/device"
+	"tailscale.com/types/key"
+)
+
+func TestToUAPIStable(t *testing.T) {
+	var peers []Peer
+	for i := range 8 {
+		peers = append(peers, Peer{
+			PublicKey: key.NewNode().Public(),
+			AllowedIPs: []netip.Prefix{
+				netip.PrefixFrom(netip.AddrFrom4([4]byte{100, 64, 0, byte(i)}), 32),
+				netip.MustParsePrefix("10.0.0.0/8"),
+				netip.MustParsePrefix("fd7a:115c:a1e0::/48"),
+			},
+			PersistentKeepalive: uint16(i),
+		})
+	}
+	// prev has some peers that are not in cfg, so that removals are written too.
+	prev := &Config{}
+	for range 4 {
+		prev.Peers = append(prev.Peers, Peer{PublicKey: key.NewNode().Public()})
+	}
+	cfg := &Config{PrivateKey: key.NewNode(), Peers: peers}
+
+	render := func() string {
+		t.Helper()
+		var sb strings.Builder
+		if err := cfg.ToUAPI(t.Logf, &sb, prev); err != nil {
+			t.Fatal(err)
+		}
+		return sb.String()
+	}
+
+	want := render()
+	for range 10 {
+		rand.Shuffle(len(cfg.Peers), func(i, j int) {
+			cfg.Peers[i], cfg.Peers[j] = cfg.Peers[j], cfg.Peers[i]
+		})
+		for _, p := range cfg.Peers {
+			rand.Shuffle(len(p.AllowedIPs), func(i, j int) {
+				p.AllowedIPs[i], p.AllowedIPs[j] = p.AllowedIPs[j], p.AllowedIPs[i]
+			})
+		}
+		rand.Shuffle(len(prev.Peers), func(i, j int) {
+			prev.Peers[i], prev.Peers[j] = prev.Peers[j], prev.Peers[i]
+		})
+		if got := render(); got != want {
+			t.Fatalf("output changed after shuffling peers\n got: %s\nwant: %s", got, want)
+		}
+	}
+}
+
+func TestWriteAnnotatedUAPI(t *testing.T) {
+	cfg := &Config{
+		PrivateKey: key.NewNode(),
+		Peers: sortedPeers([]Peer{
+			{
+				PublicKey:  key.NewNode().Public(),
+				Name:       "laptop",
+				AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.1/32")},
+			},
+			{
+				PublicKey:  key.NewNode().Public(),
+				AllowedIPs: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")},
+			},
+		}),
+	}
+	var sb strings.Builder
+	if err := cfg.WriteAnnotatedUAPI(&sb); err != nil {
+		t.Fatal(err)
+	}
+	annotated := sb.String()
+	if !strings.Contains(annotated, "\n# name=laptop\n") {
+		t.Errorf("missing name comment in:\n%s", annotated)
+	}
+
+	got, err := FromUAPI(strings.NewReader(annotated))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Peers) != len(cfg.Peers) {
+		t.Fatalf("got %d peers, want %d", len(got.Peers), len(cfg.Peers))
+	}
+	for i, p := range got.Peers {
+		want := cfg.Peers[i]
+		if p.PublicKey != want.PublicKey || p.Name != want.Name || !cidrsEqual(p.AllowedIPs, want.AllowedIPs) {
+			t.Errorf("peer %d = %+v; want %+v", i, p, want)
+		}
+	}
+
+	// The names must never reach wireguard-go, which rejects comments.
+	sb.Reset()
+	if err := cfg.ToUAPI(t.Logf, &sb, new(Config)); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sb.String(), "#") {
+		t.Errorf("ToUAPI output contains a comment:\n%s", sb.String())
+	}
+	dev := NewDevice(newNilTun(), new(noopBind), device.NewLogger(device.LogLevelError, "test"))
+	defer dev.Close()
+	if err := dev.IpcSetOperation(strings.NewReader(annotated)); err == nil {
+		t.Error("wireguard-go accepted annotated UAPI; names could now be sent to it")
+	}
+	if err := ReconfigDevice(dev, cfg, t.Logf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sortedPeers returns peers sorted by public key.
+// It returns peers itself if it is already sorted, and a sorted copy otherwise.
+func sortedPeers(peers []Peer) []Peer {
+	cmp := func(a, b Peer) int { return comparePublicKeys(a.PublicKey, b.PublicKey) }
+	if slices.IsSortedFunc(peers, cmp) {
+		return peers
+	}
+	peers = slices.Clone(peers)
+	slices.SortFunc(peers, cmp)
+	return peers
+}
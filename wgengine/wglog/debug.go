@@ -0,0 +1,71 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"slices"
+	"strings"
+	"time"
+)
+
+// DebugState is a snapshot of what a Logger knows, for bug reports and
+// debug handlers. It is safe to serialize as JSON.
+type DebugState struct {
+	// Peers are the peers being rewritten, including recently removed
+	// ones retained by WithRewriteTTL, sorted by WireGuard string.
+	Peers []DebugPeer
+	// Endpoints maps endpoint strings to the labels they are rewritten to.
+	Endpoints map[string]string `json:",omitempty"`
+	// Stats are the Logger's counters.
+	Stats Stats
+}
+
+// DebugPeer is a peer in a DebugState.
+type DebugPeer struct {
+	WireGuard string // wireguard-go's string for the peer, like "peer(IMTB…r7lM)"
+	Label     string // what WireGuard is rewritten to, like "[IMTBr]"
+
+	// RetiredUntil, if non-zero, is when a peer no longer in the most
+	// recent SetPeers stops being rewritten.
+	RetiredUntil time.Time
+
+	// LastHandshake and Active are what has been observed about the peer
+	// in wireguard-go's lines. They are only tracked if an option that
+	// needs them, such as WithHealthMarkers or WithEdgeTriggered, is set.
+	LastHandshake time.Time
+	Active        bool
+}
+
+// DebugDump returns a snapshot of x's state. It is cheap enough to call
+// from a debug handler at any time and is safe for concurrent use.
+func (x *Logger) DebugDump() DebugState {
+	var obs map[string]peerObs
+	if x.obs != nil {
+		obs = x.obs.snapshot()
+	}
+	st := DebugState{Stats: x.Stats()}
+	add := func(wg, label string, retiredUntil time.Time) {
+		p := DebugPeer{WireGuard: wg, Label: label, RetiredUntil: retiredUntil}
+		if o, ok := obs[wg]; ok {
+			p.LastHandshake = o.lastHandshake
+			p.Active = o.active
+		}
+		st.Peers = append(st.Peers, p)
+	}
+	for wg, label := range x.replace.Load() {
+		if !isWireGuardPeerString(wg) {
+			if st.Endpoints == nil {
+				st.Endpoints = make(map[string]string)
+			}
+			st.Endpoints[wg] = label
+			continue
+		}
+		add(wg, label, time.Time{})
+	}
+	for wg, r := range x.retired.Load() {
+		add(wg, r.ts, r.expires)
+	}
+	slices.SortFunc(st.Peers, func(a, b DebugPeer) int { return strings.Compare(a.WireGuard, b.WireGuard) })
+	return st
+}
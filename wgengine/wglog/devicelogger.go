@@ -0,0 +1,29 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"github.com/tailscale/wireguard-go/device"
+	"tailscale.com/types/logger"
+)
+
+// buildDeviceLogger returns the wireguard-go logger that logs via verbose
+// and errorf.
+//
+// It is the only place that depends on the shape of device.Logger, which
+// has changed across wireguard-go versions (it used to have Debug, Info
+// and Error fields). When bumping wireguard-go, adjust it here, mapping
+// its log functions onto verbose and errorf; the rest of the package only
+// deals in those two.
+//
+// There is a single implementation, for wireguard-go's Verbosef/Errorf
+// Logger, as of tailscale/wireguard-go 03c5a0ccf754; nothing selects
+// among versions. It sets the fields by name, so a release that renames
+// or removes them fails to compile here rather than misbehaving.
+func buildDeviceLogger(verbose, errorf logger.Logf) *device.Logger {
+	return &device.Logger{
+		Verbosef: verbose,
+		Errorf:   errorf,
+	}
+}
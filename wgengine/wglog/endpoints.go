@@ -0,0 +1,58 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"net/netip"
+	"sync"
+)
+
+// endpointTracker records the endpoint most recently logged for each peer.
+type endpointTracker struct {
+	mu   sync.Mutex
+	last map[string]netip.AddrPort // keyed by wireguard-go peer string
+}
+
+// observe records that ep was logged on a line about peer.
+func (t *endpointTracker) observe(peer string, ep netip.AddrPort) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.last == nil {
+		t.last = make(map[string]netip.AddrPort)
+	}
+	t.last[peer] = ep
+}
+
+// retain forgets the endpoints of peers not in keep.
+func (t *endpointTracker) retain(keep map[string]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for peer := range t.last {
+		if _, ok := keep[peer]; !ok {
+			delete(t.last, peer)
+		}
+	}
+}
+
+// PeerEndpoints returns the endpoint most recently seen in a line about
+// each peer, keyed by the peer's label in logs, like "laptop[IMTBr]".
+// It answers where a peer is connecting from right now, as far as the
+// logs say. Endpoints are taken from args that format as an IP address
+// and port, on lines that also identify a peer.
+//
+// Only peers installed by the most recent SetPeers or known to the func
+// given to WithRewriteFunc are included, and only once a line with an
+// endpoint has been logged about them.
+func (x *Logger) PeerEndpoints() map[string]netip.AddrPort {
+	replace := x.replace.Load()
+	x.endpoints.mu.Lock()
+	defer x.endpoints.mu.Unlock()
+	m := make(map[string]netip.AddrPort, len(x.endpoints.last))
+	for peer, ep := range x.endpoints.last {
+		if label, ok := x.lookupLabel(replace, peer); ok {
+			m[label] = ep
+		}
+	}
+	return m
+}
@@ -0,0 +1,90 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"tailscale.com/types/key"
+)
+
+// An Event is a typed description of a recognized wireguard-go log line,
+// delivered to the sink set by SetEventSink.
+type Event struct {
+	Kind EventKind
+	// Peer is the public key of the peer the line is about.
+	// It is zero if the line is not about a peer known to SetPeers.
+	Peer key.NodePublic
+	// Label is the peer as rendered in the text log, such as "[IMTBr]".
+	// It is empty if the line is not about a peer.
+	Label string
+	Time  time.Time
+	// Detail is the text of the line as logged, without its "wg: " prefix.
+	Detail string
+}
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	EventHandshakeInitiated EventKind = iota + 1 // we sent a handshake initiation
+	EventHandshakeCompleted                      // a handshake completed, as initiator or responder
+	EventHandshakeFailed                         // a handshake timed out, whether or not it will be retried
+	EventBecameActive                            // a peer became active; see SetEventSink
+	EventBecameIdle                              // a peer became idle; see SetEventSink
+	EventError                                   // any other line wireguard-go logged as an error
+	EventIdleTimeout                             // a peer went without activity for its wgcfg.Peer.IdleTimeout
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventHandshakeInitiated:
+		return "handshake-initiated"
+	case EventHandshakeCompleted:
+		return "handshake-completed"
+	case EventHandshakeFailed:
+		return "handshake-failed"
+	case EventBecameActive:
+		return "became-active"
+	case EventBecameIdle:
+		return "became-idle"
+	case EventError:
+		return "error"
+	case EventIdleTimeout:
+		return "idle-timeout"
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// SetEventSink makes x call sink with an Event for each recognized line,
+// in addition to logging it as text, so that other code can react to
+// handshakes and errors without parsing logs. A nil sink disables events.
+//
+// EventBecameActive and EventBecameIdle are only delivered when x tracks
+// peer state, as it does with WithEdgeTriggered or WithHealthMarkers.
+//
+// sink is called synchronously on the logging path; it must be cheap and
+// must not log via x. SetEventSink is safe for concurrent use.
+func (x *Logger) SetEventSink(sink func(Event)) {
+	x.eventSink.Store(sink)
+}
+
+// eventKind returns the kind of Event for a line with the given format,
+// logged via o, if it is recognized.
+func (x *Logger) eventKind(o *origin, format string) (_ EventKind, ok bool) {
+	switch {
+	case strings.Contains(format, "Sending handshake initiation"):
+		return EventHandshakeInitiated, true
+	case strings.Contains(format, "Received handshake response"),
+		strings.Contains(format, "Sending handshake response"):
+		return EventHandshakeCompleted, true
+	case strings.Contains(format, "Handshake did not complete"):
+		return EventHandshakeFailed, true
+	case o == &x.errors:
+		return EventError, true
+	}
+	return 0, false
+}
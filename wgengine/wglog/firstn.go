@@ -0,0 +1,43 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import "sync"
+
+// maxFirstNFormats bounds the number of formats a firstNSampler tracks.
+// wireguard-go logs from a fixed set of format strings, well under this.
+const maxFirstNFormats = 1000
+
+// firstNSampler passes the first n lines of each format, then one in
+// every rate.
+type firstNSampler struct {
+	n, rate int
+
+	mu       sync.Mutex
+	counts   map[string]int // lines seen per format
+	overflow int            // lines seen of formats not in counts, once it is full
+}
+
+// allow reports whether a line with the given format should be logged.
+func (s *firstNSampler) allow(format string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var c int
+	if _, ok := s.counts[format]; ok || len(s.counts) < maxFirstNFormats {
+		if s.counts == nil {
+			s.counts = make(map[string]int)
+		}
+		s.counts[format]++
+		c = s.counts[format]
+	} else {
+		// Too many distinct formats to track another; sample them
+		// together, without giving them their first n.
+		s.overflow++
+		c = s.n + s.overflow
+	}
+	if c <= s.n {
+		return true
+	}
+	return s.rate > 0 && (c-s.n)%s.rate == 0
+}
@@ -0,0 +1,72 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// flapCoalescer counts "Interface up/down requested" lines and
+// summarizes them once per window.
+type flapCoalescer struct {
+	window    time.Duration
+	threshold int
+
+	mu     sync.Mutex
+	n      int         // lines seen in the current window; zero if no window is open
+	recent []time.Time // times of the last threshold lines, oldest first
+}
+
+// isInterfaceUpDown reports whether a line with the given format is one of
+// wireguard-go's interface up/down lines.
+func isInterfaceUpDown(format string) bool {
+	return strings.Contains(format, "Interface up requested") || strings.Contains(format, "Interface down requested")
+}
+
+// record notes one up/down line, opening a window if none is open.
+// When the window closes, x logs a summary if at least threshold lines
+// were seen in it.
+func (f *flapCoalescer) record(x *Logger) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.recent = append(f.recent, x.clock.Now())
+	if len(f.recent) > max(f.threshold, 1) {
+		f.recent = f.recent[1:]
+	}
+	f.n++
+	if f.n > 1 {
+		return
+	}
+	x.clock.AfterFunc(f.window, func() {
+		f.mu.Lock()
+		n := f.n
+		f.n = 0
+		f.mu.Unlock()
+		if n >= f.threshold {
+			x.logf("%sinterface flapped %d times in %v", x.prefix, n, f.window)
+		}
+	})
+}
+
+// isFlapping reports whether at least threshold lines were seen within
+// the window before now.
+func (f *flapCoalescer) isFlapping(now time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.recent) >= max(f.threshold, 1) && now.Sub(f.recent[0]) < f.window
+}
+
+// IsFlapping reports whether the tun device is currently flapping: whether
+// at least as many "Interface up/down requested" lines as the
+// WithFlapCoalescing threshold were logged within its window, sliding back
+// from now. It suits a health check reporting "tun device flapping".
+// It is always false without WithFlapCoalescing.
+func (x *Logger) IsFlapping() bool {
+	if x.flaps == nil {
+		return false
+	}
+	return x.flaps.isFlapping(x.clock.Now())
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// deviceFold collects handshake lines across all peers and summarizes
+// them once per window.
+type deviceFold struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	peers   []string // labels of peers seen in the current window, in order; nil if no window is open
+	verbose bool     // whether every line in the current window was verbose
+}
+
+// record notes a handshake line about the peer labeled peer, opening a
+// window if none is open. When the window closes, x logs a summary.
+func (f *deviceFold) record(x *Logger, o *origin, peer string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	open := f.peers != nil
+	if !open {
+		f.verbose = true
+	}
+	f.verbose = f.verbose && o == &x.verbose
+	if !slices.Contains(f.peers, peer) {
+		f.peers = append(f.peers, peer)
+	}
+	if open {
+		return
+	}
+	x.clock.AfterFunc(f.window, func() {
+		f.mu.Lock()
+		peers, verbose := f.peers, f.verbose
+		f.peers = nil
+		f.mu.Unlock()
+		prefix := x.prefix
+		if verbose {
+			prefix += "[v2] "
+		}
+		x.logf("%shandshakes with %d peers in %v: %s", prefix, len(peers), f.window, strings.Join(peers, ", "))
+	})
+}
@@ -0,0 +1,91 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"strings"
+	"sync"
+)
+
+// handshakeEvent is the role a log line plays in a handshake attempt.
+type handshakeEvent int
+
+const (
+	hsNone     handshakeEvent = iota // not about a handshake
+	hsStart                          // an attempt starts (or is retried)
+	hsProgress                       // something happened during an attempt
+	hsEnd                            // an attempt completed or was abandoned
+)
+
+// classifyHandshake reports the role that a wireguard-go line with the
+// given format plays in a handshake attempt.
+func classifyHandshake(format string) handshakeEvent {
+	switch {
+	case strings.Contains(format, "Sending handshake initiation"),
+		strings.Contains(format, "Received handshake initiation"):
+		return hsStart
+	case strings.Contains(format, "Received handshake response"),
+		strings.Contains(format, "Sending handshake response"),
+		isHandshakeAbandoned(format):
+		return hsEnd
+	case strings.Contains(format, "andshake"):
+		return hsProgress
+	}
+	return hsNone
+}
+
+// isHandshakeAbandoned reports whether a line with the given format
+// reports that wireguard-go gave up on a handshake.
+func isHandshakeAbandoned(format string) bool {
+	return strings.Contains(format, "Handshake did not complete after") && strings.Contains(format, "giving up")
+}
+
+// handshakeTracker assigns an attempt ID to each handshake with a peer,
+// so that all the lines relating to one attempt can be tied together.
+// IDs are unique per peer for the life of the process.
+type handshakeTracker struct {
+	mu    sync.Mutex
+	peers map[string]*handshakeAttempt // keyed by wireguard-go peer string
+}
+
+type handshakeAttempt struct {
+	id         uint64 // ID of the current or most recent attempt
+	inProgress bool
+}
+
+// annotate returns format and args, with the handshake attempt ID appended
+// if the line is about a handshake with peer.
+// peer is the wireguard-go string of the peer the line is about, if any.
+func (t *handshakeTracker) annotate(peer, format string, args []any) (string, []any) {
+	if peer == "" {
+		return format, args
+	}
+	ev := classifyHandshake(format)
+	if ev == hsNone {
+		return format, args
+	}
+
+	t.mu.Lock()
+	a, ok := t.peers[peer]
+	if !ok {
+		if t.peers == nil {
+			t.peers = make(map[string]*handshakeAttempt)
+		}
+		a = new(handshakeAttempt)
+		t.peers[peer] = a
+	}
+	if !a.inProgress {
+		// Anything about a handshake when none is in progress
+		// starts a new attempt, even if we missed its first line.
+		a.id++
+		a.inProgress = true
+	}
+	id := a.id
+	if ev == hsEnd {
+		a.inProgress = false
+	}
+	t.mu.Unlock()
+
+	return format + " [hs#%d]", append(args, id)
+}
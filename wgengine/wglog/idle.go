@@ -0,0 +1,107 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/syncs"
+	"tailscale.com/tstime"
+	"tailscale.com/util/mak"
+)
+
+// idleWatcher reports peers that go without activity for longer than
+// their wgcfg.Peer.IdleTimeout.
+type idleWatcher struct {
+	timeouts syncs.AtomicValue[map[string]time.Duration] // keyed by wireguard-go peer string; nil if none
+
+	mu    sync.Mutex
+	peers map[string]*idlePeer // peers whose activity has been observed
+}
+
+// idlePeer is the idle timer state of a single peer.
+type idlePeer struct {
+	timeout    time.Duration
+	lastActive time.Time
+	gen        int // incremented on each activity, to detect stale timers
+	timer      tstime.TimerController
+}
+
+// isActivity reports whether a line with the given format shows that a
+// peer is in use, for the purposes of IdleTimeout.
+func isActivity(format string) bool {
+	return isHandshakeComplete(format) || strings.Contains(format, "keepalive packet")
+}
+
+// setTimeouts replaces the peers' idle timeouts. The timers of peers whose
+// timeout changed are stopped until their next activity.
+func (w *idleWatcher) setTimeouts(timeouts map[string]time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timeouts.Store(timeouts)
+	for peer, p := range w.peers {
+		if timeouts[peer] != p.timeout {
+			p.timer.Stop()
+			delete(w.peers, peer)
+		}
+	}
+}
+
+// observe notes a line with the given format about peer, restarting the
+// peer's idle timer if it is activity.
+func (w *idleWatcher) observe(x *Logger, peer, format string) {
+	timeout := w.timeouts.Load()[peer]
+	if timeout == 0 || !isActivity(format) {
+		return
+	}
+	now := x.clock.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	p, ok := w.peers[peer]
+	if ok {
+		p.timer.Stop()
+	} else {
+		p = &idlePeer{timeout: timeout}
+		mak.Set(&w.peers, peer, p)
+	}
+	p.lastActive = now
+	p.gen++
+	gen := p.gen
+	// Each timer gets its own func, rather than being Reset, so that a
+	// timer that fires concurrently with activity can tell it is stale.
+	p.timer = x.clock.AfterFunc(timeout, func() { w.fire(x, peer, p, gen) })
+}
+
+// fire reports peer as idle, unless it has been active since the timer
+// for activity generation gen was started, or its timeout has changed.
+//
+// It must not use x.clock, as fake clocks call it with their lock held.
+func (w *idleWatcher) fire(x *Logger, peer string, p *idlePeer, gen int) {
+	w.mu.Lock()
+	if w.peers[peer] != p || p.gen != gen {
+		w.mu.Unlock()
+		return
+	}
+	at := p.lastActive.Add(p.timeout)
+	w.mu.Unlock()
+
+	label := peer
+	if ts, ok := x.lookupLabel(x.replace.Load(), peer); ok {
+		label = ts
+	}
+	detail := fmt.Sprintf("peer %v idle for > %v", label, p.timeout)
+	x.logf("%s%s", x.prefix, detail)
+	if sink := x.eventSink.Load(); sink != nil {
+		sink(Event{
+			Kind:   EventIdleTimeout,
+			Peer:   x.peerKeys.Load()[peer],
+			Label:  label,
+			Time:   at,
+			Detail: detail,
+		})
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"tailscale.com/types/key"
+)
+
+// PeerLabel holds the fields available to a label template;
+// see WithLabelTemplate.
+type PeerLabel struct {
+	Name   string // the peer's wgcfg.Peer.Name, if any
+	Key    string // the first five base64 digits of the peer's key, like "IMTBr"
+	Region string // the peer's DERP home region code, from SetPeerRegions, if any
+}
+
+// WithLabelTemplate makes the Logger render each peer it rewrites with
+// the text/template tmpl, executed against the peer's PeerLabel, in place
+// of the default label, like "laptop[IMTBr][nyc]". For example,
+// "[{{.Name}}]" or "{{.Name}}@{{.Region}}".
+//
+// It returns an error if tmpl does not parse or does not execute against
+// a PeerLabel. A peer whose label fails to render is labeled as usual.
+func WithLabelTemplate(tmpl string) (Option, error) {
+	t, err := template.New("label").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("wglog: invalid label template: %w", err)
+	}
+	if err := t.Execute(new(strings.Builder), PeerLabel{}); err != nil {
+		return nil, fmt.Errorf("wglog: invalid label template: %w", err)
+	}
+	return func(x *Logger) { x.labelTmpl = t }, nil
+}
+
+// peerLabel returns the label used for the peer with key k.
+func (x *Logger) peerLabel(k key.NodePublic, name, region string) string {
+	short := k.ShortString()
+	if x.labelTmpl != nil {
+		var sb strings.Builder
+		err := x.labelTmpl.Execute(&sb, PeerLabel{
+			Name:   name,
+			Key:    strings.Trim(short, "[]"),
+			Region: region,
+		})
+		if err == nil {
+			return sb.String()
+		}
+	}
+	// Named peers are labeled like "laptop[IMTBr]",
+	// keeping the key so that the label stays unambiguous.
+	label := name + short
+	if region != "" {
+		label += "[" + region + "]"
+	}
+	return label
+}
@@ -0,0 +1,61 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/metrics"
+)
+
+// handshakeLatencyBuckets are the boundaries, in seconds, of the buckets
+// of the handshake latency histogram.
+var handshakeLatencyBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// latencyTracker measures the time between wireguard-go logging that it
+// is initiating a handshake with a peer and logging the peer's response.
+type latencyTracker struct {
+	timeout time.Duration
+	hist    *metrics.Histogram
+
+	mu      sync.Mutex
+	started map[string]time.Time // when each pending handshake started, by wireguard-go peer string
+}
+
+func newLatencyTracker(timeout time.Duration) *latencyTracker {
+	return &latencyTracker{
+		timeout: timeout,
+		hist:    metrics.NewHistogram(handshakeLatencyBuckets),
+		started: make(map[string]time.Time),
+	}
+}
+
+// observe notes a line with the given format about peer, logged at now.
+//
+// A handshake is timed from its first initiation, so that retries count
+// towards its latency. Handshakes not completed within the timeout, or
+// abandoned, are not recorded.
+func (t *latencyTracker) observe(peer, format string, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case strings.Contains(format, "Sending handshake initiation"):
+		if start, ok := t.started[peer]; !ok || now.Sub(start) > t.timeout {
+			t.started[peer] = now
+		}
+	case strings.Contains(format, "Received handshake response"):
+		start, ok := t.started[peer]
+		if !ok {
+			return
+		}
+		delete(t.started, peer)
+		if d := now.Sub(start); d <= t.timeout {
+			t.hist.Observe(d.Seconds())
+		}
+	case isHandshakeAbandoned(format):
+		delete(t.started, peer)
+	}
+}
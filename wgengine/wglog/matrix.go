@@ -0,0 +1,100 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ConnectivityMatrix returns a compact table of the peers x knows, with
+// what its logs say about each: how long ago a handshake last completed,
+// the endpoint it was last seen at, and its health. It is for debug
+// commands that want a quick view of the whole mesh:
+//
+//	PEER           HANDSHAKE  ENDPOINT            HEALTH
+//	[QAAAA]        never      -                   down
+//	laptop[IMTBr]  12s ago    198.51.100.7:41641  up
+//
+// Health is "up" if the peer has a session, "stale" if it has one but
+// its last handshake is older than the maxAge given to WithHealthMarkers,
+// and "down" otherwise. Handshakes and health are only observed with an
+// option that tracks them, such as WithHealthMarkers or WithEdgeTriggered;
+// without one, they are shown as "-".
+//
+// The peers are those installed by the most recent SetPeers, and those
+// that the func given to WithRewriteFunc labels once a line about them
+// has been logged, sorted by label. It returns only the header if there
+// are none.
+func (x *Logger) ConnectivityMatrix() string {
+	replace := x.replace.Load()
+	var obs map[string]peerObs
+	if x.obs != nil {
+		obs = x.obs.snapshot()
+	}
+	x.endpoints.mu.Lock()
+	endpoints := make(map[string]string, len(x.endpoints.last))
+	for peer, ep := range x.endpoints.last {
+		endpoints[peer] = ep.String()
+	}
+	x.endpoints.mu.Unlock()
+
+	type row struct{ label, wg string }
+	var rows []row
+	seen := make(map[string]bool)
+	add := func(wg string) {
+		if seen[wg] || !isWireGuardPeerString(wg) {
+			return
+		}
+		seen[wg] = true
+		if label, ok := x.lookupLabel(replace, wg); ok {
+			rows = append(rows, row{label, wg})
+		}
+	}
+	for wg := range replace {
+		add(wg)
+	}
+	for wg := range obs {
+		add(wg)
+	}
+	for wg := range endpoints {
+		add(wg)
+	}
+	slices.SortFunc(rows, func(a, b row) int {
+		if c := strings.Compare(a.label, b.label); c != 0 {
+			return c
+		}
+		return strings.Compare(a.wg, b.wg)
+	})
+
+	var sb strings.Builder
+	tw := tabwriter.NewWriter(&sb, 2, 2, 2, ' ', 0)
+	fmt.Fprintln(tw, "PEER\tHANDSHAKE\tENDPOINT\tHEALTH")
+	for _, r := range rows {
+		handshake, health := "-", "-"
+		if x.obs != nil {
+			o := obs[r.wg]
+			handshake, health = "never", "down"
+			if !o.lastHandshake.IsZero() {
+				handshake = x.clock.Since(o.lastHandshake).Round(time.Second).String() + " ago"
+			}
+			if o.active {
+				health = "up"
+				if x.healthMaxAge > 0 && x.clock.Since(o.lastHandshake) > x.healthMaxAge {
+					health = "stale"
+				}
+			}
+		}
+		endpoint, ok := endpoints[r.wg]
+		if !ok {
+			endpoint = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.label, handshake, endpoint, health)
+	}
+	tw.Flush()
+	return sb.String()
+}
@@ -0,0 +1,94 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MTUWarning describes a wireguard-go log line that indicates a
+// (path) MTU problem.
+type MTUWarning struct {
+	// Peer is the peer the line is about, as labeled in logs,
+	// or empty if the line is about the device as a whole.
+	Peer string
+	// Line is the wireguard-go line, without peer rewriting.
+	Line string
+}
+
+// mtuPhrases are the phrases, in lowercase, that mark a line as being
+// about an MTU problem. wireguard-go reports these in free text, mostly
+// as the error in "Failed to send ..." lines.
+var mtuPhrases = []string{
+	"message too long", // EMSGSIZE
+	"packet too big",
+	"fragmentation needed",
+	"too large, capped at", // "MTU updated: %v (too large, capped at %v)"
+	"trouble determining mtu",
+	"mtu not updated",
+}
+
+// mtuWatcher recognizes MTU problems and warns about them, at most once
+// per peer per interval.
+type mtuWatcher struct {
+	interval time.Duration
+	fn       func(MTUWarning) // or nil
+
+	mu     sync.Mutex
+	warned map[string]time.Time // peer label → when it was last warned about
+}
+
+// mayBeMTU reports whether a line with the given format could be about an
+// MTU problem, and so is worth rendering to check.
+func mayBeMTU(format string) bool {
+	return strings.Contains(format, "Failed to send") ||
+		strings.Contains(format, "MTU") ||
+		strings.Contains(format, "fragment")
+}
+
+// isMTUProblem reports whether the rendered line is about an MTU problem.
+func isMTUProblem(line string) bool {
+	line = strings.ToLower(line)
+	for _, p := range mtuPhrases {
+		if strings.Contains(line, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// check warns, via x, if the line wireguard-go logged with format and
+// args is about an MTU problem that has not been warned about recently.
+func (w *mtuWatcher) check(x *Logger, format string, args []any) {
+	if !mayBeMTU(format) {
+		return
+	}
+	line := fmt.Sprintf(format, args...)
+	if !isMTUProblem(line) {
+		return
+	}
+	peer := x.peerLabelOf(args)
+
+	now := x.clock.Now()
+	w.mu.Lock()
+	last, ok := w.warned[peer]
+	if ok && now.Sub(last) < w.interval {
+		w.mu.Unlock()
+		return
+	}
+	w.warned[peer] = now
+	w.mu.Unlock()
+
+	if peer == "" {
+		x.logf("%s[unexpected] possible MTU problem: %s", x.prefix, line)
+	} else {
+		x.logf("%s[unexpected] possible path MTU problem with peer %s: %s", x.prefix, peer, line)
+	}
+	if w.fn != nil {
+		w.fn(MTUWarning{Peer: peer, Line: line})
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// An observer tracks per-peer state derived from wireguard-go's log lines.
+type observer struct {
+	mu    sync.Mutex
+	peers map[string]*peerObs // keyed by wireguard-go peer string
+}
+
+// peerObs is what has been observed about a single peer.
+type peerObs struct {
+	lastHandshake time.Time // when a handshake last completed; zero if never
+	active        bool      // whether the peer has a session, as far as we know
+}
+
+// transition is a change in a peer's observed state.
+type transition int
+
+const (
+	noTransition transition = iota
+	becameActive
+	becameIdle
+)
+
+// peerLocked returns the state for peer, creating it if needed.
+// o.mu must be held.
+func (o *observer) peerLocked(peer string) *peerObs {
+	p, ok := o.peers[peer]
+	if !ok {
+		if o.peers == nil {
+			o.peers = make(map[string]*peerObs)
+		}
+		p = new(peerObs)
+		o.peers[peer] = p
+	}
+	return p
+}
+
+// observe records what a line with the given format, about peer, says.
+// It reports whether the line changed whether the peer is active.
+func (o *observer) observe(peer, format string, now time.Time) transition {
+	if peer == "" {
+		return noTransition
+	}
+	complete := isHandshakeComplete(format)
+	idle := isSessionLost(format)
+	if !complete && !idle {
+		return noTransition
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	p := o.peerLocked(peer)
+	if complete {
+		p.lastHandshake = now
+		if !p.active {
+			p.active = true
+			return becameActive
+		}
+	} else if p.active {
+		p.active = false
+		return becameIdle
+	}
+	return noTransition
+}
+
+// lastHandshake returns when a handshake with peer was last observed
+// to complete, or the zero time if never.
+func (o *observer) lastHandshake(peer string) time.Time {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if p, ok := o.peers[peer]; ok {
+		return p.lastHandshake
+	}
+	return time.Time{}
+}
+
+// isHandshakeComplete reports whether a line with the given format
+// reports a successfully completed handshake.
+func isHandshakeComplete(format string) bool {
+	return classifyHandshake(format) == hsEnd && !isHandshakeAbandoned(format)
+}
+
+// isSessionLost reports whether a line with the given format reports
+// that a peer no longer has a session: either a handshake was abandoned,
+// or its keys expired.
+func isSessionLost(format string) bool {
+	return isHandshakeAbandoned(format) || strings.Contains(format, "Removing all keys")
+}
+
+// isPeerEvent reports whether a line with the given format is one of the
+// per-event lines that edge-triggered mode replaces with transition lines.
+func isPeerEvent(format string) bool {
+	return classifyHandshake(format) != hsNone ||
+		strings.Contains(format, "keepalive packet") ||
+		strings.Contains(format, "Removing all keys")
+}
+
+// snapshot returns a copy of what has been observed about each peer.
+func (o *observer) snapshot() map[string]peerObs {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	m := make(map[string]peerObs, len(o.peers))
+	for k, p := range o.peers {
+		m[k] = *p
+	}
+	return m
+}
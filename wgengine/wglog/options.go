@@ -0,0 +1,206 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tailscale.com/tstime"
+	"tailscale.com/types/logger"
+)
+
+// Options configures a Logger created by NewLoggerWithOptions. The zero
+// value is the default configuration, the same as NewLogger with no
+// Options. Each field corresponds to the Option of the same name, whose
+// docs describe it.
+type Options struct {
+	// Prefix and peer labels.
+	DeviceName     string                                     // WithDeviceName
+	LabelTemplate  string                                     // WithLabelTemplate, if non-empty
+	RewriteFunc    func(wgStr string) (label string, ok bool) // WithRewriteFunc, if non-nil
+	RewriteTTL     time.Duration                              // WithRewriteTTL, if positive
+	HealthMaxAge   time.Duration                              // WithHealthMarkers, if positive
+	PeerIdentifier func(arg any) (id string, ok bool)         // WithPeerIdentifier, if non-nil
+	OnUnknownPeer  func(peer string)                          // WithUnknownPeerFunc, if non-nil
+
+	// Filtering and summarizing.
+	Leveled          bool             // WithLeveled
+	Policies         map[Class]Policy // WithPolicies
+	Rules            []Rule           // WithRules, if non-nil
+	EdgeTriggered    bool             // WithEdgeTriggered
+	DeviceFold       time.Duration    // WithDeviceFold, if positive
+	FlapCoalescing   *FlapOptions     // WithFlapCoalescing, if non-nil
+	FirstNThenSample *SampleOptions   // WithFirstNThenSample, if non-nil
+
+	// Diagnostics.
+	HandshakeCorrelation bool                   // WithHandshakeCorrelation
+	HandshakeLatency     time.Duration          // WithHandshakeLatency timeout, if positive
+	MTUWarnings          *MTUOptions            // WithMTUWarnings, if non-nil
+	LevelHistogram       *logger.LevelHistogram // WithLevelHistogram, if non-nil
+	SidecarPath          string                 // WithSidecarFile, if non-empty
+
+	// Clock is the Logger's time source; see WithClock.
+	// If nil, the system clock is used.
+	Clock tstime.Clock
+}
+
+// FlapOptions are the parameters of WithFlapCoalescing.
+type FlapOptions struct {
+	Window    time.Duration
+	Threshold int
+}
+
+// SampleOptions are the parameters of WithFirstNThenSample.
+type SampleOptions struct {
+	N, Rate int
+}
+
+// MTUOptions are the parameters of WithMTUWarnings.
+type MTUOptions struct {
+	Interval time.Duration
+	Func     func(MTUWarning) // optional
+}
+
+// NewLoggerWithOptions is like NewLogger, but is configured by opts.
+// It returns an error if opts are invalid or conflict, such as a negative
+// duration, a label template that does not parse, or features that
+// would disable each other.
+func NewLoggerWithOptions(logf logger.Logf, opts Options) (*Logger, error) {
+	list, err := opts.options()
+	if err != nil {
+		return nil, err
+	}
+	return NewLogger(logf, list...), nil
+}
+
+// options validates o and returns the Options it corresponds to.
+func (o Options) options() ([]Option, error) {
+	var errs []error
+	for _, d := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"RewriteTTL", o.RewriteTTL},
+		{"HealthMaxAge", o.HealthMaxAge},
+		{"DeviceFold", o.DeviceFold},
+		{"HandshakeLatency", o.HandshakeLatency},
+	} {
+		if d.d < 0 {
+			errs = append(errs, fmt.Errorf("%s is negative (%v)", d.name, d.d))
+		}
+	}
+	if f := o.FlapCoalescing; f != nil {
+		if f.Window <= 0 {
+			errs = append(errs, fmt.Errorf("FlapCoalescing.Window is not positive (%v)", f.Window))
+		}
+		if f.Threshold < 1 {
+			errs = append(errs, fmt.Errorf("FlapCoalescing.Threshold is less than 1 (%d)", f.Threshold))
+		}
+		if p, ok := o.Policies[ClassInterfaceUpDown]; ok && p != Drop {
+			errs = append(errs, fmt.Errorf("FlapCoalescing requires the %s policy to be Drop, not %v", ClassInterfaceUpDown, p))
+		}
+	}
+	if s := o.FirstNThenSample; s != nil && (s.N < 0 || s.Rate < 0) {
+		errs = append(errs, fmt.Errorf("FirstNThenSample has a negative N or Rate (%d, %d)", s.N, s.Rate))
+	}
+	if m := o.MTUWarnings; m != nil && m.Interval < 0 {
+		errs = append(errs, fmt.Errorf("MTUWarnings.Interval is negative (%v)", m.Interval))
+	}
+	for c, p := range o.Policies {
+		if p.action == rateLimit && (p.tick <= 0 || p.burst < 1) {
+			errs = append(errs, fmt.Errorf("policy for %s is an invalid %v", c, p))
+		}
+	}
+	for i, r := range o.Rules {
+		if p := r.Policy; p.action == rateLimit && (p.tick <= 0 || p.burst < 1) {
+			errs = append(errs, fmt.Errorf("policy for rule %d is an invalid %v", i, p))
+		}
+	}
+	if o.EdgeTriggered && o.DeviceFold > 0 {
+		// Edge-triggered mode consumes the handshake lines that the
+		// fold would summarize.
+		errs = append(errs, errors.New("EdgeTriggered and DeviceFold are mutually exclusive"))
+	}
+	var label, rules Option
+	if o.LabelTemplate != "" {
+		var err error
+		if label, err = WithLabelTemplate(o.LabelTemplate); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if o.Rules != nil {
+		var err error
+		if rules, err = WithRules(o.Rules); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("wglog: invalid options: %w", err)
+	}
+
+	var opts []Option
+	if o.DeviceName != "" {
+		opts = append(opts, WithDeviceName(o.DeviceName))
+	}
+	if label != nil {
+		opts = append(opts, label)
+	}
+	if o.RewriteFunc != nil {
+		opts = append(opts, WithRewriteFunc(o.RewriteFunc))
+	}
+	if o.RewriteTTL > 0 {
+		opts = append(opts, WithRewriteTTL(o.RewriteTTL))
+	}
+	if o.HealthMaxAge > 0 {
+		opts = append(opts, WithHealthMarkers(o.HealthMaxAge))
+	}
+	if o.PeerIdentifier != nil {
+		opts = append(opts, WithPeerIdentifier(o.PeerIdentifier))
+	}
+	if o.OnUnknownPeer != nil {
+		opts = append(opts, WithUnknownPeerFunc(o.OnUnknownPeer))
+	}
+	if o.Leveled {
+		opts = append(opts, WithLeveled())
+	}
+	if o.Policies != nil {
+		opts = append(opts, WithPolicies(o.Policies))
+	}
+	if rules != nil {
+		opts = append(opts, rules)
+	}
+	if o.EdgeTriggered {
+		opts = append(opts, WithEdgeTriggered(true))
+	}
+	if o.DeviceFold > 0 {
+		opts = append(opts, WithDeviceFold(o.DeviceFold))
+	}
+	if f := o.FlapCoalescing; f != nil {
+		opts = append(opts, WithFlapCoalescing(f.Window, f.Threshold))
+	}
+	if s := o.FirstNThenSample; s != nil {
+		opts = append(opts, WithFirstNThenSample(s.N, s.Rate))
+	}
+	if o.HandshakeCorrelation {
+		opts = append(opts, WithHandshakeCorrelation())
+	}
+	if o.HandshakeLatency > 0 {
+		opts = append(opts, WithHandshakeLatency(o.HandshakeLatency))
+	}
+	if m := o.MTUWarnings; m != nil {
+		opts = append(opts, WithMTUWarnings(m.Interval, m.Func))
+	}
+	if o.LevelHistogram != nil {
+		opts = append(opts, WithLevelHistogram(o.LevelHistogram))
+	}
+	if o.SidecarPath != "" {
+		opts = append(opts, WithSidecarFile(o.SidecarPath))
+	}
+	if o.Clock != nil {
+		opts = append(opts, WithClock(o.Clock))
+	}
+	return opts, nil
+}
@@ -0,0 +1,196 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
+)
+
+// A Class is a class of noisy wireguard-go log line that a Logger
+// filters according to a Policy.
+type Class string
+
+const (
+	// ClassRoutine is wireguard-go's lines about starting and stopping
+	// its goroutines ("Routine: ...").
+	ClassRoutine Class = "routine"
+	// ClassSendFailure is "Failed to send data packets" lines.
+	// See https://github.com/tailscale/tailscale/issues/1239.
+	ClassSendFailure Class = "send-failure"
+	// ClassInterfaceUpDown is "Interface up/down requested" lines, logged
+	// every second while the tun device is open.
+	// See https://github.com/tailscale/tailscale/issues/1388.
+	ClassInterfaceUpDown Class = "interface-up-down"
+	// ClassAddingAllowedIP is "Adding allowedip" lines, which can be
+	// numerous and are not specific enough to be useful.
+	// See https://github.com/tailscale/corp/issues/17532.
+	ClassAddingAllowedIP Class = "adding-allowedip"
+)
+
+// classify returns the Class of a line with the given format,
+// if it belongs to one.
+func classify(format string) (_ Class, ok bool) {
+	switch {
+	case strings.Contains(format, "Routine:") && !strings.Contains(format, "receive incoming"):
+		return ClassRoutine, true
+	case strings.Contains(format, "Failed to send data packet"):
+		return ClassSendFailure, true
+	case isInterfaceUpDown(format):
+		return ClassInterfaceUpDown, true
+	case strings.Contains(format, "Adding allowedip"):
+		return ClassAddingAllowedIP, true
+	}
+	return "", false
+}
+
+// A Policy is what a Logger does with the lines of a Class.
+// Every Class is dropped by default.
+type Policy struct {
+	action policyAction
+	tick   time.Duration // for rateLimit
+	burst  int           // for rateLimit
+	level  logger.Level  // for atLevel
+}
+
+type policyAction int
+
+const (
+	drop policyAction = iota
+	pass
+	rateLimit
+	atLevel
+)
+
+var (
+	// Drop drops every line of the Class.
+	Drop = Policy{action: drop}
+	// Pass logs every line of the Class, as for unclassified lines.
+	Pass = Policy{action: pass}
+)
+
+// RateLimit logs lines of the Class subject to a rate limit of one line
+// every tick, in bursts of up to burst lines, separately for each peer.
+// See [logger.RateLimitedFn]; as there, burst should be at least 2.
+func RateLimit(tick time.Duration, burst int) Policy {
+	return Policy{action: rateLimit, tick: tick, burst: burst}
+}
+
+// AtLevel logs lines as if wireguard-go had logged them at level l: at
+// logger.Debug, as verbose lines, marked "[v2]" and subject to
+// WithLeveled; at logger.Warn, marked "[unexpected]"; and otherwise as
+// error lines. Only Rules can have it; a Class with it logs every line.
+func AtLevel(l logger.Level) Policy {
+	return Policy{action: atLevel, level: l}
+}
+
+func (p Policy) String() string {
+	switch p.action {
+	case drop:
+		return "Drop"
+	case pass:
+		return "Pass"
+	case rateLimit:
+		return fmt.Sprintf("RateLimit(%v, %d)", p.tick, p.burst)
+	case atLevel:
+		return fmt.Sprintf("AtLevel(%v)", p.level)
+	}
+	return fmt.Sprintf("Policy(%d)", p.action)
+}
+
+// WithPolicies sets the Policy for each Class in policies.
+// Classes not in policies keep the default, Drop.
+func WithPolicies(policies map[Class]Policy) Option {
+	return func(x *Logger) {
+		for c, p := range policies {
+			mak.Set(&x.policies, c, p)
+		}
+	}
+}
+
+// limiterKey identifies a rate-limited Logf.
+type limiterKey struct {
+	class Class  // empty for a Rule
+	rule  int    // index of the Rule in WithRules, for a Rule
+	peer  string // wireguard-go peer string, or empty
+}
+
+// maxLimiters bounds the number of limiters a Logger keeps. Lines whose
+// limiter would exceed it share the limiter of their Class or Rule with
+// the lines about no peer in particular.
+const maxLimiters = 1000
+
+// A limiter rate limits the lines of one limiterKey, reporting which
+// lines it passes.
+type limiter struct {
+	mu     sync.Mutex // serializes log, so that passed is for its line
+	lf     logger.Logf
+	format string // line being logged; under mu
+	passed bool   // whether it was passed on; under mu
+}
+
+// log logs the line to the limiter and reports whether it was passed on,
+// rather than suppressed by the rate limit.
+func (l *limiter) log(format string, args []any) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.format, l.passed = format, false
+	l.lf(format, args...)
+	return l.passed
+}
+
+// rateLimited returns the limiter for the lines identified by k,
+// subject to policy p.
+func (x *Logger) rateLimited(k limiterKey, p Policy) *limiter {
+	x.limitersMu.Lock()
+	defer x.limitersMu.Unlock()
+	if l, ok := x.limiters[k]; ok {
+		return l
+	}
+	if len(x.limiters) >= maxLimiters && k.peer != "" {
+		k.peer = ""
+		if l, ok := x.limiters[k]; ok {
+			return l
+		}
+	}
+	l := new(limiter)
+	l.lf = logger.RateLimitedFnWithClock(func(format string, args ...any) {
+		if format == l.format {
+			// Not the rate limiter's own notice of suppression.
+			l.passed = true
+		}
+		x.logf(format, args...)
+	}, p.tick, p.burst, 10, x.clock.Now)
+	mak.Set(&x.limiters, k, l)
+	return l
+}
+
+// retainLimiters forgets the limiters of the peers, by wireguard-go
+// peer string, for which keep reports false, so that peer churn does not
+// accumulate them.
+func (x *Logger) retainLimiters(keep func(peer string) bool) {
+	x.limitersMu.Lock()
+	defer x.limitersMu.Unlock()
+	for k := range x.limiters {
+		if k.peer != "" && !keep(k.peer) {
+			delete(x.limiters, k)
+		}
+	}
+}
+
+// firstPeer returns the wireguard-go string of the first peer in args,
+// or the empty string if there is none.
+func (x *Logger) firstPeer(args []any) string {
+	for _, arg := range args {
+		if wgStr, isPeer, _ := x.identifyPeer(arg); isPeer {
+			return wgStr
+		}
+	}
+	return ""
+}
@@ -0,0 +1,66 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// ReplayReader reads wireguard-go lines captured from a Logger in raw mode
+// (TS_DEBUG_RAW_WGLOG) from r, one per line, and runs each through x as if
+// wireguard-go had just logged it, so that filter changes can be checked
+// against real traffic offline.
+//
+// Anything before "wg: " on a line, such as a timestamp, is ignored, as
+// are lines without it. Lines continuing with "[v2] " are replayed as
+// verbose lines and others as errors. Peer strings like "peer(IMTB…r7lM)"
+// are passed as arguments, so that they are rewritten as usual.
+func (x *Logger) ReplayReader(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		_, line, ok := strings.Cut(sc.Text(), "wg: ")
+		if !ok {
+			continue
+		}
+		logf := x.DeviceLogger.Errorf
+		if rest, ok := strings.CutPrefix(line, "[v2] "); ok {
+			logf, line = x.DeviceLogger.Verbosef, rest
+		}
+		format, args := replayArgs(line)
+		logf(format, args...)
+	}
+	return sc.Err()
+}
+
+// replayArgs returns a format and args that produce line, with each
+// wireguard-go peer string in line as an argument.
+func replayArgs(line string) (format string, args []any) {
+	var sb strings.Builder
+	for {
+		i := strings.Index(line, "peer(")
+		if i < 0 {
+			break
+		}
+		j := strings.IndexByte(line[i:], ')')
+		if j < 0 || !isWireGuardPeerString(line[i:i+j+1]) {
+			sb.WriteString(strings.ReplaceAll(line[:i+len("peer(")], "%", "%%"))
+			line = line[i+len("peer("):]
+			continue
+		}
+		sb.WriteString(strings.ReplaceAll(line[:i], "%", "%%"))
+		sb.WriteString("%v")
+		args = append(args, replayedPeer(line[i:i+j+1]))
+		line = line[i+j+1:]
+	}
+	sb.WriteString(strings.ReplaceAll(line, "%", "%%"))
+	return sb.String(), args
+}
+
+// replayedPeer is a peer string from a replayed line. Like *device.Peer,
+// it is a fmt.Stringer.
+type replayedPeer string
+
+func (p replayedPeer) String() string { return string(p) }
@@ -0,0 +1,92 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"tailscale.com/types/logger"
+)
+
+// A Rule applies Policy to the wireguard-go lines whose format strings,
+// such as "%v - Sending handshake initiation", match the regexp Pattern.
+// See WithRules.
+type Rule struct {
+	Pattern string
+	Policy  Policy
+}
+
+// compiledRule is a Rule with its Pattern compiled.
+type compiledRule struct {
+	re     *regexp.Regexp
+	policy Policy
+}
+
+// WithRules makes the Logger apply the first of rules whose Pattern
+// matches each line's format, in place of the Policy of the line's Class,
+// if any. Lines that match no rule are filtered by Class as usual. Rules
+// can drop, pass, rate limit (separately per rule and peer), or re-level
+// lines with AtLevel, so that exceptions go before the broader rules they
+// are exceptions to:
+//
+//	wglog.WithRules([]wglog.Rule{
+//		{`Routine: receive incoming`, wglog.Pass},
+//		{`Routine:`, wglog.Drop},
+//		{`Retrying handshake`, wglog.AtLevel(logger.Warn)},
+//	})
+//
+// Patterns are matched against the format wireguard-go logs with, not the
+// formatted line, and without the Logger's prefix. Lines that a rule
+// drops are still summarized by WithFlapCoalescing. WithRules returns an
+// error if any Pattern does not compile. See DefaultRules.
+func WithRules(rules []Rule) (Option, error) {
+	compiled := make([]compiledRule, len(rules))
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("wglog: rule %d: %w", i, err)
+		}
+		compiled[i] = compiledRule{re, r.Policy}
+	}
+	return func(x *Logger) { x.rules = compiled }, nil
+}
+
+// DefaultRules returns the rules equivalent to the default Policy of every
+// Class, with which a Logger behaves as it does without WithRules. It is a
+// starting point for rule tables that tweak the defaults.
+func DefaultRules() []Rule {
+	return []Rule{
+		{`Routine: receive incoming`, Pass},
+		{`Routine:`, Drop},
+		{`Failed to send data packet`, Drop},
+		{`Interface (up|down) requested`, Drop},
+		{`Adding allowedip`, Drop},
+	}
+}
+
+// matchRule returns the index of the first of x's rules that matches
+// format, which is without x's prefix, and reports whether there is one.
+func (x *Logger) matchRule(format string) (int, bool) {
+	for i, r := range x.rules {
+		if r.re.MatchString(format) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// atLevel returns the origin of the lines that x logs at level l, for
+// AtLevel, and format, of a line logged via o, rewritten with its prefix.
+func (x *Logger) atLevel(l logger.Level, o *origin, format string) (*origin, string) {
+	format = strings.TrimPrefix(format, o.prefix)
+	switch {
+	case l <= logger.Debug:
+		return &x.verbose, x.verbose.prefix + format
+	case l == logger.Warn:
+		return &x.errors, x.errors.prefix + "[unexpected] " + format
+	}
+	return &x.errors, x.errors.prefix + format
+}
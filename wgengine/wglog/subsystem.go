@@ -0,0 +1,62 @@
+// Copyright (c) Tailscale Inc & AUTHORS
+// SPDX-License-Identifier: BSD-3-Clause
+
+package wglog
+
+import "strings"
+
+// subsystems maps substrings of wireguard-go lines to the subsystem that
+// logs them. The first match wins; lines matching none are from "device".
+var subsystems = []struct {
+	substr, name string
+}{
+	{"Retrying handshake", "timers"},
+	{"Handshake did not complete", "timers"},
+	{"Removing all keys", "timers"},
+	{"UAPI:", "uapi"},
+	{"TUN", "tun"},
+	{"Interface up requested", "tun"},
+	{"Interface down requested", "tun"},
+	{"Routine: receive", "receive"},
+	{"Routine: sequential receiver", "receive"},
+	{"Routine: decryption worker", "receive"},
+	{"Received ", "receive"},
+	{"Receiving ", "receive"},
+	{"Routine: sequential sender", "send"},
+	{"Routine: encryption worker", "send"},
+	{"Sending ", "send"},
+	{"Failed to send", "send"},
+}
+
+// subsystem returns the wireguard-go subsystem that logged a line with
+// the given format.
+func subsystem(format string) string {
+	for _, s := range subsystems {
+		if strings.Contains(format, s.substr) {
+			return s.name
+		}
+	}
+	return "device"
+}
+
+// SetVerboseSubsystems makes x drop wireguard-go's verbose lines except
+// those from the named subsystems, replacing any previously set. Error
+// lines are unaffected. The subsystems are "receive" (inbound packets and
+// handshakes), "send" (outbound), "timers" (handshake retries and key
+// expiry), "uapi" (configuration), "tun" (the TUN device) and "device"
+// (everything else).
+//
+// Calling SetVerboseSubsystems with no names re-enables verbose lines from
+// all subsystems, the default. SetVerboseSubsystems is safe for concurrent
+// use.
+func (x *Logger) SetVerboseSubsystems(names ...string) {
+	if len(names) == 0 {
+		x.verboseSubsystems.Store(nil)
+		return
+	}
+	m := make(map[string]bool, len(names))
+	for _, name := range names {
+		m[name] = true
+	}
+	x.verboseSubsystems.Store(m)
+}
@@ -5,15 +5,24 @@
 package wglog
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/netip"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
 
 	"github.com/tailscale/wireguard-go/device"
+	"tailscale.com/atomicfile"
 	"tailscale.com/envknob"
+	"tailscale.com/metrics"
 	"tailscale.com/syncs"
+	"tailscale.com/tstime"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
+	"tailscale.com/util/mak"
 	"tailscale.com/wgengine/wgcfg"
 )
 
@@ -21,105 +30,750 @@
 // It can be modified at run time to adjust to new wireguard-go configurations.
 type Logger struct {
 	DeviceLogger *device.Logger
+	logf         logger.Logf // logs to the current sink
+	raw          bool        // TS_DEBUG_RAW_WGLOG: log lines without filtering or rewriting
+	prefix       string      // "wg: ", or "wg(name): " with WithDeviceName
+	verbose      origin      // wireguard-go's Verbosef
+	errors       origin      // wireguard-go's Errorf
 	replace      syncs.AtomicValue[map[string]string]
-	mu           sync.Mutex                   // protects strs
-	strs         map[key.NodePublic]*strCache // cached strs used to populate replace
+	retired      syncs.AtomicValue[map[string]retiredLabel] // recently removed peers; see WithRewriteTTL
+	silent       syncs.AtomicValue[map[string]bool]         // wireguard-go strings of peers whose lines are dropped
+	sink         syncs.AtomicValue[logger.Logf]             // sink for rewritten lines; see SetSink
+	mu           sync.Mutex                                 // protects strs and regions
+	strs         map[key.NodePublic]*strCache               // cached strs used to populate replace
+	regions      map[key.NodePublic]string                  // DERP home region codes, from SetPeerRegions
+
+	leveled       bool              // drop verbose lines unless logger.GlobalVerbosity permits them
+	deviceName    string            // if non-empty, included in the prefix of each line
+	onUnknownPeer func(peer string) // optional; called for each unknown peer logged
+	rewriteTTL    time.Duration     // how long to keep rewriting removed peers
+	handshakes    *handshakeTracker // non-nil if handshake lines are annotated with attempt IDs
+	healthMaxAge  time.Duration     // if non-zero, label peers with whether they handshook this recently
+	sidecarPath   string            // if non-empty, SetPeers writes the key→label map here
+	mtu           *mtuWatcher       // non-nil if MTU problems are warned about
+	policies      map[Class]Policy  // non-default policies for noisy line classes
+	flaps         *flapCoalescer    // non-nil if interface up/down lines are summarized
+	fold          *deviceFold       // non-nil if handshake lines are summarized across peers
+	latency       *latencyTracker   // non-nil if handshake latency is measured
+	edgeTriggered bool              // log peer state transitions instead of per-event lines
+	obs           *observer         // non-nil if any option needs per-peer observed state
+	clock         tstime.DefaultClock
+
+	// identifyPeer formats a log arg as a string, if it has one, and
+	// reports whether that string is a peer's wireguard-go string, so that
+	// callers need not format the arg again. It defaults to
+	// identifyWireGuardPeer; see WithPeerIdentifier.
+	identifyPeer func(arg any) (s string, isPeer, ok bool)
+
+	// rewrite, if non-nil, looks up peer labels live; see WithRewriteFunc.
+	rewrite func(wgStr string) (label string, ok bool)
+
+	peerKeys  syncs.AtomicValue[map[string]key.NodePublic] // wireguard-go strings of peers to their keys, for events
+	eventSink syncs.AtomicValue[func(Event)]               // optional; see SetEventSink
+
+	verboseSubsystems syncs.AtomicValue[map[string]bool] // if non-nil, the only subsystems whose verbose lines are logged
+
+	idle      idleWatcher     // reports peers idle for longer than their IdleTimeout
+	endpoints endpointTracker // last endpoint logged per peer; see PeerEndpoints
+
+	levels    *logger.LevelHistogram // if non-nil, counts emitted lines by level; see WithLevelHistogram
+	firstN    *firstNSampler         // non-nil if repeated formats are sampled; see WithFirstNThenSample
+	labelTmpl *template.Template     // if non-nil, renders peer labels; see WithLabelTemplate
+	rules     []compiledRule         // see WithRules
+
+	limitersMu sync.Mutex
+	limiters   map[limiterKey]*limiter // for RateLimit policies; see maxLimiters
+
+	unknownPeers atomic.Int64 // number of unknown peers logged
+}
+
+// Stats are counters describing what a Logger has seen.
+type Stats struct {
+	// UnknownPeers is the number of times wireguard-go logged a peer
+	// that was not in the set most recently installed by SetPeers.
+	// A non-zero value usually indicates that the device was reconfigured
+	// before SetPeers was called, or that SetPeers was given a stale set.
+	UnknownPeers int64
+
+	// Verbose and Error count the lines that wireguard-go logged
+	// via its Verbosef and Errorf functions, respectively.
+	Verbose, Error SinkStats
+}
+
+// SinkStats count the lines logged via one of wireguard-go's log functions.
+type SinkStats struct {
+	Emitted    int64 // lines passed on to the underlying Logf
+	Dropped    int64 // lines filtered out
+	Suppressed int64 // lines dropped by the rate limit of a RateLimit policy
+}
+
+// Stats returns a snapshot of x's counters.
+func (x *Logger) Stats() Stats {
+	return Stats{
+		UnknownPeers: x.unknownPeers.Load(),
+		Verbose:      x.verbose.stats(),
+		Error:        x.errors.stats(),
+	}
+}
+
+// HandshakeLatency returns the histogram of the latency, in seconds, of
+// handshakes initiated with peers, as measured by WithHandshakeLatency.
+// It is nil unless that option was given. It is an expvar.Var, suitable
+// for publishing.
+func (x *Logger) HandshakeLatency() *metrics.Histogram {
+	if x.latency == nil {
+		return nil
+	}
+	return x.latency.hist
+}
+
+// LogStats implements [logger.StatsSource], so that x can be registered
+// with a [logger.Registry].
+func (x *Logger) LogStats() logger.LogStats {
+	st := x.Stats()
+	level := logger.Debug
+	if x.leveled {
+		level = logger.GlobalVerbosity()
+	}
+	return logger.LogStats{
+		Level:   level,
+		Emitted: st.Verbose.Emitted + st.Error.Emitted,
+		Dropped: st.Verbose.Dropped + st.Error.Dropped + st.Verbose.Suppressed + st.Error.Suppressed,
+	}
+}
+
+func (o *origin) stats() SinkStats {
+	return SinkStats{
+		Emitted:    o.emitted.Load(),
+		Dropped:    o.dropped.Load(),
+		Suppressed: o.suppressed.Load(),
+	}
+}
+
+// An Option configures optional Logger behavior.
+type Option func(*Logger)
+
+// WithLeveled enables leveled mode, in which wireguard-go's verbose lines
+// are treated as [logger.Debug] and are dropped unless the process-wide
+// [logger.GlobalVerbosity] is [logger.Debug].
+func WithLeveled() Option {
+	return func(x *Logger) { x.leveled = true }
 }
 
 // strCache holds a wireguard-go and a Tailscale style peer string.
 type strCache struct {
-	wg, ts string
-	used   bool // track whether this strCache was used in a particular round
+	wg, ts  string
+	name    string    // the peer's wgcfg.Peer.Name when ts was computed
+	region  string    // the peer's DERP home region when ts was computed
+	used    bool      // track whether this strCache was used in a particular round
+	removed time.Time // when the peer was first absent from SetPeers; zero if present
+}
+
+// retiredLabel is the Tailscale style string of a recently removed peer.
+type retiredLabel struct {
+	ts      string
+	expires time.Time
+}
+
+// WithUnknownPeerFunc registers fn to be called with wireguard-go's
+// abbreviation of a peer (such as "peer(IMTB…r7lM)") each time a line
+// referencing a peer unknown to SetPeers is logged.
+// Unknown peers are only detected once SetPeers has been called.
+//
+// fn is called synchronously on the logging path; it must be cheap
+// and must not log via x.
+func WithUnknownPeerFunc(fn func(peer string)) Option {
+	return func(x *Logger) { x.onUnknownPeer = fn }
+}
+
+// WithRewriteTTL makes the Logger keep rewriting a peer's key for d after
+// the peer is removed by SetPeers, so that trailing log lines about a
+// just-removed peer still render nicely when peers churn rapidly.
+func WithRewriteTTL(d time.Duration) Option {
+	return func(x *Logger) { x.rewriteTTL = d }
+}
+
+// WithClock makes the Logger use c as its time source.
+// By default it uses the system clock.
+//
+// Every time-based feature uses it: rewrite TTLs, health markers, flap
+// and device-wide coalescing windows, MTU warning deduplication, rate
+// limiting policies, handshake latency, and the timestamps of events and
+// of observed peer state. The system clock's readings are monotonic, so
+// none of them are affected by wall clock jumps.
+func WithClock(c tstime.Clock) Option {
+	return func(x *Logger) { x.clock = tstime.DefaultClock{Clock: c} }
+}
+
+// WithHandshakeCorrelation makes the Logger tag each line relating to a
+// handshake with a peer with an attempt ID, like "[hs#3]", so that all
+// the lines about one handshake attempt can be tied together.
+// Attempt IDs are unique per peer for the life of the process.
+func WithHandshakeCorrelation() Option {
+	return func(x *Logger) { x.handshakes = new(handshakeTracker) }
+}
+
+// WithHealthMarkers makes the Logger append a health marker to each rewritten
+// peer label: "(✓)" if a handshake with the peer was observed to complete
+// within maxAge, and "(✗)" otherwise. For example, "[IMTBr](✓)".
+func WithHealthMarkers(maxAge time.Duration) Option {
+	return func(x *Logger) { x.healthMaxAge = maxAge }
+}
+
+// WithFlapCoalescing makes the Logger summarize wireguard-go's
+// "Interface up/down requested" lines, which it otherwise drops, as
+// "wg: interface flapped N times in <window>". A summary is logged at the
+// end of each window that saw at least threshold such lines.
+func WithFlapCoalescing(window time.Duration, threshold int) Option {
+	return func(x *Logger) {
+		x.flaps = &flapCoalescer{window: window, threshold: threshold}
+	}
+}
+
+// WithSidecarFile makes SetPeers write the current mapping from peer
+// public keys to the labels used in logs to the file at path, as a JSON
+// object. The file is rewritten atomically on each SetPeers, so that logs
+// shared without keys can be reconciled with them out-of-band.
+//
+// It is off by default, since the file exposes the keys that rewriting
+// hides.
+func WithSidecarFile(path string) Option {
+	return func(x *Logger) { x.sidecarPath = path }
+}
+
+// WithMTUWarnings makes the Logger recognize wireguard-go lines indicating
+// MTU problems, such as sends failing with "message too long", and log a
+// distinct "[unexpected] possible path MTU problem with peer ..." warning
+// for them, even if the line itself is dropped. Warnings are deduplicated
+// to at most one per peer per interval. If fn is non-nil, it is also
+// called with each warning.
+func WithMTUWarnings(interval time.Duration, fn func(MTUWarning)) Option {
+	return func(x *Logger) {
+		x.mtu = &mtuWatcher{interval: interval, fn: fn, warned: make(map[string]time.Time)}
+	}
+}
+
+// WithEdgeTriggered, if on, makes the Logger log only when a peer becomes
+// active (completes a handshake) or idle (abandons a handshake or loses its
+// keys), as lines like "wg: peer [IMTBr] became active", instead of the
+// per-event handshake and keepalive lines they are derived from.
+// This greatly reduces log volume for stable networks.
+func WithEdgeTriggered(on bool) Option {
+	return func(x *Logger) { x.edgeTriggered = on }
+}
+
+// WithDeviceFold makes the Logger collapse wireguard-go's handshake lines
+// about all peers into one line per window, like
+// "wg: [v2] handshakes with 3 peers in 10s: [IMTBr], [Ab1cD], [x9YzQ]",
+// logged at the end of each window that saw any. The summary is verbose
+// unless any of the lines it replaces was an error.
+//
+// It is the most aggressive reduction of handshake noise, intended for
+// large tailnets, where even per-peer rate limiting yields many lines
+// when all peers are cycling handshakes.
+func WithDeviceFold(window time.Duration) Option {
+	return func(x *Logger) { x.fold = &deviceFold{window: window} }
+}
+
+// WithHandshakeLatency makes the Logger measure the time between
+// wireguard-go initiating a handshake with a peer and receiving its
+// response, as seen in the lines it logs, and record it in the histogram
+// returned by HandshakeLatency. Handshakes not completed within timeout
+// are not recorded.
+func WithHandshakeLatency(timeout time.Duration) Option {
+	return func(x *Logger) { x.latency = newLatencyTracker(timeout) }
+}
+
+// WithPeerIdentifier makes the Logger use fn to recognize the peer, if any,
+// that a log arg refers to, in place of matching the arg's String method
+// against wireguard-go's formatting of a *device.Peer, such as
+// "peer(IMTB…r7lM)". It decouples peer rewriting from that format.
+//
+// fn reports whether arg is a peer and, if so, returns its identity in the
+// form of key.NodePublic.WireGuardGoString, which is what SetPeers and
+// SetSilentPeers match against. fn is called for every arg of every line
+// and must be cheap.
+func WithPeerIdentifier(fn func(arg any) (id string, ok bool)) Option {
+	return func(x *Logger) {
+		x.identifyPeer = func(arg any) (string, bool, bool) {
+			if id, ok := fn(arg); ok {
+				return id, true, true
+			}
+			if s, ok := arg.(fmt.Stringer); ok {
+				return s.String(), false, true
+			}
+			return "", false, false
+		}
+	}
+}
+
+// WithRewriteFunc makes the Logger consult fn, on every line, for the
+// label of each peer or endpoint string it logs, in the form of
+// key.NodePublic.WireGuardGoString or netip.AddrPort.String. fn reports
+// whether it knows the string and, if so, returns its label.
+//
+// Unlike the snapshot installed by SetPeers, fn can be backed by a data
+// structure that is always current, so that a newly added peer is
+// labeled from its first line, with no window before the next SetPeers.
+// Strings that fn does not know are rewritten by SetPeers as usual.
+//
+// fn is called synchronously on the logging path, for every peer and
+// endpoint arg of every line; it must be cheap, safe for concurrent use,
+// and must not log via x.
+func WithRewriteFunc(fn func(wgStr string) (label string, ok bool)) Option {
+	return func(x *Logger) { x.rewrite = fn }
+}
+
+// WithDeviceName makes the Logger include name, the name of the tun device
+// that its wireguard-go device uses (such as "tailscale0"), in the prefix
+// of every line it logs, as in "wg(tailscale0): [v2] ...", so that the logs
+// of hosts with several devices or tailscaled instances are unambiguous.
+// The prefix keeps the form understood by logger.Normalize as long as name
+// contains no spaces or brackets.
+func WithDeviceName(name string) Option {
+	return func(x *Logger) { x.deviceName = name }
+}
+
+// WithLevelHistogram makes the Logger count the lines it passes on to its
+// sink in h, by the level of the wireguard-go function that logged them:
+// logger.Debug for Verbosef and logger.Error for Errorf. Lines that are
+// dropped are not counted. h may be shared with other subsystems' loggers.
+func WithLevelHistogram(h *logger.LevelHistogram) Option {
+	return func(x *Logger) { x.levels = h }
+}
+
+// WithFirstNThenSample makes the Logger log the first n lines of each
+// distinct wireguard-go format in full, and after that only one in every
+// rate, so that one-time setup lines repeated on every reconnect are
+// logged with their full context once without flooding the logs. A rate
+// of 1 logs every line, and 0 drops every line after the first n.
+//
+// Lines dropped as noise, by a Class Policy, are not counted. Formats
+// are tracked up to a fixed bound, beyond which new formats are sampled
+// together without their first n.
+func WithFirstNThenSample(n, rate int) Option {
+	return func(x *Logger) { x.firstN = &firstNSampler{n: n, rate: rate} }
 }
 
 // NewLogger creates a new logger for use with wireguard-go.
 // This logger silences repetitive/unhelpful noisy log lines
 // and rewrites peer keys from wireguard-go into Tailscale format.
-func NewLogger(logf logger.Logf) *Logger {
-	const prefix = "wg: "
-	ret := new(Logger)
-	wrapper := func(format string, args ...any) {
-		if strings.Contains(format, "Routine:") && !strings.Contains(format, "receive incoming") {
-			// wireguard-go logs as it starts and stops routines.
-			// Drop those; there are a lot of them, and they're just noise.
-			return
-		}
-		if strings.Contains(format, "Failed to send data packet") {
-			// Drop. See https://github.com/tailscale/tailscale/issues/1239.
-			return
-		}
-		if strings.Contains(format, "Interface up requested") || strings.Contains(format, "Interface down requested") {
-			// Drop. Logs 1/s constantly while the tun device is open.
-			// See https://github.com/tailscale/tailscale/issues/1388.
-			return
-		}
-		if strings.Contains(format, "Adding allowedip") {
-			// Drop. See https://github.com/tailscale/corp/issues/17532.
-			// AppConnectors (as one example) may have many subnet routes, and
-			// the messaging related to these is not specific enough to be
-			// useful.
-			return
-		}
-		replace := ret.replace.Load()
-		if replace == nil {
-			// No replacements specified; log as originally planned.
+// See NewLoggerWithOptions for configuring it with an Options struct.
+func NewLogger(logf logger.Logf, opts ...Option) *Logger {
+	ret := &Logger{
+		raw:          envknob.Bool("TS_DEBUG_RAW_WGLOG"),
+		identifyPeer: identifyWireGuardPeer,
+	}
+	ret.sink.Store(logf)
+	ret.logf = func(format string, args ...any) {
+		ret.sink.Load()(format, args...)
+	}
+	for _, opt := range opts {
+		opt(ret)
+	}
+	ret.prefix = "wg: "
+	if ret.deviceName != "" {
+		ret.prefix = "wg(" + ret.deviceName + "): "
+	}
+	prefix := strings.ReplaceAll(ret.prefix, "%", "%%")
+	ret.verbose = origin{prefix: prefix + "[v2] ", level: logger.Debug}
+	ret.errors = origin{prefix: prefix, level: logger.Error}
+	if ret.healthMaxAge > 0 || ret.edgeTriggered {
+		ret.obs = new(observer)
+	}
+	ret.DeviceLogger = buildDeviceLogger(ret.logFunc(&ret.verbose), ret.logFunc(&ret.errors))
+	ret.strs = make(map[key.NodePublic]*strCache)
+	return ret
+}
+
+// origin is one of the two wireguard-go log functions, Verbosef and Errorf.
+type origin struct {
+	prefix string       // prepended to each format
+	level  logger.Level // level of lines logged via this function
+
+	emitted    atomic.Int64 // lines passed on to the sink
+	dropped    atomic.Int64 // lines dropped
+	suppressed atomic.Int64 // lines dropped by a rate limiter
+}
+
+// outcome is what became of a line given to Logger.log.
+type outcome int
+
+const (
+	lineDropped    outcome = iota // filtered out
+	lineEmitted                   // passed on to the sink
+	lineSuppressed                // dropped by the rate limiter of a RateLimit policy
+)
+
+// logFunc returns the wireguard-go log function for o.
+func (x *Logger) logFunc(o *origin) logger.Logf {
+	return func(format string, args ...any) {
+		switch x.log(o, o.prefix+format, args) {
+		case lineEmitted:
+			o.emitted.Add(1)
+			if x.levels != nil {
+				x.levels.Add(o.level)
+			}
+		case lineSuppressed:
+			o.suppressed.Add(1)
+		default:
+			o.dropped.Add(1)
+		}
+	}
+}
+
+// log filters, rewrites, and logs a line that wireguard-go logged via o.
+// It reports what became of the line.
+func (x *Logger) log(o *origin, format string, args []any) outcome {
+	logf := x.logf
+	var lim *limiter // non-nil if the line is subject to a RateLimit policy
+	emit := func(format string, args ...any) outcome {
+		if lim != nil && !lim.log(format, args) {
+			return lineSuppressed
+		}
+		if lim == nil {
 			logf(format, args...)
-			return
-		}
-		// Duplicate the args slice so that we can modify it.
-		// This is not always required, but the code required to avoid it is not worth the complexity.
-		newargs := make([]any, len(args))
-		copy(newargs, args)
-		for i, arg := range newargs {
-			// We want to replace *device.Peer args with the Tailscale-formatted version of themselves.
-			// Using *device.Peer directly makes this hard to test, so we string any fmt.Stringers,
-			// and if the string ends up looking exactly like a known Peer, we replace it.
-			// This is slightly imprecise, in that we don't check the formatting verb. Oh well.
-			s, ok := arg.(fmt.Stringer)
-			if !ok {
-				continue
+		}
+		return lineEmitted
+	}
+	rule, hasRule := -1, false
+	if x.rules != nil && !x.raw {
+		if rule, hasRule = x.matchRule(strings.TrimPrefix(format, o.prefix)); hasRule {
+			if p := x.rules[rule].policy; p.action == atLevel {
+				o, format = x.atLevel(p.level, o, format)
+			}
+		}
+	}
+	if x.leveled && o.level < logger.GlobalVerbosity() {
+		return lineDropped
+	}
+	if x.raw {
+		logf(format, args...)
+		return lineEmitted
+	}
+	if x.mtu != nil {
+		x.mtu.check(x, strings.TrimPrefix(format, o.prefix), args)
+	}
+	if o == &x.verbose {
+		if subs := x.verboseSubsystems.Load(); subs != nil && !subs[subsystem(format)] {
+			return lineDropped
+		}
+	}
+	if hasRule {
+		switch p := x.rules[rule].policy; p.action {
+		case drop:
+			if x.flaps != nil && isInterfaceUpDown(format) {
+				x.flaps.record(x)
+			}
+			return lineDropped
+		case rateLimit:
+			lim = x.rateLimited(limiterKey{rule: rule, peer: x.firstPeer(args)}, p)
+		}
+	} else if c, ok := classify(format); ok {
+		// Noisy lines; see the Class docs. By default they are dropped.
+		switch p := x.policies[c]; p.action {
+		case drop:
+			if c == ClassInterfaceUpDown && x.flaps != nil {
+				// Summarize them instead, to retain the signal
+				// that the interface is unstable.
+				x.flaps.record(x)
+			}
+			return lineDropped
+		case rateLimit:
+			lim = x.rateLimited(limiterKey{class: c, peer: x.firstPeer(args)}, p)
+		}
+	}
+	if x.firstN != nil && !x.firstN.allow(format) {
+		return lineDropped
+	}
+	replace := x.replace.Load()
+	silent := x.silent.Load()
+	sink := x.eventSink.Load()
+	if replace == nil && x.rewrite == nil && silent == nil && sink == nil && x.handshakes == nil && x.obs == nil && x.fold == nil && x.latency == nil {
+		// No replacements specified; log as originally planned.
+		return emit(format, args...)
+	}
+	// Duplicate the args slice so that we can modify it.
+	// This is not always required, but the code required to avoid it is not worth the complexity.
+	newargs := make([]any, len(args))
+	copy(newargs, args)
+	var peer string             // wireguard-go string of the first peer in args, if any
+	var peerLabel string        // peer as rendered in the line
+	var endpoint netip.AddrPort // last netip.AddrPort arg, if any
+	var endpointStr string      // last other non-peer arg, which may format as an endpoint
+	for i, arg := range newargs {
+		// We want to replace *device.Peer args with the Tailscale-formatted version of themselves.
+		// Using *device.Peer directly makes this hard to test, so by default we string any
+		// fmt.Stringers, and if the string ends up looking exactly like a known Peer, we replace it.
+		// This is slightly imprecise, in that we don't check the formatting verb. Oh well.
+		wgStr, isPeer, ok := x.identifyPeer(arg)
+		if !ok {
+			continue
+		}
+		if !isPeer {
+			// Not a peer, but it may be an endpoint. Those that are not
+			// netip.AddrPorts are parsed below, only if there is a peer
+			// to attribute them to.
+			if ap, ok := arg.(netip.AddrPort); ok {
+				endpoint, endpointStr = ap, ""
+			} else {
+				endpointStr = wgStr
 			}
-			wgStr := s.String()
-			tsStr, ok := replace[wgStr]
-			if !ok {
+		}
+		if silent[wgStr] {
+			return lineDropped
+		}
+		if peer == "" && isPeer {
+			peer, peerLabel = wgStr, wgStr
+		}
+		tsStr, ok := x.lookupLabel(replace, wgStr)
+		if !ok {
+			if r, ok := x.retired.Load()[wgStr]; ok && x.clock.Now().Before(r.expires) {
+				newargs[i] = r.ts
+				if wgStr == peer {
+					peerLabel = r.ts
+				}
 				continue
 			}
-			newargs[i] = tsStr
+			if (replace != nil || x.rewrite != nil) && isPeer {
+				x.unknownPeers.Add(1)
+				if x.onUnknownPeer != nil {
+					x.onUnknownPeer(wgStr)
+				}
+			}
+			continue
+		}
+		if x.healthMaxAge > 0 && isPeer {
+			tsStr += x.healthMarker(wgStr)
+		}
+		newargs[i] = tsStr
+		if wgStr == peer {
+			peerLabel = tsStr
+		}
+	}
+	if x.latency != nil && peer != "" {
+		x.latency.observe(peer, format, x.clock.Now())
+	}
+	if peer != "" {
+		x.idle.observe(x, peer, format)
+		if endpointStr != "" {
+			if ap, err := netip.ParseAddrPort(endpointStr); err == nil {
+				endpoint = ap
+			}
+		}
+		if endpoint.IsValid() {
+			x.endpoints.observe(peer, endpoint)
 		}
-		logf(format, newargs...)
 	}
-	if envknob.Bool("TS_DEBUG_RAW_WGLOG") {
-		wrapper = logf
+	if sink != nil {
+		if kind, ok := x.eventKind(o, format); ok {
+			sink(Event{
+				Kind:   kind,
+				Peer:   x.peerKeys.Load()[peer],
+				Label:  peerLabel,
+				Time:   x.clock.Now(),
+				Detail: fmt.Sprintf(strings.TrimPrefix(format, o.prefix), newargs...),
+			})
+		}
 	}
-	ret.DeviceLogger = &device.Logger{
-		Verbosef: logger.WithPrefix(wrapper, prefix+"[v2] "),
-		Errorf:   logger.WithPrefix(wrapper, prefix),
+	if x.obs != nil {
+		tr := x.obs.observe(peer, format, x.clock.Now())
+		if sink != nil && tr != noTransition {
+			ev := Event{Kind: EventBecameActive, Peer: x.peerKeys.Load()[peer], Label: peerLabel, Time: x.clock.Now()}
+			if tr == becameIdle {
+				ev.Kind = EventBecameIdle
+			}
+			sink(ev)
+		}
+		if x.edgeTriggered && isPeerEvent(format) {
+			switch tr {
+			case becameActive:
+				return emit("%speer %v became active", x.prefix, peerLabel)
+			case becameIdle:
+				return emit("%speer %v became idle", x.prefix, peerLabel)
+			}
+			return lineDropped
+		}
 	}
-	ret.strs = make(map[key.NodePublic]*strCache)
-	return ret
+	if x.fold != nil && peer != "" && classifyHandshake(format) != hsNone {
+		x.fold.record(x, o, peerLabel)
+		return lineDropped
+	}
+	if x.handshakes != nil {
+		format, newargs = x.handshakes.annotate(peer, format, newargs)
+	}
+	return emit(format, newargs...)
+}
+
+// SetSink makes x log to logf, which must be non-nil, in place of the
+// Logf it was created with or last given, without losing any of the
+// state x has accumulated, such as peer labels and observed handshakes.
+// It takes effect for the next line logged. SetSink is safe for
+// concurrent use.
+func (x *Logger) SetSink(logf logger.Logf) {
+	x.sink.Store(logf)
+}
+
+// SetSilentPeers makes x drop every line referencing any of peers,
+// regardless of level, replacing any previously set silent peers.
+// It is intended for silencing known-noisy peers while triaging something else.
+// Calling SetSilentPeers with no peers un-silences all peers.
+// SetSilentPeers is safe for concurrent use.
+func (x *Logger) SetSilentPeers(peers ...key.NodePublic) {
+	if len(peers) == 0 {
+		x.silent.Store(nil)
+		return
+	}
+	silent := make(map[string]bool, len(peers))
+	for _, k := range peers {
+		silent[k.WireGuardGoString()] = true
+	}
+	x.silent.Store(silent)
+}
+
+// peerLabelOf returns the label of the first known peer in args,
+// or the empty string if there is none.
+func (x *Logger) peerLabelOf(args []any) string {
+	replace := x.replace.Load()
+	for _, arg := range args {
+		if wgStr, isPeer, _ := x.identifyPeer(arg); isPeer {
+			if ts, ok := x.lookupLabel(replace, wgStr); ok {
+				return ts
+			}
+			return wgStr
+		}
+	}
+	return ""
+}
+
+// lookupLabel returns the label of wgStr, a wireguard-go peer string or
+// an endpoint, from x's rewrite func, if any, or else from replace, the
+// snapshot installed by SetPeers.
+func (x *Logger) lookupLabel(replace map[string]string, wgStr string) (label string, ok bool) {
+	if x.rewrite != nil {
+		if label, ok := x.rewrite(wgStr); ok {
+			return label, true
+		}
+	}
+	label, ok = replace[wgStr]
+	return label, ok
+}
+
+// healthMarker returns the health marker to append to the label of peer,
+// which is a wireguard-go peer string.
+func (x *Logger) healthMarker(peer string) string {
+	last := x.obs.lastHandshake(peer)
+	if !last.IsZero() && x.clock.Since(last) <= x.healthMaxAge {
+		return "(✓)"
+	}
+	return "(✗)"
+}
+
+// identifyWireGuardPeer is the default peer identifier. It formats args
+// with their String method, and recognizes those formatted like a
+// *device.Peer.
+func identifyWireGuardPeer(arg any) (s string, isPeer, ok bool) {
+	st, ok := arg.(fmt.Stringer)
+	if !ok {
+		return "", false, false
+	}
+	s = st.String()
+	return s, isWireGuardPeerString(s), true
+}
+
+// isWireGuardPeerString reports whether s looks like wireguard-go's
+// formatting of a *device.Peer, as produced by key.NodePublic.WireGuardGoString.
+func isWireGuardPeerString(s string) bool {
+	return strings.HasPrefix(s, "peer(") && strings.HasSuffix(s, ")")
+}
+
+// SetPeerRegions sets the DERP home region code (such as "nyc") of each
+// peer in regions, so that their labels include it, like "[IMTBr][nyc]",
+// making it easy to spot which peers route through which DERP region.
+// It is off unless called; peers not in regions are labeled as usual.
+// Changes take effect on the next SetPeers.
+func (x *Logger) SetPeerRegions(regions map[key.NodePublic]string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.regions = regions
 }
 
 // SetPeers adjusts x to rewrite the peer public keys found in peers.
+// Peers with a Name are labeled with it as well as their key, unless
+// WithLabelTemplate says otherwise.
+//
+// Peers with an IdleTimeout are reported, as "wg: peer [IMTBr] idle for > 5m0s"
+// and an EventIdleTimeout, once per period of that long without an observed
+// handshake or keepalive, counted from their last one. A peer is only reported
+// once some activity has been observed since its timeout was set.
+//
 // SetPeers is safe for concurrent use.
 func (x *Logger) SetPeers(peers []wgcfg.Peer) {
 	x.mu.Lock()
 	defer x.mu.Unlock()
 	// Construct a new peer public key log rewriter.
 	replace := make(map[string]string)
+	keys := make(map[string]key.NodePublic, len(peers))
+	var idleTimeouts map[string]time.Duration
+	var labels map[string]string // for the sidecar file, if any
+	if x.sidecarPath != "" {
+		labels = make(map[string]string, len(peers))
+	}
 	for _, peer := range peers {
 		c, ok := x.strs[peer.PublicKey] // look up cached strs
 		if !ok {
-			wg := peer.PublicKey.WireGuardGoString()
-			ts := peer.PublicKey.ShortString()
-			c = &strCache{wg: wg, ts: ts}
+			c = &strCache{wg: peer.PublicKey.WireGuardGoString()}
 			x.strs[peer.PublicKey] = c
 		}
+		region := x.regions[peer.PublicKey]
+		if !ok || c.name != peer.Name || c.region != region {
+			c.name = peer.Name
+			c.region = region
+			c.ts = x.peerLabel(peer.PublicKey, peer.Name, region)
+		}
 		c.used = true
+		c.removed = time.Time{}
 		replace[c.wg] = c.ts
+		keys[c.wg] = peer.PublicKey
+		if peer.IdleTimeout > 0 {
+			mak.Set(&idleTimeouts, c.wg, peer.IdleTimeout)
+		}
+		if labels != nil {
+			labels[peer.PublicKey.String()] = c.ts
+		}
+		// Rewrite any of the peer's candidate endpoints too,
+		// so that lines mentioning only an address identify the peer,
+		// like "[IMTBr]@1.2.3.4:41641", or with the endpoint's type if
+		// known, like "[IMTBr] direct 1.2.3.4:41641" or "[IMTBr] derp nyc".
+		for _, ep := range peer.Endpoints {
+			eps := ep.Addr.String()
+			if _, ok := replace[eps]; ok {
+				continue
+			}
+			if ep.Type == wgcfg.EndpointUnknownType {
+				replace[eps] = c.ts + "@" + eps
+			} else {
+				replace[eps] = c.ts + " " + ep.String()
+			}
+		}
+	}
+	// Remove any unused cached strs, retaining them for x.rewriteTTL if set.
+	var retired map[string]retiredLabel
+	var now time.Time
+	if x.rewriteTTL > 0 {
+		now = x.clock.Now()
 	}
-	// Remove any unused cached strs.
 	for k, c := range x.strs {
 		if !c.used {
+			if x.rewriteTTL > 0 {
+				if c.removed.IsZero() {
+					c.removed = now
+				}
+				if expires := c.removed.Add(x.rewriteTTL); now.Before(expires) {
+					mak.Set(&retired, c.wg, retiredLabel{ts: c.ts, expires: expires})
+					continue
+				}
+			}
 			delete(x.strs, k)
 			continue
 		}
@@ -127,4 +781,28 @@ func (x *Logger) SetPeers(peers []wgcfg.Peer) {
 		c.used = false
 	}
 	x.replace.Store(replace)
+	x.peerKeys.Store(keys)
+	x.idle.setTimeouts(idleTimeouts)
+	x.endpoints.retain(replace)
+	x.retired.Store(retired)
+	x.retainLimiters(func(peer string) bool {
+		_, ok := replace[peer]
+		if !ok {
+			_, ok = retired[peer]
+		}
+		return ok
+	})
+	if labels != nil {
+		if err := writeSidecar(x.sidecarPath, labels); err != nil {
+			x.logf("%swriting peer label file: %v", x.prefix, err)
+		}
+	}
+}
+
+func writeSidecar(path string, labels map[string]string) error {
+	b, err := json.MarshalIndent(labels, "", "\t")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(path, append(b, '\n'), 0600)
 }
@@ -4,10 +4,23 @@
 package wglog_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"go4.org/mem"
+	"tailscale.com/tstest"
 	"tailscale.com/types/key"
 	"tailscale.com/types/logger"
 	"tailscale.com/wgengine/wgcfg"
@@ -100,6 +113,27 @@ func BenchmarkSetPeers(b *testing.B) {
 	}
 }
 
+// BenchmarkLog measures logging lines through a Logger with peers set,
+// with and without a peer among their args.
+func BenchmarkLog(b *testing.B) {
+	x := wglog.NewLogger(logger.Discard)
+	x.SetPeers(genPeers(16))
+	peer := stringer(genPeers(16)[0].PublicKey.WireGuardGoString())
+	ep := netip.MustParseAddrPort("198.51.100.7:41641")
+	b.Run("peer", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			x.DeviceLogger.Verbosef("%v - Received handshake initiation from %v", peer, ep)
+		}
+	})
+	b.Run("no-peer", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			x.DeviceLogger.Verbosef("Routine: receive incoming %v - started on %v", stringer("v4"), stringer("198.51.100.7:41641"))
+		}
+	})
+}
+
 func genPeers(n int) []wgcfg.Peer {
 	if n > 32 {
 		panic("too many peers")
@@ -115,3 +149,1487 @@ func genPeers(n int) []wgcfg.Peer {
 	}
 	return peers
 }
+
+func TestLoggerEndpoints(t *testing.T) {
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	})
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ap := netip.MustParseAddrPort
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Endpoints: []wgcfg.Endpoint{
+		{Addr: ap("1.2.3.4:41641")},
+		{Addr: ap("5.6.7.8:41641"), Type: wgcfg.EndpointDirect},
+		{Addr: ap("9.9.9.9:41641"), Type: wgcfg.EndpointRelay},
+		{Addr: ap("127.3.3.40:1"), Type: wgcfg.EndpointDERP, Region: "nyc"},
+	}}})
+
+	tests := []struct {
+		ep   netip.AddrPort
+		want string
+	}{
+		{ap("1.2.3.4:41641"), "wg: sending to [IMTBr]@1.2.3.4:41641"},
+		{ap("5.6.7.8:41641"), "wg: sending to [IMTBr] direct 5.6.7.8:41641"},
+		{ap("9.9.9.9:41641"), "wg: sending to [IMTBr] relay 9.9.9.9:41641"},
+		{ap("127.3.3.40:1"), "wg: sending to [IMTBr] derp nyc"},
+	}
+	for _, tt := range tests {
+		x.DeviceLogger.Errorf("sending to %v", tt.ep)
+		if got != tt.want {
+			t.Errorf("got %q; want %q", got, tt.want)
+		}
+	}
+}
+
+func TestLeveledGlobalVerbosity(t *testing.T) {
+	defer logger.SetGlobalVerbosity(logger.GlobalVerbosity())
+
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithLeveled())
+
+	logger.SetGlobalVerbosity(logger.Info)
+	x.DeviceLogger.Verbosef("quiet")
+	x.DeviceLogger.Errorf("loud")
+	logger.SetGlobalVerbosity(logger.Debug)
+	x.DeviceLogger.Verbosef("chatty")
+
+	want := []string{"wg: loud", "wg: [v2] chatty"}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q; want %q", logs, want)
+	}
+}
+
+func TestUnknownPeer(t *testing.T) {
+	var unknown []string
+	x := wglog.NewLogger(logger.Discard, wglog.WithUnknownPeerFunc(func(peer string) {
+		unknown = append(unknown, peer)
+	}))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", stringer("peer(IMTB…r7lM)"))
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", stringer("peer(AAAA…BBBB)"))
+	x.DeviceLogger.Verbosef("%v", stringer("not a peer"))
+
+	if got := x.Stats().UnknownPeers; got != 1 {
+		t.Errorf("UnknownPeers = %d; want 1", got)
+	}
+	if want := []string{"peer(AAAA…BBBB)"}; !slices.Equal(unknown, want) {
+		t.Errorf("unknown peer callbacks = %q; want %q", unknown, want)
+	}
+}
+
+func TestRewriteTTL(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	}, wglog.WithRewriteTTL(30*time.Second), wglog.WithClock(clock))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := stringer("peer(IMTB…r7lM)")
+	check := func(want string) {
+		t.Helper()
+		x.DeviceLogger.Errorf("%v - Sending keepalive packet", peer)
+		if got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	}
+
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	check("wg: [IMTBr] - Sending keepalive packet")
+
+	x.SetPeers(nil)
+	clock.Advance(10 * time.Second)
+	check("wg: [IMTBr] - Sending keepalive packet")
+	x.SetPeers(nil) // must not extend the TTL
+	clock.Advance(25 * time.Second)
+	check("wg: peer(IMTB…r7lM) - Sending keepalive packet")
+	x.SetPeers(nil)
+	check("wg: peer(IMTB…r7lM) - Sending keepalive packet")
+}
+
+func TestHandshakeCorrelation(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithHandshakeCorrelation())
+	a := stringer("peer(AAAA…AAAA)")
+	b := stringer("peer(BBBB…BBBB)")
+
+	v := x.DeviceLogger.Verbosef
+	v("%v - Sending handshake initiation", a)
+	v("%s - Handshake did not complete after %d seconds, retrying (try %d)", a, 5, 2)
+	v("%v - Sending handshake initiation", a)
+	v("%v - Received handshake initiation", b)
+	v("%v - Sending keepalive packet", a)
+	v("%v - Received handshake response", a)
+	v("%v - Sending handshake response", b)
+	v("%v - Sending handshake initiation", a)
+	v("%s - Handshake did not complete after %d attempts, giving up", a, 20)
+
+	want := []string{
+		"wg: [v2] peer(AAAA…AAAA) - Sending handshake initiation [hs#1]",
+		"wg: [v2] peer(AAAA…AAAA) - Handshake did not complete after 5 seconds, retrying (try 2) [hs#1]",
+		"wg: [v2] peer(AAAA…AAAA) - Sending handshake initiation [hs#1]",
+		"wg: [v2] peer(BBBB…BBBB) - Received handshake initiation [hs#1]",
+		"wg: [v2] peer(AAAA…AAAA) - Sending keepalive packet",
+		"wg: [v2] peer(AAAA…AAAA) - Received handshake response [hs#1]",
+		"wg: [v2] peer(BBBB…BBBB) - Sending handshake response [hs#1]",
+		"wg: [v2] peer(AAAA…AAAA) - Sending handshake initiation [hs#2]",
+		"wg: [v2] peer(AAAA…AAAA) - Handshake did not complete after 20 attempts, giving up [hs#2]",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(logs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSilentPeers(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	chatty := stringer(k.WireGuardGoString())
+	other := stringer("peer(AAAA…BBBB)")
+
+	x.SetSilentPeers(k)
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", chatty)
+	x.DeviceLogger.Errorf("%v - Failed to send handshake initiation: %v", chatty, "oops")
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", other)
+	x.SetSilentPeers()
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", chatty)
+
+	want := []string{
+		"wg: [v2] peer(AAAA…BBBB) - Sending keepalive packet",
+		"wg: [v2] " + k.WireGuardGoString() + " - Sending keepalive packet",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q; want %q", logs, want)
+	}
+}
+
+func TestHealthMarkers(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	}, wglog.WithHealthMarkers(3*time.Minute), wglog.WithClock(clock))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer("peer(IMTB…r7lM)")
+	check := func(format, want string) {
+		t.Helper()
+		x.DeviceLogger.Errorf(format, peer)
+		if got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	}
+
+	check("%v - Sending keepalive packet", "wg: [IMTBr](✗) - Sending keepalive packet")
+	check("%v - Received handshake response", "wg: [IMTBr](✗) - Received handshake response")
+	check("%v - Sending keepalive packet", "wg: [IMTBr](✓) - Sending keepalive packet")
+	clock.Advance(4 * time.Minute)
+	check("%v - Sending keepalive packet", "wg: [IMTBr](✗) - Sending keepalive packet")
+}
+
+func TestSinkStats(t *testing.T) {
+	x := wglog.NewLogger(logger.Discard)
+	x.DeviceLogger.Verbosef("Routine: event worker - started")
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", stringer("peer(AAAA…BBBB)"))
+	x.DeviceLogger.Verbosef("UAPI: Updating listen port")
+	x.DeviceLogger.Errorf("Failed to send data packets: %v", "oops")
+	x.DeviceLogger.Errorf("Failed to read packet from TUN device: %v", "oops")
+
+	got := x.Stats()
+	if want := (wglog.SinkStats{Emitted: 2, Dropped: 1}); got.Verbose != want {
+		t.Errorf("Verbose = %+v; want %+v", got.Verbose, want)
+	}
+	if want := (wglog.SinkStats{Emitted: 1, Dropped: 1}); got.Error != want {
+		t.Errorf("Error = %+v; want %+v", got.Error, want)
+	}
+}
+
+func TestEdgeTriggered(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithEdgeTriggered(true))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer("peer(IMTB…r7lM)")
+
+	v := x.DeviceLogger.Verbosef
+	for range 3 {
+		v("%v - Sending handshake initiation", peer)
+		v("%v - Received handshake response", peer)
+		v("%v - Sending keepalive packet", peer)
+	}
+	v("%s - Removing all keys, since we haven't received a new one in %d seconds", peer, 540)
+	v("%v - Sending handshake initiation", peer)
+	v("%s - Handshake did not complete after %d attempts, giving up", peer, 20)
+	v("%v - Received handshake initiation", peer)
+	v("%v - Sending handshake response", peer)
+	v("UAPI: Updating listen port")
+
+	want := []string{
+		"wg: peer [IMTBr] became active",
+		"wg: peer [IMTBr] became idle",
+		"wg: peer [IMTBr] became active",
+		"wg: [v2] UAPI: Updating listen port",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(logs, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestPeerNames(t *testing.T) {
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	})
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := stringer("peer(IMTB…r7lM)")
+
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}})
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+	if want := "wg: [v2] laptop[IMTBr] - Sending handshake initiation"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+
+	// Renaming a peer takes effect on the next SetPeers.
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "desktop"}})
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+	if want := "wg: [v2] desktop[IMTBr] - Sending handshake initiation"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestFlapCoalescing(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	var mu sync.Mutex
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithFlapCoalescing(10*time.Second, 5), wglog.WithClock(clock))
+	check := func(want ...string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if !slices.Equal(logs, want) {
+			t.Errorf("got %q; want %q", logs, want)
+		}
+		logs = nil
+	}
+
+	for range 10 {
+		x.DeviceLogger.Verbosef("Interface up requested")
+		x.DeviceLogger.Verbosef("Interface down requested")
+		clock.Advance(time.Second / 2)
+	}
+	check()
+	if !x.IsFlapping() {
+		t.Errorf("IsFlapping = false after rapid up/down lines; want true")
+	}
+	clock.Advance(5 * time.Second)
+	check("wg: interface flapped 20 times in 10s")
+	if !x.IsFlapping() {
+		t.Errorf("IsFlapping = false within window of the last lines; want true")
+	}
+	clock.Advance(10 * time.Second)
+	if x.IsFlapping() {
+		t.Errorf("IsFlapping = true after a quiet window; want false")
+	}
+
+	// Below the threshold, the lines are dropped as usual.
+	x.DeviceLogger.Verbosef("Interface up requested")
+	x.DeviceLogger.Verbosef("Interface down requested")
+	if x.IsFlapping() {
+		t.Errorf("IsFlapping = true below threshold; want false")
+	}
+	clock.Advance(time.Minute)
+	check()
+}
+
+func TestSidecarFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "labels.json")
+	x := wglog.NewLogger(t.Logf, wglog.WithSidecarFile(path))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2 := key.NewNode().Public()
+	read := func() map[string]string {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]string
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}, {PublicKey: k2}})
+	want := map[string]string{
+		k.String():  "laptop[IMTBr]",
+		k2.String(): k2.ShortString(),
+	}
+	if got := read(); !maps.Equal(got, want) {
+		t.Errorf("got %v; want %v", got, want)
+	}
+
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k2}})
+	want = map[string]string{k2.String(): k2.ShortString()}
+	if got := read(); !maps.Equal(got, want) {
+		t.Errorf("after removal, got %v; want %v", got, want)
+	}
+}
+
+func TestMTUWarnings(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	var logs []string
+	var warnings []wglog.MTUWarning
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithClock(clock), wglog.WithMTUWarnings(time.Minute, func(w wglog.MTUWarning) {
+		warnings = append(warnings, w)
+	}))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer("peer(IMTB…r7lM)")
+	sendErr := errors.New("write udp4 0.0.0.0:41641->1.2.3.4:41641: sendmsg: message too long")
+
+	for range 3 {
+		x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", peer, sendErr)
+	}
+	x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", peer, errors.New("network is unreachable"))
+	x.DeviceLogger.Verbosef("MTU updated: %v%s", 9000, " (too large, capped at 1420)")
+	clock.Advance(2 * time.Minute)
+	x.DeviceLogger.Errorf("%v - Failed to send handshake initiation: %v", peer, sendErr)
+
+	line := "peer(IMTB…r7lM) - Failed to send data packets: " + sendErr.Error()
+	hsLine := "peer(IMTB…r7lM) - Failed to send handshake initiation: " + sendErr.Error()
+	wantLogs := []string{
+		"wg: [unexpected] possible path MTU problem with peer [IMTBr]: " + line,
+		"wg: [unexpected] possible MTU problem: MTU updated: 9000 (too large, capped at 1420)",
+		"wg: [v2] MTU updated: 9000 (too large, capped at 1420)",
+		"wg: [unexpected] possible path MTU problem with peer [IMTBr]: " + hsLine,
+		"wg: [IMTBr] - Failed to send handshake initiation: " + sendErr.Error(),
+	}
+	if !slices.Equal(logs, wantLogs) {
+		t.Errorf("logs:\n%s\nwant:\n%s", strings.Join(logs, "\n"), strings.Join(wantLogs, "\n"))
+	}
+	wantWarnings := []wglog.MTUWarning{
+		{Peer: "[IMTBr]", Line: line},
+		{Line: "MTU updated: 9000 (too large, capped at 1420)"},
+		{Peer: "[IMTBr]", Line: hsLine},
+	}
+	if !slices.Equal(warnings, wantWarnings) {
+		t.Errorf("warnings = %+v; want %+v", warnings, wantWarnings)
+	}
+}
+
+func TestLogStats(t *testing.T) {
+	x := wglog.NewLogger(logger.Discard)
+	var r logger.Registry
+	defer r.Register("wireguard", x)()
+
+	x.DeviceLogger.Verbosef("Routine: receive incoming v4")
+	x.DeviceLogger.Verbosef("Routine: event worker - started") // dropped
+	x.DeviceLogger.Errorf("boom")
+	want := []logger.NamedLogStats{{
+		Name:     "wireguard",
+		LogStats: logger.LogStats{Level: logger.Debug, Emitted: 2, Dropped: 1},
+	}}
+	if got := r.Snapshot(); !slices.Equal(got, want) {
+		t.Errorf("Snapshot = %+v; want %+v", got, want)
+	}
+}
+
+func TestPeerRegions(t *testing.T) {
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	})
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := stringer("peer(IMTB…r7lM)")
+	check := func(want string) {
+		t.Helper()
+		x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+		if got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	}
+
+	x.SetPeerRegions(map[key.NodePublic]string{k: "nyc"})
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	check("wg: [v2] [IMTBr][nyc] - Sending handshake initiation")
+
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}})
+	check("wg: [v2] laptop[IMTBr][nyc] - Sending handshake initiation")
+
+	x.SetPeerRegions(map[key.NodePublic]string{k: "fra"})
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	check("wg: [v2] [IMTBr][fra] - Sending handshake initiation")
+
+	x.SetPeerRegions(nil)
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	check("wg: [v2] [IMTBr] - Sending handshake initiation")
+}
+
+func TestPolicies(t *testing.T) {
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := stringer("peer(IMTB…r7lM)")
+	peer2 := stringer("peer(AAAA…BBBB)")
+	sendErr := errors.New("network is unreachable")
+	line := "wg: [IMTBr] - Failed to send data packets: network is unreachable"
+	line2 := "wg: peer(AAAA…BBBB) - Failed to send data packets: network is unreachable"
+
+	tests := []struct {
+		name     string
+		policies map[wglog.Class]wglog.Policy
+		want     []string
+	}{
+		{
+			name: "default-drop",
+			want: nil,
+		},
+		{
+			name:     "drop",
+			policies: map[wglog.Class]wglog.Policy{wglog.ClassSendFailure: wglog.Drop},
+			want:     nil,
+		},
+		{
+			name:     "pass",
+			policies: map[wglog.Class]wglog.Policy{wglog.ClassSendFailure: wglog.Pass},
+			want:     []string{line, line, line, line2, line, line},
+		},
+		{
+			name:     "rate-limit",
+			policies: map[wglog.Class]wglog.Policy{wglog.ClassSendFailure: wglog.RateLimit(time.Minute, 2)},
+			// Limited separately for each peer, with the rate limiter's
+			// own notices when it starts and stops dropping.
+			want: []string{
+				line,
+				line,
+				"[RATELIMIT] format(\"wg: %v - Failed to send data packets: %v\")",
+				line2,
+				"[RATELIMIT] format(\"wg: %v - Failed to send data packets: %v\") (1 dropped)",
+				line,
+				line,
+				"[RATELIMIT] format(\"wg: %v - Failed to send data packets: %v\")",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := tstest.NewClock(tstest.ClockOpts{})
+			var got []string
+			x := wglog.NewLogger(func(format string, args ...any) {
+				got = append(got, fmt.Sprintf(format, args...))
+			}, wglog.WithClock(clock), wglog.WithPolicies(tt.policies))
+			x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+
+			for range 3 {
+				x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", peer, sendErr)
+			}
+			x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", peer2, sendErr)
+			clock.Advance(2 * time.Minute)
+			x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", peer, sendErr)
+			x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", peer, sendErr)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestDebugDump(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	x := wglog.NewLogger(logger.Discard, wglog.WithClock(clock),
+		wglog.WithRewriteTTL(time.Minute), wglog.WithEdgeTriggered(true))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gone := key.NewNode().Public()
+	ep := netip.MustParseAddrPort("1.2.3.4:41641")
+
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Endpoints: []wgcfg.Endpoint{{Addr: ep}}}, {PublicKey: gone}})
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Endpoints: []wgcfg.Endpoint{{Addr: ep}}}})
+	x.DeviceLogger.Verbosef("%v - Received handshake response", stringer("peer(IMTB…r7lM)"))
+	x.DeviceLogger.Verbosef("Routine: event worker - started") // dropped
+
+	got := x.DebugDump()
+	want := wglog.DebugState{
+		Peers: []wglog.DebugPeer{
+			{
+				WireGuard:     "peer(IMTB…r7lM)",
+				Label:         "[IMTBr]",
+				LastHandshake: clock.Now(),
+				Active:        true,
+			},
+			{
+				WireGuard:    gone.WireGuardGoString(),
+				Label:        gone.ShortString(),
+				RetiredUntil: clock.Now().Add(time.Minute),
+			},
+		},
+		Endpoints: map[string]string{"1.2.3.4:41641": "[IMTBr]@1.2.3.4:41641"},
+		Stats: wglog.Stats{
+			Verbose: wglog.SinkStats{Emitted: 1, Dropped: 1}, // the "became active" line, and the routine line
+		},
+	}
+	slices.SortFunc(want.Peers, func(a, b wglog.DebugPeer) int { return strings.Compare(a.WireGuard, b.WireGuard) })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DebugDump:\n got %+v\nwant %+v", got, want)
+	}
+	if _, err := json.Marshal(got); err != nil {
+		t.Errorf("DebugState does not serialize: %v", err)
+	}
+}
+
+func TestReplayReader(t *testing.T) {
+	var got []string
+	logf := func(format string, args ...any) {
+		got = append(got, fmt.Sprintf(format, args...))
+	}
+	x := wglog.NewLogger(logf)
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+
+	f, err := os.Open(filepath.Join("testdata", "raw.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := x.ReplayReader(f); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"wg: [v2] UAPI: Created",
+		"wg: [v2] [IMTBr] - Sending handshake initiation",
+		"wg: [v2] [IMTBr] - Received handshake response",
+		"wg: tun: 100% of output queue full",
+		"wg: [v2] Routine: receive incoming - stopped",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestDeviceFold(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	var mu sync.Mutex
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithDeviceFold(10*time.Second), wglog.WithClock(clock))
+	check := func(want ...string) {
+		t.Helper()
+		mu.Lock()
+		defer mu.Unlock()
+		if !slices.Equal(logs, want) {
+			t.Errorf("got %q; want %q", logs, want)
+		}
+		logs = nil
+	}
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}})
+	peers := []any{stringer("peer(IMTB…r7lM)"), stringer("peer(AAAA…BBBB)"), stringer("peer(CCCC…DDDD)")}
+
+	for range 3 {
+		for _, p := range peers {
+			x.DeviceLogger.Verbosef("%v - Sending handshake initiation", p)
+			x.DeviceLogger.Verbosef("%v - Received handshake response", p)
+		}
+		clock.Advance(time.Second)
+	}
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peers[0])
+	check("wg: [v2] laptop[IMTBr] - Sending keepalive packet")
+	clock.Advance(7 * time.Second)
+	check("wg: [v2] handshakes with 3 peers in 10s: laptop[IMTBr], peer(AAAA…BBBB), peer(CCCC…DDDD)")
+
+	// An error line makes the summary an error.
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peers[1])
+	x.DeviceLogger.Errorf("%v - Handshake did not complete after %d seconds, retrying (try %d)", peers[1], 5, 2)
+	clock.Advance(10 * time.Second)
+	check("wg: handshakes with 1 peers in 10s: peer(AAAA…BBBB)")
+}
+
+func TestHandshakeLatency(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	x := wglog.NewLogger(logger.Discard, wglog.WithHandshakeLatency(5*time.Second), wglog.WithClock(clock))
+	if h := wglog.NewLogger(logger.Discard).HandshakeLatency(); h != nil {
+		t.Errorf("HandshakeLatency without option = %v; want nil", h)
+	}
+	check := func(wantCount int, wantSum float64) {
+		t.Helper()
+		var got struct {
+			Count int     `json:"count"`
+			Sum   float64 `json:"sum"`
+		}
+		if err := json.Unmarshal([]byte(x.HandshakeLatency().String()), &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Count != wantCount || got.Sum != wantSum {
+			t.Errorf("count, sum = %v, %v; want %v, %v", got.Count, got.Sum, wantCount, wantSum)
+		}
+	}
+	p1, p2 := stringer("peer(IMTB…r7lM)"), stringer("peer(AAAA…BBBB)")
+
+	// A completed handshake, including a retry, is recorded.
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", p1)
+	clock.Advance(time.Second)
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", p1)
+	clock.Advance(250 * time.Millisecond)
+	x.DeviceLogger.Verbosef("%v - Received handshake response", p1)
+	check(1, 1.25)
+
+	// A response without an initiation is not.
+	x.DeviceLogger.Verbosef("%v - Received handshake response", p1)
+	check(1, 1.25)
+
+	// Nor is one that times out.
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", p2)
+	clock.Advance(6 * time.Second)
+	x.DeviceLogger.Verbosef("%v - Received handshake response", p2)
+	check(1, 1.25)
+}
+
+func TestEventSink(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{Start: time.Unix(1700000000, 0)})
+	var logs []string
+	var events []wglog.Event
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithClock(clock), wglog.WithHealthMarkers(time.Minute))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}})
+	x.SetEventSink(func(ev wglog.Event) { events = append(events, ev) })
+	peer := stringer("peer(IMTB…r7lM)")
+
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peer)
+	x.DeviceLogger.Errorf("%v - Handshake did not complete after %d seconds, retrying (try %d)", peer, 5, 2)
+	x.DeviceLogger.Errorf("Failed to read packet from TUN device: %v", errors.New("EOF"))
+
+	now := clock.Now()
+	want := []wglog.Event{
+		{Kind: wglog.EventHandshakeInitiated, Peer: k, Label: "laptop[IMTBr](✗)", Time: now, Detail: "laptop[IMTBr](✗) - Sending handshake initiation"},
+		{Kind: wglog.EventHandshakeCompleted, Peer: k, Label: "laptop[IMTBr](✗)", Time: now, Detail: "laptop[IMTBr](✗) - Received handshake response"},
+		{Kind: wglog.EventBecameActive, Peer: k, Label: "laptop[IMTBr](✗)", Time: now},
+		{Kind: wglog.EventHandshakeFailed, Peer: k, Label: "laptop[IMTBr](✓)", Time: now, Detail: "laptop[IMTBr](✓) - Handshake did not complete after 5 seconds, retrying (try 2)"},
+		{Kind: wglog.EventError, Time: now, Detail: "Failed to read packet from TUN device: EOF"},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("events:\n%+v\nwant:\n%+v", events, want)
+	}
+	if len(logs) != 5 {
+		t.Errorf("text logging stopped; got %q", logs)
+	}
+
+	x.SetEventSink(nil)
+	events = nil
+	x.DeviceLogger.Errorf("another error")
+	if len(events) != 0 || len(logs) != 6 {
+		t.Errorf("after clearing sink: events %+v, logs %q", events, logs)
+	}
+}
+
+func TestSimpleNetmapLabels(t *testing.T) {
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nm := &wgcfg.SimpleNetmap{
+		PrivateKey: key.NewNode(),
+		Peers: []wgcfg.SimpleNode{
+			{Name: "laptop", Key: k, Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.2/32")}, DERPRegion: "nyc"},
+			{Name: "router", Key: key.NewNode().Public(), Addresses: []netip.Prefix{netip.MustParsePrefix("100.64.0.3/32")}},
+		},
+	}
+	cfg, err := nm.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	})
+	x.SetPeerRegions(nm.Regions())
+	x.SetPeers(cfg.Peers)
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", stringer("peer(IMTB…r7lM)"))
+	if want := "wg: [v2] laptop[IMTBr][nyc] - Sending handshake initiation"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+}
+
+func TestVerboseSubsystems(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	peer := stringer("peer(IMTB…r7lM)")
+	logAll := func() {
+		x.DeviceLogger.Verbosef("%v - Retrying handshake because we stopped hearing back after %d seconds", peer, 15)
+		x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+		x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+		x.DeviceLogger.Verbosef("UAPI: Updating private key")
+		x.DeviceLogger.Errorf("%v - Failed to send handshake initiation: %v", peer, errors.New("no route"))
+	}
+
+	x.SetVerboseSubsystems("timers")
+	logAll()
+	want := []string{
+		"wg: [v2] peer(IMTB…r7lM) - Retrying handshake because we stopped hearing back after 15 seconds",
+		"wg: peer(IMTB…r7lM) - Failed to send handshake initiation: no route",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q; want %q", logs, want)
+	}
+
+	logs = nil
+	x.SetVerboseSubsystems()
+	logAll()
+	if len(logs) != 5 {
+		t.Errorf("after resetting, got %q; want all 5 lines", logs)
+	}
+}
+
+func TestClockDrivesObservers(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := tstest.NewClock(tstest.ClockOpts{Start: start})
+	var events []wglog.Event
+	x := wglog.NewLogger(logger.Discard, wglog.WithClock(clock),
+		wglog.WithHandshakeLatency(time.Minute), wglog.WithEdgeTriggered(true))
+	x.SetEventSink(func(ev wglog.Event) { events = append(events, ev) })
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer("peer(IMTB…r7lM)")
+
+	// No real time passes, but the fake clock says the handshake took 30s.
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+	clock.Advance(30 * time.Second)
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+	done := start.Add(30 * time.Second)
+
+	var hist struct {
+		Sum float64 `json:"sum"`
+	}
+	if err := json.Unmarshal([]byte(x.HandshakeLatency().String()), &hist); err != nil {
+		t.Fatal(err)
+	}
+	if hist.Sum != 30 {
+		t.Errorf("recorded latency %vs; want 30s", hist.Sum)
+	}
+	st := x.DebugDump()
+	if len(st.Peers) != 1 || !st.Peers[0].LastHandshake.Equal(done) {
+		t.Errorf("DebugDump peers = %+v; want last handshake at %v", st.Peers, done)
+	}
+	for _, ev := range events {
+		if ev.Time.Before(start) || ev.Time.After(done) {
+			t.Errorf("event %v at %v; want fake clock time", ev.Kind, ev.Time)
+		}
+	}
+	if len(events) == 0 || events[len(events)-1].Kind != wglog.EventBecameActive || !events[len(events)-1].Time.Equal(done) {
+		t.Errorf("events = %+v; want last to be became-active at %v", events, done)
+	}
+}
+
+func TestPeerIdentifier(t *testing.T) {
+	var logs []string
+	identify := func(arg any) (string, bool) {
+		if k, ok := arg.(key.NodePublic); ok {
+			return k.WireGuardGoString(), true
+		}
+		return "", false
+	}
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithPeerIdentifier(identify))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := key.NewNode().Public()
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}})
+
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", k)
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", other)
+	x.SetSilentPeers(other)
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", other)
+
+	want := []string{
+		"wg: [v2] laptop[IMTBr] - Sending keepalive packet",
+		"wg: [v2] " + other.String() + " - Sending keepalive packet",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q; want %q", logs, want)
+	}
+	if got := x.Stats().UnknownPeers; got != 1 {
+		t.Errorf("UnknownPeers = %d; want 1", got)
+	}
+}
+
+func TestSetSink(t *testing.T) {
+	var first, second []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		first = append(first, fmt.Sprintf(format, args...))
+	}, wglog.WithHandshakeCorrelation())
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer(k.WireGuardGoString())
+
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer)
+	x.SetSink(func(format string, args ...any) {
+		second = append(second, fmt.Sprintf(format, args...))
+	})
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+	x.DeviceLogger.Errorf("%v - Failed to send handshake initiation: %v", peer, "oops")
+
+	// Peer labels and handshake attempt state survive the swap.
+	wantFirst := []string{"wg: [v2] [IMTBr] - Sending handshake initiation [hs#1]"}
+	wantSecond := []string{
+		"wg: [v2] [IMTBr] - Received handshake response [hs#1]",
+		"wg: [IMTBr] - Failed to send handshake initiation: oops [hs#2]",
+	}
+	if !slices.Equal(first, wantFirst) {
+		t.Errorf("first sink got %q; want %q", first, wantFirst)
+	}
+	if !slices.Equal(second, wantSecond) {
+		t.Errorf("second sink got %q; want %q", second, wantSecond)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{Start: time.Unix(1700000000, 0)})
+	var logs []string
+	var events []wglog.Event
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithClock(clock))
+	x.SetEventSink(func(ev wglog.Event) { events = append(events, ev) })
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, IdleTimeout: time.Minute}})
+	peer := stringer(k.WireGuardGoString())
+	idleLines := func() []string {
+		var ret []string
+		for _, l := range logs {
+			if strings.Contains(l, "idle for") {
+				ret = append(ret, l)
+			}
+		}
+		return ret
+	}
+	check := func(want int) {
+		t.Helper()
+		if got := idleLines(); len(got) != want {
+			t.Fatalf("idle lines = %q; want %d", got, want)
+		}
+	}
+
+	// No activity yet, so nothing to time out.
+	clock.Advance(2 * time.Minute)
+	check(0)
+
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+	x.DeviceLogger.Verbosef("%v - Sending handshake initiation", peer) // not activity
+	clock.Advance(59 * time.Second)
+	check(0)
+	clock.Advance(time.Second)
+	check(1)
+	clock.Advance(5 * time.Minute) // still idle, but already reported
+	check(1)
+
+	// New activity starts a new idle period, which keepalives extend.
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peer)
+	clock.Advance(30 * time.Second)
+	x.DeviceLogger.Verbosef("%v - Receiving keepalive packet", peer)
+	clock.Advance(59 * time.Second)
+	check(1)
+	clock.Advance(time.Second)
+	check(2)
+	if got, want := idleLines()[1], "wg: peer [IMTBr] idle for > 1m0s"; got != want {
+		t.Errorf("idle line = %q; want %q", got, want)
+	}
+
+	var idleEvents []wglog.Event
+	for _, ev := range events {
+		if ev.Kind == wglog.EventIdleTimeout {
+			idleEvents = append(idleEvents, ev)
+		}
+	}
+	if len(idleEvents) != 2 {
+		t.Fatalf("idle events = %+v; want 2", idleEvents)
+	}
+	if ev := idleEvents[1]; ev.Peer != k || ev.Label != "[IMTBr]" || !ev.Time.Equal(clock.Now()) {
+		t.Errorf("idle event = %+v", ev)
+	}
+
+	// Removing the timeout stops the timer.
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peer)
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	clock.Advance(time.Hour)
+	check(2)
+}
+
+func TestDeviceName(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(logger.Normalize(func(_ logger.Level, format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}), wglog.WithDeviceName("tailscale0"), wglog.WithEdgeTriggered(true))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := stringer(k.WireGuardGoString())
+
+	x.DeviceLogger.Verbosef("Routine: receive incoming %s - started", "v4")
+	x.DeviceLogger.Errorf("Failed to read packet from TUN device: %v", errors.New("EOF"))
+	x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+
+	want := []string{
+		"DEBUG wg(tailscale0): Routine: receive incoming v4 - started",
+		"INFO wg(tailscale0): Failed to read packet from TUN device: EOF",
+		"INFO wg(tailscale0): peer [IMTBr] became active",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q\nwant %q", logs, want)
+	}
+}
+
+func TestLevelHistogram(t *testing.T) {
+	var h logger.LevelHistogram
+	x := wglog.NewLogger(logger.Discard, wglog.WithLevelHistogram(&h))
+	x.DeviceLogger.Verbosef("Routine: receive incoming %s - started", "v4")
+	x.DeviceLogger.Verbosef("Routine: receive incoming %s - stopped", "v4")
+	x.DeviceLogger.Errorf("Failed to read packet from TUN device: %v", errors.New("EOF"))
+	x.DeviceLogger.Verbosef("Interface up requested") // dropped as noise
+
+	want := map[logger.Level]int64{logger.Debug: 2, logger.Info: 0, logger.Warn: 0, logger.Error: 1}
+	if got := h.Snapshot(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Snapshot = %v; want %v", got, want)
+	}
+}
+
+func TestFirstNThenSample(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}, wglog.WithFirstNThenSample(2, 3))
+	for i := range 9 {
+		x.DeviceLogger.Verbosef("UDP bind has been updated %d", i)
+	}
+	x.DeviceLogger.Verbosef("Routine: receive incoming %s - started", "v4")
+
+	want := []string{
+		"wg: [v2] UDP bind has been updated 0",
+		"wg: [v2] UDP bind has been updated 1",
+		"wg: [v2] UDP bind has been updated 4",
+		"wg: [v2] UDP bind has been updated 7",
+		"wg: [v2] Routine: receive incoming v4 - started",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q\nwant %q", logs, want)
+	}
+}
+
+func TestLabelTemplate(t *testing.T) {
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"[{{.Name}}]", "wg: [v2] [laptop] - Sending handshake initiation"},
+		{"{{.Name}}@{{.Region}}", "wg: [v2] laptop@nyc - Sending handshake initiation"},
+		{"{{.Name}}({{.Key}})", "wg: [v2] laptop(IMTBr) - Sending handshake initiation"},
+	}
+	for _, tt := range tests {
+		opt, err := wglog.WithLabelTemplate(tt.tmpl)
+		if err != nil {
+			t.Fatalf("WithLabelTemplate(%q): %v", tt.tmpl, err)
+		}
+		var got string
+		x := wglog.NewLogger(func(format string, args ...any) {
+			got = fmt.Sprintf(format, args...)
+		}, opt)
+		x.SetPeerRegions(map[key.NodePublic]string{k: "nyc"})
+		x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}})
+		x.DeviceLogger.Verbosef("%v - Sending handshake initiation", stringer(k.WireGuardGoString()))
+		if got != tt.want {
+			t.Errorf("%q: got %q; want %q", tt.tmpl, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"{{.Name", "{{.Hostname}}"} {
+		if _, err := wglog.WithLabelTemplate(bad); err == nil {
+			t.Errorf("WithLabelTemplate(%q) succeeded; want error", bad)
+		}
+	}
+}
+
+func TestDeviceLogger(t *testing.T) {
+	var logs []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	})
+	if x.DeviceLogger == nil || x.DeviceLogger.Verbosef == nil || x.DeviceLogger.Errorf == nil {
+		t.Fatalf("DeviceLogger not fully wired: %+v", x.DeviceLogger)
+	}
+	x.DeviceLogger.Verbosef("UDP bind has been updated")
+	x.DeviceLogger.Errorf("Failed to read packet from TUN device: %v", errors.New("EOF"))
+
+	want := []string{
+		"wg: [v2] UDP bind has been updated",
+		"wg: Failed to read packet from TUN device: EOF",
+	}
+	if !slices.Equal(logs, want) {
+		t.Errorf("got %q\nwant %q", logs, want)
+	}
+	if st := x.Stats(); st.Verbose.Emitted != 1 || st.Error.Emitted != 1 {
+		t.Errorf("Stats = %+v; want one line emitted via each function", st)
+	}
+}
+
+// countingStringer counts the calls to its String method.
+type countingStringer struct {
+	s     string
+	calls int
+}
+
+func (c *countingStringer) String() string {
+	c.calls++
+	return c.s
+}
+
+func TestStringerFormattedOnce(t *testing.T) {
+	var got string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	})
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	peer := &countingStringer{s: k.WireGuardGoString()}
+	other := &countingStringer{s: "wg0"}
+	x.DeviceLogger.Errorf("%v - Interface %v is up", peer, other)
+	if want := "wg: [IMTBr] - Interface wg0 is up"; got != want {
+		t.Errorf("got %q; want %q", got, want)
+	}
+	// The Logger formats each arg once. other, which is not replaced,
+	// is formatted again by the Sprintf in the sink above.
+	if peer.calls != 1 || other.calls != 2 {
+		t.Errorf("String called %d times on the peer and %d on the other arg; want 1 and 2", peer.calls, other.calls)
+	}
+}
+
+func TestPeerEndpoints(t *testing.T) {
+	x := wglog.NewLogger(logger.Discard)
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2 := key.NewNode().Public()
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: "laptop"}, {PublicKey: k2}})
+	peer := stringer(k.WireGuardGoString())
+	ep1 := netip.MustParseAddrPort("198.51.100.7:41641")
+	ep2 := netip.MustParseAddrPort("[2001:db8::1]:41641")
+
+	if got := x.PeerEndpoints(); len(got) != 0 {
+		t.Errorf("PeerEndpoints before any lines = %v; want empty", got)
+	}
+	x.DeviceLogger.Verbosef("%v - Received handshake initiation from %v", peer, ep1)
+	x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peer) // no endpoint
+	want := map[string]netip.AddrPort{"laptop[IMTBr]": ep1}
+	if got := x.PeerEndpoints(); !maps.Equal(got, want) {
+		t.Errorf("PeerEndpoints = %v; want %v", got, want)
+	}
+
+	x.DeviceLogger.Verbosef("Endpoint %v for %v", stringer(ep2.String()), peer)
+	x.DeviceLogger.Verbosef("Routine: %v", ep1) // no peer
+	want = map[string]netip.AddrPort{"laptop[IMTBr]": ep2}
+	if got := x.PeerEndpoints(); !maps.Equal(got, want) {
+		t.Errorf("PeerEndpoints = %v; want %v", got, want)
+	}
+
+	// Removed peers are forgotten.
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k2}})
+	if got := x.PeerEndpoints(); len(got) != 0 {
+		t.Errorf("PeerEndpoints after removal = %v; want empty", got)
+	}
+}
+
+func TestRewriteFunc(t *testing.T) {
+	var got string
+	var known atomic.Bool
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = fmt.Sprintf(format, args...)
+	}, wglog.WithRewriteFunc(func(wgStr string) (string, bool) {
+		if known.Load() && wgStr == "peer(IMTB…r7lM)" {
+			return "laptop[IMTBr]", true
+		}
+		return "", false
+	}))
+	check := func(want string) {
+		t.Helper()
+		x.DeviceLogger.Errorf("%v - Sending keepalive packet", stringer("peer(IMTB…r7lM)"))
+		if got != want {
+			t.Errorf("got %q; want %q", got, want)
+		}
+	}
+
+	check("wg: peer(IMTB…r7lM) - Sending keepalive packet")
+	if got := x.Stats().UnknownPeers; got != 1 {
+		t.Errorf("UnknownPeers = %d; want 1", got)
+	}
+
+	// The func takes effect on the very next line, without SetPeers.
+	known.Store(true)
+	check("wg: laptop[IMTBr] - Sending keepalive packet")
+	known.Store(false)
+	check("wg: peer(IMTB…r7lM) - Sending keepalive packet")
+
+	// Strings it doesn't know fall back to SetPeers.
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	check("wg: [IMTBr] - Sending keepalive packet")
+	known.Store(true)
+	check("wg: laptop[IMTBr] - Sending keepalive packet")
+}
+
+func TestNewLoggerWithOptions(t *testing.T) {
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer := stringer(k.WireGuardGoString())
+
+	tests := []struct {
+		name     string
+		opts     wglog.Options
+		peerName string
+		log      func(x *wglog.Logger)
+		want     []string
+	}{
+		{
+			name: "zero",
+			log: func(x *wglog.Logger) {
+				x.DeviceLogger.Verbosef("Routine: starting")
+				x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peer)
+			},
+			want: []string{"wg: [v2] [IMTBr] - Sending keepalive packet"},
+		},
+		{
+			name:     "device-name-and-template",
+			peerName: "laptop",
+			opts:     wglog.Options{DeviceName: "tailscale0", LabelTemplate: "<{{.Name}}>"},
+			log: func(x *wglog.Logger) {
+				x.DeviceLogger.Errorf("%v - Sending keepalive packet", peer)
+			},
+			want: []string{"wg(tailscale0): <laptop> - Sending keepalive packet"},
+		},
+		{
+			name:     "edge-triggered-and-policies",
+			peerName: "laptop",
+			opts:     wglog.Options{EdgeTriggered: true, Policies: map[wglog.Class]wglog.Policy{wglog.ClassRoutine: wglog.Pass}},
+			log: func(x *wglog.Logger) {
+				x.DeviceLogger.Verbosef("Routine: starting")
+				x.DeviceLogger.Verbosef("%v - Received handshake response", peer)
+				x.DeviceLogger.Verbosef("%v - Sending keepalive packet", peer)
+			},
+			want: []string{"wg: [v2] Routine: starting", "wg: peer laptop[IMTBr] became active"},
+		},
+		{
+			name: "rewrite-func-and-sampling",
+			opts: wglog.Options{
+				RewriteFunc:      func(string) (string, bool) { return "live", true },
+				FirstNThenSample: &wglog.SampleOptions{N: 1, Rate: 0},
+			},
+			log: func(x *wglog.Logger) {
+				x.DeviceLogger.Errorf("%v - Sending keepalive packet", peer)
+				x.DeviceLogger.Errorf("%v - Sending keepalive packet", peer)
+			},
+			want: []string{"wg: live - Sending keepalive packet"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs []string
+			x, err := wglog.NewLoggerWithOptions(func(format string, args ...any) {
+				logs = append(logs, fmt.Sprintf(format, args...))
+			}, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			x.SetPeers([]wgcfg.Peer{{PublicKey: k, Name: tt.peerName}})
+			tt.log(x)
+			if !slices.Equal(logs, tt.want) {
+				t.Errorf("got %q\nwant %q", logs, tt.want)
+			}
+		})
+	}
+
+	invalid := []wglog.Options{
+		{RewriteTTL: -time.Second},
+		{LabelTemplate: "{{.Nope}}"},
+		{EdgeTriggered: true, DeviceFold: time.Second},
+		{FlapCoalescing: &wglog.FlapOptions{Window: time.Second}},
+		{
+			FlapCoalescing: &wglog.FlapOptions{Window: time.Second, Threshold: 3},
+			Policies:       map[wglog.Class]wglog.Policy{wglog.ClassInterfaceUpDown: wglog.Pass},
+		},
+		{Policies: map[wglog.Class]wglog.Policy{wglog.ClassRoutine: wglog.RateLimit(0, 2)}},
+		{FirstNThenSample: &wglog.SampleOptions{N: -1}},
+		{MTUWarnings: &wglog.MTUOptions{Interval: -time.Second}},
+	}
+	for _, opts := range invalid {
+		if _, err := wglog.NewLoggerWithOptions(logger.Discard, opts); err == nil {
+			t.Errorf("NewLoggerWithOptions(%+v) succeeded; want error", opts)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	peer := stringer("peer(IMTB…r7lM)")
+	logLines := func(x *wglog.Logger) {
+		v, e := x.DeviceLogger.Verbosef, x.DeviceLogger.Errorf
+		v("Routine: receive incoming %s - started", "v4")
+		v("Routine: event worker - started")
+		e("%v - Failed to send data packets: %v", peer, errors.New("network is unreachable"))
+		v("Interface up requested")
+		v("%v - Retrying handshake because we stopped hearing back after %d seconds", peer, 15)
+		v("%v - Sending keepalive packet", peer)
+		v("%v - Sending keepalive packet", peer)
+		v("%v - Sending keepalive packet", peer)
+		e("%v - Handshake did not complete after %d attempts, giving up", peer, 20)
+	}
+	run := func(t *testing.T, opts ...wglog.Option) []string {
+		t.Helper()
+		var got []string
+		x := wglog.NewLogger(func(format string, args ...any) {
+			got = append(got, fmt.Sprintf(format, args...))
+		}, append([]wglog.Option{wglog.WithClock(tstest.NewClock(tstest.ClockOpts{}))}, opts...)...)
+		logLines(x)
+		return got
+	}
+	withRules := func(t *testing.T, rules ...wglog.Rule) wglog.Option {
+		t.Helper()
+		opt, err := wglog.WithRules(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return opt
+	}
+
+	t.Run("default", func(t *testing.T) {
+		want := run(t)
+		if got := run(t, withRules(t, wglog.DefaultRules()...)); !slices.Equal(got, want) {
+			t.Errorf("with DefaultRules got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	})
+
+	t.Run("actions", func(t *testing.T) {
+		got := run(t, withRules(t,
+			wglog.Rule{Pattern: `Failed to send`, Policy: wglog.Pass},
+			wglog.Rule{Pattern: `Retrying handshake`, Policy: wglog.AtLevel(logger.Warn)},
+			wglog.Rule{Pattern: `Handshake did not complete`, Policy: wglog.AtLevel(logger.Debug)},
+			wglog.Rule{Pattern: `keepalive`, Policy: wglog.RateLimit(time.Minute, 2)},
+			wglog.Rule{Pattern: `^Routine: receive`, Policy: wglog.Drop},
+		))
+		want := []string{
+			"wg: peer(IMTB…r7lM) - Failed to send data packets: network is unreachable",
+			"wg: [unexpected] peer(IMTB…r7lM) - Retrying handshake because we stopped hearing back after 15 seconds",
+			"wg: [v2] peer(IMTB…r7lM) - Sending keepalive packet",
+			"wg: [v2] peer(IMTB…r7lM) - Sending keepalive packet",
+			`[RATELIMIT] format("wg: [v2] %v - Sending keepalive packet")`,
+			"wg: [v2] peer(IMTB…r7lM) - Handshake did not complete after 20 attempts, giving up",
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	})
+
+	t.Run("first-match-wins", func(t *testing.T) {
+		got := run(t, withRules(t,
+			wglog.Rule{Pattern: `Routine: event`, Policy: wglog.Pass},
+			wglog.Rule{Pattern: `Routine:`, Policy: wglog.Drop},
+			wglog.Rule{Pattern: `Routine: receive`, Policy: wglog.Pass}, // shadowed
+			wglog.Rule{Pattern: `.`, Policy: wglog.Drop},
+		))
+		want := []string{"wg: [v2] Routine: event worker - started"}
+		if !slices.Equal(got, want) {
+			t.Errorf("got:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+		}
+	})
+
+	if _, err := wglog.WithRules([]wglog.Rule{{Pattern: `(`, Policy: wglog.Drop}}); err == nil {
+		t.Errorf("WithRules with invalid pattern succeeded")
+	}
+}
+
+func TestConnectivityMatrix(t *testing.T) {
+	clock := tstest.NewClock(tstest.ClockOpts{})
+	x := wglog.NewLogger(logger.Discard, wglog.WithHealthMarkers(time.Minute), wglog.WithClock(clock))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeKey := func(b byte) key.NodePublic {
+		var raw [32]byte
+		raw[0] = b
+		return key.NodePublicFromRaw32(mem.B(raw[:]))
+	}
+	kStale, kDown := nodeKey(0x30), nodeKey(0x40)
+	x.SetPeers([]wgcfg.Peer{{PublicKey: kDown}, {PublicKey: k, Name: "laptop"}, {PublicKey: kStale}})
+
+	x.DeviceLogger.Verbosef("%v - Received handshake response", stringer(kStale.WireGuardGoString()))
+	clock.Advance(2 * time.Minute)
+	x.DeviceLogger.Verbosef("%v - Received handshake initiation from %v", stringer(k.WireGuardGoString()), netip.MustParseAddrPort("198.51.100.7:41641"))
+	x.DeviceLogger.Verbosef("%v - Received handshake response", stringer(k.WireGuardGoString()))
+	clock.Advance(12 * time.Second)
+
+	want := strings.Join([]string{
+		"PEER           HANDSHAKE  ENDPOINT            HEALTH",
+		"[MAAAA]        2m12s ago  -                   stale",
+		"[QAAAA]        never      -                   down",
+		"laptop[IMTBr]  12s ago    198.51.100.7:41641  up",
+	}, "\n") + "\n"
+	if got := x.ConnectivityMatrix(); got != want {
+		t.Errorf("ConnectivityMatrix:\n%s\nwant:\n%s", got, want)
+	}
+
+	// Without observed state, only endpoints are known.
+	x = wglog.NewLogger(logger.Discard)
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	want = "PEER     HANDSHAKE  ENDPOINT  HEALTH\n[IMTBr]  -          -         -\n"
+	if got := x.ConnectivityMatrix(); got != want {
+		t.Errorf("ConnectivityMatrix without observation:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestStructuredSink(t *testing.T) {
+	var got []logger.Message
+	x := wglog.NewLogger(logger.StructuredSink(func(m logger.Message) { got = append(got, m) }))
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	x.SetPeers([]wgcfg.Peer{{PublicKey: k}})
+	x.DeviceLogger.Errorf("%v - Failed to send handshake initiation: %v", stringer("peer(IMTB…r7lM)"), "oops")
+
+	if len(got) != 1 {
+		t.Fatalf("got %d messages; want 1", len(got))
+	}
+	if got[0].Structured != nil {
+		t.Errorf("Structured = %v; want nil for wireguard-go's printf-style line", got[0].Structured)
+	}
+	if want := "wg: [IMTBr] - Failed to send handshake initiation: oops"; got[0].String() != want {
+		t.Errorf("got %q; want %q", got[0].String(), want)
+	}
+}
+
+func TestRateLimitSuppressedAndChurn(t *testing.T) {
+	k, err := key.ParseNodePublicUntyped(mem.S("20c4c1ae54e1fd37cab6e9a532ca20646aff496796cc41d4519560e5e82bee53"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	x := wglog.NewLogger(func(format string, args ...any) {
+		got = append(got, fmt.Sprintf(format, args...))
+	}, wglog.WithClock(tstest.NewClock(tstest.ClockOpts{})),
+		wglog.WithPolicies(map[wglog.Class]wglog.Policy{wglog.ClassSendFailure: wglog.RateLimit(time.Hour, 1)}))
+	peers := []wgcfg.Peer{{PublicKey: k}}
+	x.SetPeers(peers)
+	logSendFailure := func() {
+		x.DeviceLogger.Errorf("%v - Failed to send data packets: %v", stringer("peer(IMTB…r7lM)"), "oops")
+	}
+
+	for range 3 {
+		logSendFailure()
+	}
+	// The first line is passed, along with the limiter's notice that it
+	// is out of burst, and the others are suppressed.
+	if len(got) != 2 {
+		t.Fatalf("got %q; want a line and a rate limit notice", got)
+	}
+	if want := (wglog.SinkStats{Emitted: 1, Suppressed: 2}); x.Stats().Error != want {
+		t.Errorf("Error stats = %+v; want %+v", x.Stats().Error, want)
+	}
+
+	// The limiter of a removed peer is forgotten, so a peer that comes
+	// back starts afresh.
+	x.SetPeers(nil)
+	x.SetPeers(peers)
+	got = nil
+	logSendFailure()
+	if want := "wg: [IMTBr] - Failed to send data packets: oops"; len(got) == 0 || got[0] != want {
+		t.Errorf("after peer churn, got %q; want %q first", got, want)
+	}
+}